@@ -87,10 +87,14 @@ func (p *Program) String() string {
 // Represents a Let "Statement" within our AST to indicate an identifier
 // that holds a value. A Let Statement has `Name` to hold the identifier
 // of the binding and `Value` for the expression that produces the value.
+// Destructuring lets, like `let [a, b] = pair;`, have a `Pattern` instead of a `Name`.
 type LetStatement struct {
-	Token token.Token // token.LET token
-	Name  *Identifier
-	Value Expression
+	Token     token.Token // token.LET token
+	Name      *Identifier
+	Pattern   Pattern  // Array or hash pattern destructuring the value, set when Name is nil
+	Type      TypeNode // Optional annotation of the binding: `let x: int = 5;`
+	Value     Expression
+	Semicolon token.Token // the ; ending the statement
 }
 
 // Implementing the Statement interface on LetStatement
@@ -108,7 +112,14 @@ func (ls *LetStatement) String() string {
 	var sb strings.Builder
 
 	sb.WriteString(ls.TokenLiteral() + " ")
-	sb.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		sb.WriteString(ls.Pattern.String())
+	} else {
+		sb.WriteString(ls.Name.String())
+	}
+	if ls.Type != nil {
+		sb.WriteString(": " + ls.Type.String())
+	}
 	sb.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -123,9 +134,15 @@ func (ls *LetStatement) String() string {
 // Holds identifier of the binding in the [LetStatement]
 // the x in `let x = 5;`. The value would be the name of the
 // identifier in the [LetStatement].
+//
+// Before evaluation, identifiers are resolved to the binding they refer to (see evaluator.Resolve):
+// the binding is stored in slot Slot of the environment Depth functions out from the identifier.
+// Identifiers referring to builtin functions have a negative slot.
 type Identifier struct {
 	Token token.Token // token.IDENT token
 	Value string
+	Depth int `json:"-"` // Number of functions out the binding is, set when resolving
+	Slot  int `json:"-"` // Slot of the binding within its environment, set when resolving
 }
 
 // Implementing the Expression interace on an Identifer, as when the
@@ -149,6 +166,7 @@ func (i *Identifier) String() string {
 type ReturnStatement struct {
 	Token       token.Token // token.RETURN token
 	ReturnValue Expression
+	Semicolon   token.Token // the ; ending the statement
 }
 
 // Implementing Statement interface on ReturnStatement
@@ -176,15 +194,47 @@ func (rs *ReturnStatement) String() string {
 	return sb.String()
 }
 
+// Throw Statements raise the value of their expression as an error,
+// unwinding the program up to the closest try expression catching it.
+type ThrowStatement struct {
+	Token     token.Token // token.THROW token
+	Value     Expression
+	Semicolon token.Token // the ; ending the statement
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		sb.WriteString(ts.Value.String())
+	}
+	sb.WriteString(";")
+
+	return sb.String()
+}
+
 // Expression Stament: A statement that solely consists of one expression.
 type ExpressionStatement struct {
 	Token      token.Token // First token of the expression
 	Expression Expression
+	Semicolon  token.Token // the ; ending the statement
 }
 
 // Implementing Statement interface on ExpressionStatement
 func (es *ExpressionStatement) statementNode() {}
 
+// Returns the named function the statement declares, whose name is bound within the enclosing
+// scope: `fn add(a, b) { a + b; };`. Returns nil when the statement isn't a named function.
+func (es *ExpressionStatement) Declaration() *FunctionLiteral {
+	if fn, ok := es.Expression.(*FunctionLiteral); ok && fn.Name != nil {
+		return fn
+	}
+	return nil
+}
+
 // Implementing the Node interface on ExpressionStatement
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
@@ -338,6 +388,7 @@ func (ie *InfixExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Closing    token.Token // the } token
 }
 
 // Implementing Expression interface on BlockStatement
@@ -409,6 +460,39 @@ func (ie *IfExpression) String() string {
 	return sb.String()
 }
 
+// try <block> catch (<identifier>) <block> finally <block>
+// Evaluates to the value of the try block, or to the value of the catch block when the try block
+// raises an error, which is bound to the identifier. The finally block is evaluated last, whatever happens.
+// Either the catch or the finally block may be left out.
+//
+//	let n = try { parse(input); } catch (e) { 0; };
+type TryExpression struct {
+	Token     token.Token // The `try` token
+	Body      *BlockStatement
+	Parameter *Identifier     // Name the caught error is bound to, nil without catch block
+	Catch     *BlockStatement // nil without catch block
+	Finally   *BlockStatement // nil without finally block
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("try ")
+	sb.WriteString(te.Body.String())
+	if te.Catch != nil {
+		sb.WriteString(" catch (" + te.Parameter.String() + ") ")
+		sb.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		sb.WriteString(" finally ")
+		sb.WriteString(te.Finally.String())
+	}
+
+	return sb.String()
+}
+
 // Functions are defined with the keyword `fn`, followed by a list of parameters,
 // followed by a block statement, which is the function's body, that gets executed when
 // the function is called. Below is a few examples.
@@ -431,10 +515,73 @@ func (ie *IfExpression) String() string {
 // As you can see in the examples above, the `myFunction` variable is able to store
 // the function literal as an expression, which can be invoked later by myFunction(x, y).
 // You can also use a function literal as an argument when calling another function: myFunc(x, y, fn(x, y) { return x > y; });
+//
+// Parameters and results may be annotated with types: `fn(a: int, b) -> int { ... }`.
+// Parameters may have a default value, used when the call passes no argument for them: `fn(a, b = 10)`,
+// and the last parameter may collect the remaining arguments into an array: `fn(first, ...others)`.
+//
+// Functions may be named: `fn fib(n) { ... }`. The name is bound to the function within its body,
+// so that it may call itself, or within the enclosing scope when the function is a statement of its own.
+// Anonymous functions bound by a let statement take the name of the binding.
 type FunctionLiteral struct {
-	Token      token.Token // The `fn` token
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Token          token.Token // The `fn` token
+	Name           *Identifier // Name following `fn`, nil for anonymous functions
+	Inferred       string      `json:"-"` // Name of the let binding an anonymous function, set when parsing
+	Parameters     []*Identifier
+	ParameterTypes []TypeNode   // Annotation of each parameter, nil for the ones without any
+	Defaults       []Expression // Default value of each parameter, nil for the ones without any
+	Variadic       bool         // Whether the last parameter collects the remaining arguments
+	ReturnType     TypeNode
+	Body           *BlockStatement
+	Slots          int `json:"-"` // Number of names bound by the parameters and the body, set when resolving
+}
+
+// Returns the annotation of the i-th parameter, or nil when it has none
+func (fl *FunctionLiteral) ParameterType(i int) TypeNode {
+	if i < len(fl.ParameterTypes) {
+		return fl.ParameterTypes[i]
+	}
+	return nil
+}
+
+// Returns the default value of the i-th parameter, or nil when it has none
+func (fl *FunctionLiteral) Default(i int) Expression {
+	if i < len(fl.Defaults) {
+		return fl.Defaults[i]
+	}
+	return nil
+}
+
+// Returns the least and the greatest number of arguments the function may be called with.
+// The greatest is -1 for variadic functions.
+func (fl *FunctionLiteral) Arity() (int, int) {
+	return Arity(len(fl.Parameters), fl.Defaults, fl.Variadic)
+}
+
+// Returns the least and the greatest number of arguments of a function taking n parameters
+// with the given defaults, the greatest being -1 when the function is variadic.
+// Parameters following the last one without a default value may be omitted.
+func Arity(n int, defaults []Expression, variadic bool) (int, int) {
+	fixed := n
+	if variadic {
+		fixed--
+	}
+	least := fixed
+	for least > 0 && least <= len(defaults) && defaults[least-1] != nil {
+		least--
+	}
+	if variadic {
+		return least, -1
+	}
+	return least, fixed
+}
+
+// Returns the name of the function, either its own or the one it was bound to, empty when it has none
+func (fl *FunctionLiteral) DisplayName() string {
+	if fl.Name != nil {
+		return fl.Name.Value
+	}
+	return fl.Inferred
 }
 
 // Implementing Expression interface on FunctionLiteral
@@ -452,14 +599,30 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		param := p.String()
+		if fl.Variadic && i == len(fl.Parameters)-1 {
+			param = "..." + param
+		}
+		if t := fl.ParameterType(i); t != nil {
+			param += ": " + t.String()
+		}
+		if d := fl.Default(i); d != nil {
+			param += " = " + d.String()
+		}
+		params = append(params, param)
 	}
 
 	sb.WriteString(fl.TokenLiteral())
+	if fl.Name != nil {
+		sb.WriteString(" " + fl.Name.String())
+	}
 	sb.WriteString("(")
 	sb.WriteString(strings.Join(params, ", "))
 	sb.WriteString(") ")
+	if fl.ReturnType != nil {
+		sb.WriteString("-> " + fl.ReturnType.String() + " ")
+	}
 	sb.WriteString(fl.Body.String())
 
 	return sb.String()
@@ -477,6 +640,7 @@ type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Closing   token.Token // the ) token
 }
 
 // Implementing Expression interface on CallExpression
@@ -506,6 +670,16 @@ func (ce *CallExpression) String() string {
 	return sb.String()
 }
 
+// Spreads the elements of an array as the arguments of a call: `f(...args)`
+type SpreadExpression struct {
+	Token token.Token // the `...` token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 // StringLiteral Node to represent String(s)
 // as an Expression Value-Type in our AST.
 type StringLiteral struct {
@@ -523,12 +697,40 @@ func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 // Implementing Node interface on StringLiteral
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// TemplateLiteral Node to represent template strings, embedding the values
+// of expressions within text.
+// ex. `Hello ${name}, you are ${age}`
+type TemplateLiteral struct {
+	Token  token.Token // the first part of the template, up to the first value
+	Parts  []string    // the text around the values, one more than there are values
+	Values []Expression
+	Tail   token.Token // the last part of the template, after the last value
+}
+
+func (tl *TemplateLiteral) expressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("`")
+	for i, part := range tl.Parts {
+		if i > 0 {
+			out.WriteString("${" + tl.Values[i-1].String() + "}")
+		}
+		out.WriteString(part)
+	}
+	out.WriteString("`")
+
+	return out.String()
+}
+
 // ArrayLiteral Node to represent Arrays(s)
 // as an Expression Value-Type in our AST.
 // ex. [1, 2, 3 + 3, fn(x) { x }, add(2, 2)]
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
+	Closing  token.Token // the ] token
 }
 
 // Implementing Expression interface on ArrayLiteral
@@ -564,10 +766,19 @@ func (al *ArrayLiteral) String() string {
 //		returnsArray()[1];
 //
 // basic structure is <expression>[<expression>]
+//
+// Null-safe indexes evaluate to null when the indexed value is null, rather than failing:
+// <expression>?[<expression>], or <expression>?.<identifier> for the string key named by the identifier.
 type IndexExpression struct {
-	Token token.Token // the [ token
-	Left  Expression
-	Index Expression
+	Token   token.Token // the [, ?[ or ?. token
+	Left    Expression
+	Index   Expression
+	Closing token.Token // the ] token, missing from null-safe field accesses
+}
+
+// Reports whether the index is null-safe
+func (ie *IndexExpression) Optional() bool {
+	return ie.Token.Type == token.OPTIONAL_INDEX || ie.Token.Type == token.OPTIONAL_FIELD
 }
 
 // Implementing Expression interface on IndexExpression
@@ -583,8 +794,54 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
-	out.WriteString("[")
-	out.WriteString(ie.Index.String())
+	switch ie.Token.Type {
+	case token.OPTIONAL_FIELD:
+		out.WriteString("?." + ie.Index.String() + ")")
+	case token.OPTIONAL_INDEX:
+		out.WriteString("?[" + ie.Index.String() + "])")
+	default:
+		out.WriteString("[" + ie.Index.String() + "])")
+	}
+
+	return out.String()
+}
+
+// Slice Expressions
+// ex: myArray[1:3]; myString[:-1]; myArray[2:];
+//
+// basic structure is <expression>[<expression>:<expression>], where either bound may be left out.
+// The slice holds the elements from Low up to, but not including, High.
+type SliceExpression struct {
+	Token   token.Token // the [ or ?[ token
+	Left    Expression
+	Low     Expression  // nil when slicing from the start
+	High    Expression  // nil when slicing up to the end
+	Closing token.Token // the ] token
+}
+
+// Reports whether the slice is null-safe
+func (se *SliceExpression) Optional() bool { return se.Token.Type == token.OPTIONAL_INDEX }
+
+// Implementing Expression interface on SliceExpression
+func (se *SliceExpression) expressionNode() {}
+
+// Implementing Node interface on SliceExpression
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String representation of the SliceExpression
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString(se.Token.Literal)
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
 	out.WriteString("])")
 
 	return out.String()
@@ -598,8 +855,9 @@ func (ie *IndexExpression) String() string {
 //
 //	let hash = {key: {YARTBML"};
 type HashLiteral struct {
-	Token token.Token // the '{' token
-	Pairs map[Expression]Expression
+	Token   token.Token // the '{' token
+	Pairs   map[Expression]Expression
+	Closing token.Token // the } token
 }
 
 // Implementing Expression interface on HashLiteral
@@ -624,3 +882,291 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// Basic syntactic structure of a Match Expression:
+// match (<expression>) { <pattern> => <expression>, <pattern> if <expression> => <expression>, ... }
+// Evaluates to the value of the first arm whose pattern matches the value, and whose guard is truthy.
+//
+//	match (person) {
+//		{"name": name, "age": age} if age > 17 => name,
+//		{"name": name} => name + " (minor)",
+//		_ => "nobody",
+//	}
+type MatchExpression struct {
+	Token   token.Token // the `match` token
+	Value   Expression
+	Arms    []*MatchArm
+	Closing token.Token // the } token
+}
+
+// Implementing Expression interface on MatchExpression
+func (me *MatchExpression) expressionNode() {}
+
+// Implementing Node interface on MatchExpression
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+
+// String representation of the MatchExpression
+// Implementing Node interface on MatchExpression
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	return "match (" + me.Value.String() + ") { " + strings.Join(arms, ", ") + " }"
+}
+
+// An arm of a match expression: <pattern> [if <guard>] => <value>
+type MatchArm struct {
+	Token   token.Token // the `=>` token
+	Pattern Pattern
+	Guard   Expression // Condition the arm is taken on, nil when there is none
+	Value   Expression
+}
+
+// Implementing Node interface on MatchArm
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+
+// String representation of the MatchArm
+// Implementing Node interface on MatchArm
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Value.String())
+
+	return out.String()
+}
+
+// Patterns describe the shape of values, binding the names they hold to parts of the value:
+//
+//	x                   // Any value, bound to x
+//	_                   // Any value, bound to nothing
+//	5, "a", true, -1    // Values equal to the literal
+//	[head, ...tail]     // Arrays holding at least one element, tail being an array of the others
+//	{"name": n}         // Hashes holding a value for the key "name", bound to n
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// Identifiers used as patterns match any value, binding it to their name
+func (i *Identifier) patternNode() {}
+
+// Pattern matching any value without binding it: `_`
+type WildcardPattern struct {
+	Token token.Token // the `_` token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return wp.Token.Literal }
+
+// Pattern matching values equal to an integer, string or boolean literal, possibly negated
+type LiteralPattern struct {
+	Token token.Token // the first token of the literal
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// Pattern matching arrays element by element: `[a, b]` matches arrays of two elements,
+// `[a, b, ...rest]` arrays of at least two elements, binding the other ones to rest
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+	Rest     Pattern     // Identifier or wildcard matching the remaining elements, nil when there is none
+	Closing  token.Token // the ] token
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Pattern matching hashes holding a value for each key, whatever their other keys:
+// `{"name": n}` matches hashes with a "name" key whose value matches n
+type HashPattern struct {
+	Token   token.Token  // the '{' token
+	Keys    []Expression // Literal keys, in source order
+	Values  []Pattern    // Pattern of the value of each key
+	Closing token.Token  // the } token
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+":"+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Returns the identifiers the pattern binds, in source order
+func PatternNames(pattern Pattern) []*Identifier {
+	names := []*Identifier{}
+	Inspect(pattern, func(node Node) bool {
+		switch node := node.(type) {
+		case *Identifier:
+			names = append(names, node)
+		case *LiteralPattern:
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// Type annotations of let bindings, function parameters and function results.
+// Types are named, like `int`, `string`, `bool`, `null` or `any`, or built from other types:
+//
+//	[int]                  // Array of integers
+//	{string: int}          // Hash from strings to integers
+//	fn(int, int) -> bool   // Function taking two integers and returning a boolean
+//
+// Annotations are optional: the type checker doesn't check what isn't annotated,
+// and the evaluator ignores them altogether.
+type TypeNode interface {
+	Node
+	typeNode()
+}
+
+// Type given by its name, e.g. `int`
+type NamedType struct {
+	Token token.Token // token.IDENT token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string       { return nt.Name }
+
+// Type of arrays holding elements of the same type, e.g. `[int]`
+type ArrayType struct {
+	Token   token.Token // the '[' token
+	Element TypeNode
+	Closing token.Token // the ] token
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+// Type of hashes with keys and values of the same types, e.g. `{string: int}`
+type HashType struct {
+	Token   token.Token // the '{' token
+	Key     TypeNode
+	Value   TypeNode
+	Closing token.Token // the } token
+}
+
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+// Type of functions, e.g. `fn(int, int) -> int`
+type FunctionType struct {
+	Token      token.Token // The `fn` token
+	Parameters []TypeNode
+	Result     TypeNode
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string {
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + ft.Result.String()
+}
+
+// Returns the first token of the node, which locates the node within the source.
+// Infix, call and index expressions start with their left operand rather than their own token.
+func FirstToken(node Node) token.Token {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return FirstToken(node.Statements[0])
+		}
+	case *LetStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *ThrowStatement:
+		return node.Token
+	case *ExpressionStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *BooleanLiteral:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *TemplateLiteral:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *InfixExpression:
+		return FirstToken(node.Left)
+	case *IfExpression:
+		return node.Token
+	case *TryExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *CallExpression:
+		return FirstToken(node.Function)
+	case *SpreadExpression:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *IndexExpression:
+		return FirstToken(node.Left)
+	case *SliceExpression:
+		return FirstToken(node.Left)
+	case *HashLiteral:
+		return node.Token
+	case *MatchExpression:
+		return node.Token
+	case *MatchArm:
+		return FirstToken(node.Pattern)
+	case *WildcardPattern:
+		return node.Token
+	case *LiteralPattern:
+		return node.Token
+	case *ArrayPattern:
+		return node.Token
+	case *HashPattern:
+		return node.Token
+	case *NamedType:
+		return node.Token
+	case *ArrayType:
+		return node.Token
+	case *HashType:
+		return node.Token
+	case *FunctionType:
+		return node.Token
+	}
+	return token.Token{}
+}
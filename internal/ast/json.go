@@ -0,0 +1,314 @@
+package ast
+
+import (
+	"YARTBML/token"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode"
+)
+
+// Every kind of node, by name
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &LetStatement{}, &ReturnStatement{}, &ThrowStatement{}, &ExpressionStatement{}, &BlockStatement{},
+		&Identifier{}, &IntegerLiteral{}, &BooleanLiteral{}, &StringLiteral{}, &TemplateLiteral{},
+		&PrefixExpression{}, &InfixExpression{}, &IfExpression{}, &TryExpression{}, &FunctionLiteral{},
+		&CallExpression{}, &SpreadExpression{}, &ArrayLiteral{}, &IndexExpression{}, &SliceExpression{}, &HashLiteral{},
+		&MatchExpression{}, &MatchArm{}, &WildcardPattern{}, &LiteralPattern{}, &ArrayPattern{}, &HashPattern{},
+		&NamedType{}, &ArrayType{}, &HashType{}, &FunctionType{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		nodeKinds[t.Name()] = t
+	}
+}
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+)
+
+// Encodes the tree rooted at node as JSON.
+//
+// Every node is an object holding its kind, the span from the start of its first token
+// to the end of its last one, and its fields named after the fields of the node type:
+//
+//	{
+//	  "kind": "PrefixExpression",
+//	  "span": {"start": {"offset": 0, "line": 1, "column": 1}, "end": {...}},
+//	  "token": {"type": "-", "literal": "-", "start": {...}, "end": {...}},
+//	  "operator": "-",
+//	  "right": {"kind": "IntegerLiteral", ...}
+//	}
+//
+// Children are nested objects, or arrays of objects for lists of nodes. Missing children are null.
+// Fields set when resolving names, like the slots of identifiers, are left out.
+// The pairs of hash literals are an array of `{"key": ..., "value": ...}` objects in source order.
+// The encoding is lossless: DecodeJSON rebuilds the same tree.
+func EncodeJSON(node Node) ([]byte, error) {
+	if isNil(node) {
+		return []byte("null"), nil
+	}
+	encoded, _ := encodeNode(reflect.ValueOf(node))
+	return json.MarshalIndent(encoded, "", "  ")
+}
+
+// Rebuilds the tree encoded by EncodeJSON.
+// The spans are ignored, since they are computed from the tokens.
+func DecodeJSON(data []byte) (Node, error) {
+	return decodeNode(data)
+}
+
+// A JSON object keeping its fields in order, so that the kind of nodes comes first
+type jsonObject []jsonField
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, field := range o {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		name, _ := json.Marshal(field.name)
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(name)
+		out.WriteString(":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
+type jsonSpan struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Start   token.Position  `json:"start"`
+	End     token.Position  `json:"end"`
+}
+
+type jsonPair struct {
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Encodes the node held by the value, returning the end of its last token along with it
+func encodeNode(v reflect.Value) (interface{}, token.Position) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsNil() {
+		return nil, token.Position{}
+	}
+
+	node := v.Interface().(Node)
+	elem := v.Elem()
+	fields := jsonObject{}
+	var end token.Position
+	extend := func(pos token.Position) {
+		if pos.Offset > end.Offset {
+			end = pos
+		}
+	}
+
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		value := elem.Field(i)
+		name := fieldName(field.Name)
+		if skipped(field) {
+			continue
+		}
+
+		switch {
+		case field.Type == tokenType:
+			tok := value.Interface().(token.Token)
+			fields = append(fields, jsonField{name, jsonToken{tok.Type, tok.Literal, tok.Pos, tok.End}})
+			extend(tok.End)
+		case !HoldsNodes(field.Type):
+			fields = append(fields, jsonField{name, value.Interface()})
+		case value.Kind() == reflect.Slice:
+			if value.IsNil() {
+				fields = append(fields, jsonField{name, nil})
+				continue
+			}
+			nodes := []interface{}{}
+			for j := 0; j < value.Len(); j++ {
+				encoded, last := encodeNode(value.Index(j))
+				nodes = append(nodes, encoded)
+				extend(last)
+			}
+			fields = append(fields, jsonField{name, nodes})
+		case value.Kind() == reflect.Map:
+			if value.IsNil() {
+				fields = append(fields, jsonField{name, nil})
+				continue
+			}
+			keys := value.MapKeys()
+			sort.Slice(keys, func(a, b int) bool {
+				return FirstToken(keys[a].Interface().(Node)).Pos.Offset < FirstToken(keys[b].Interface().(Node)).Pos.Offset
+			})
+			pairs := []jsonObject{}
+			for _, key := range keys {
+				encodedKey, keyEnd := encodeNode(key)
+				encodedValue, valueEnd := encodeNode(value.MapIndex(key))
+				pairs = append(pairs, jsonObject{{"key", encodedKey}, {"value", encodedValue}})
+				extend(keyEnd)
+				extend(valueEnd)
+			}
+			fields = append(fields, jsonField{name, pairs})
+		default:
+			encoded, last := encodeNode(value)
+			fields = append(fields, jsonField{name, encoded})
+			extend(last)
+		}
+	}
+
+	header := jsonObject{
+		{"kind", elem.Type().Name()},
+		{"span", jsonSpan{Start: FirstToken(node).Pos, End: end}},
+	}
+	return append(header, fields...), end
+}
+
+func decodeNode(data []byte) (Node, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var kind string
+	if err := json.Unmarshal(fields["kind"], &kind); err != nil {
+		return nil, fmt.Errorf("node without kind: %s", data)
+	}
+	t, ok := nodeKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind: %q", kind)
+	}
+
+	node := reflect.New(t)
+	elem := node.Elem()
+	for i := 0; i < elem.NumField(); i++ {
+		field := t.Field(i)
+		raw, ok := fields[fieldName(field.Name)]
+		if !ok || skipped(field) {
+			continue
+		}
+		if err := decodeField(elem.Field(i), field.Type, raw); err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", kind, field.Name, err)
+		}
+	}
+	return node.Interface().(Node), nil
+}
+
+// Decodes the JSON value into the field of a node
+func decodeField(value reflect.Value, t reflect.Type, raw json.RawMessage) error {
+	switch {
+	case t == tokenType:
+		var tok jsonToken
+		if err := json.Unmarshal(raw, &tok); err != nil {
+			return err
+		}
+		value.Set(reflect.ValueOf(token.Token{Type: tok.Type, Literal: tok.Literal, Pos: tok.Start, End: tok.End}))
+	case !HoldsNodes(t):
+		return json.Unmarshal(raw, value.Addr().Interface())
+	case t.Kind() == reflect.Slice:
+		var elements []json.RawMessage
+		if err := json.Unmarshal(raw, &elements); err != nil || elements == nil {
+			return err
+		}
+		list := reflect.MakeSlice(t, 0, len(elements))
+		for _, el := range elements {
+			n, err := decodeChild(el, t.Elem())
+			if err != nil {
+				return err
+			}
+			list = reflect.Append(list, n)
+		}
+		value.Set(list)
+	case t.Kind() == reflect.Map:
+		var pairs []jsonPair
+		if err := json.Unmarshal(raw, &pairs); err != nil || pairs == nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(t, len(pairs))
+		for _, pair := range pairs {
+			key, err := decodeChild(pair.Key, t.Key())
+			if err != nil {
+				return err
+			}
+			v, err := decodeChild(pair.Value, t.Elem())
+			if err != nil {
+				return err
+			}
+			m.SetMapIndex(key, v)
+		}
+		value.Set(m)
+	default:
+		n, err := decodeChild(raw, t)
+		if err != nil {
+			return err
+		}
+		value.Set(n)
+	}
+	return nil
+}
+
+// Decodes a node, checking that it fits a value of type t
+func decodeChild(raw json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	n, err := decodeNode(raw)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if n == nil {
+		return reflect.Zero(t), nil
+	}
+	v := reflect.ValueOf(n)
+	if !v.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("%s can't hold a %s", t, v.Elem().Type().Name())
+	}
+	return v, nil
+}
+
+// Reports whether a field of the given type holds nodes (a node, a slice of nodes or a map of nodes)
+func HoldsNodes(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice:
+		return t.Elem().Implements(nodeType)
+	case reflect.Map:
+		return t.Key().Implements(nodeType) || t.Elem().Implements(nodeType)
+	default:
+		return t.Implements(nodeType)
+	}
+}
+
+// Reports whether the field is left out of the encoding, like the slots the evaluator sets when
+// resolving names, which aren't part of the syntax
+func skipped(field reflect.StructField) bool {
+	return field.Tag.Get("json") == "-"
+}
+
+// Returns the JSON name of a field of a node: `TestCondition` is `testCondition`
+func fieldName(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,167 @@
+package ast
+
+import (
+	"YARTBML/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	program := testProgram()
+	program.Statements = append(program.Statements,
+		&ExpressionStatement{Token: token.Token{Type: token.IF, Literal: "if"}, Expression: &IfExpression{
+			TestCondition: &Identifier{Value: "x"}, ThenPath: &BlockStatement{},
+		}},
+		&LetStatement{Name: &Identifier{Value: "broken"}},
+		typedLet(),
+		&LetStatement{
+			Pattern: &ArrayPattern{Elements: []Pattern{&Identifier{Value: "a"}, &WildcardPattern{}}, Rest: &Identifier{Value: "rest"}},
+			Value:   &Identifier{Value: "xs"},
+		},
+		&ExpressionStatement{Expression: &FunctionLiteral{
+			Parameters: []*Identifier{{Value: "a"}, {Value: "b"}, {Value: "rest"}},
+			Defaults:   []Expression{nil, &IntegerLiteral{Value: 1}, nil},
+			Variadic:   true,
+			Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &CallExpression{
+				Function:  &Identifier{Value: "f"},
+				Arguments: []Expression{&SpreadExpression{Value: &Identifier{Value: "rest"}}},
+			}}}},
+		}},
+		&ExpressionStatement{Expression: &TemplateLiteral{
+			Token:  token.Token{Type: token.TEMPLATE_HEAD, Literal: "a "},
+			Parts:  []string{"a ", ""},
+			Values: []Expression{&Identifier{Value: "x"}},
+			Tail:   token.Token{Type: token.TEMPLATE_TAIL, Literal: ""},
+		}},
+		&ExpressionStatement{Expression: &SliceExpression{
+			Token: token.Token{Type: token.LBRACKET, Literal: "["},
+			Left:  &Identifier{Value: "xs"},
+			High:  &IntegerLiteral{Value: -1},
+		}},
+	)
+
+	encoded, err := EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON failed: %s", err)
+	}
+	decoded, err := DecodeJSON(encoded)
+	if err != nil {
+		t.Fatalf("DecodeJSON failed: %s", err)
+	}
+
+	reencoded, err := EncodeJSON(decoded)
+	if err != nil {
+		t.Fatalf("EncodeJSON failed: %s", err)
+	}
+	if string(reencoded) != string(encoded) {
+		t.Errorf("decoded tree encodes differently.\nexpected=%s\ngot=%s", encoded, reencoded)
+	}
+
+	// Hash literals can't be compared deeply, as their keys are pointers
+	decoded.(*Program).Statements[2], program.Statements[2] = nil, nil
+	if !reflect.DeepEqual(decoded, Node(program)) {
+		t.Errorf("decoded tree differs.\nexpected=%#v\ngot=%#v", program, decoded)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	node := &PrefixExpression{
+		Token:    token.Token{Type: token.MINUS, Literal: "-", Pos: token.Position{Offset: 0, Line: 1, Column: 1}, End: token.Position{Offset: 1, Line: 1, Column: 2}},
+		Operator: "-",
+		Right: &IntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: "5", Pos: token.Position{Offset: 1, Line: 1, Column: 2}, End: token.Position{Offset: 2, Line: 1, Column: 3}},
+			Value: 5,
+		},
+	}
+
+	encoded, err := EncodeJSON(node)
+	if err != nil {
+		t.Fatalf("EncodeJSON failed: %s", err)
+	}
+
+	expected := `{
+  "kind": "PrefixExpression",
+  "span": {
+    "start": {
+      "offset": 0,
+      "line": 1,
+      "column": 1
+    },
+    "end": {
+      "offset": 2,
+      "line": 1,
+      "column": 3
+    }
+  },
+  "token": {
+    "type": "-",
+    "literal": "-",
+    "start": {
+      "offset": 0,
+      "line": 1,
+      "column": 1
+    },
+    "end": {
+      "offset": 1,
+      "line": 1,
+      "column": 2
+    }
+  },
+  "operator": "-",
+  "right": {
+    "kind": "IntegerLiteral",
+    "span": {
+      "start": {
+        "offset": 1,
+        "line": 1,
+        "column": 2
+      },
+      "end": {
+        "offset": 2,
+        "line": 1,
+        "column": 3
+      }
+    },
+    "token": {
+      "type": "INT",
+      "literal": "5",
+      "start": {
+        "offset": 1,
+        "line": 1,
+        "column": 2
+      },
+      "end": {
+        "offset": 2,
+        "line": 1,
+        "column": 3
+      }
+    },
+    "value": 5
+  }
+}`
+	if string(encoded) != expected {
+		t.Errorf("wrong encoding.\nexpected=%s\ngot=%s", expected, encoded)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "WhileLoop"}`, `unknown node kind: "WhileLoop"`},
+		{`{"value": 5}`, "node without kind"},
+		{`{"kind": "LetStatement", "name": {"kind": "IntegerLiteral", "value": 5}}`, "LetStatement.Name: *ast.Identifier can't hold a IntegerLiteral"},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier"}]}`, "Program.Statements: ast.Statement can't hold a Identifier"},
+		{`{"kind": "IntegerLiteral", "value": "five"}`, "IntegerLiteral.Value: json: cannot unmarshal"},
+		{`[1, 2]`, "cannot unmarshal array"},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %s. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
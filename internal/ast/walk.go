@@ -0,0 +1,488 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Returns the nodes held by the node, in source order.
+// Missing parts of the node, like the else branch of an if expression or the pieces
+// left out by the parser after a syntax error, aren't children.
+func Children(node Node) []Node {
+	children := []Node{}
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if !isNil(n) {
+				children = append(children, n)
+			}
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			add(stmt)
+		}
+	case *LetStatement:
+		add(node.Name, node.Pattern, node.Type, node.Value)
+	case *ReturnStatement:
+		add(node.ReturnValue)
+	case *ThrowStatement:
+		add(node.Value)
+	case *ExpressionStatement:
+		add(node.Expression)
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			add(stmt)
+		}
+	case *PrefixExpression:
+		add(node.Right)
+	case *InfixExpression:
+		add(node.Left, node.Right)
+	case *IfExpression:
+		add(node.TestCondition, node.ThenPath, node.ElsePath)
+	case *TryExpression:
+		add(node.Body, node.Parameter, node.Catch, node.Finally)
+	case *FunctionLiteral:
+		add(node.Name)
+		for i, param := range node.Parameters {
+			add(param, node.ParameterType(i), node.Default(i))
+		}
+		add(node.ReturnType, node.Body)
+	case *CallExpression:
+		add(node.Function)
+		for _, arg := range node.Arguments {
+			add(arg)
+		}
+	case *SpreadExpression:
+		add(node.Value)
+	case *TemplateLiteral:
+		for _, value := range node.Values {
+			add(value)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			add(el)
+		}
+	case *IndexExpression:
+		add(node.Left, node.Index)
+	case *SliceExpression:
+		add(node.Left, node.Low, node.High)
+	case *HashLiteral:
+		for _, key := range node.Keys() {
+			add(key, node.Pairs[key])
+		}
+	case *MatchExpression:
+		add(node.Value)
+		for _, arm := range node.Arms {
+			add(arm)
+		}
+	case *MatchArm:
+		add(node.Pattern, node.Guard, node.Value)
+	case *LiteralPattern:
+		add(node.Value)
+	case *ArrayPattern:
+		for _, el := range node.Elements {
+			add(el)
+		}
+		add(node.Rest)
+	case *HashPattern:
+		for i, key := range node.Keys {
+			add(key)
+			if i < len(node.Values) {
+				add(node.Values[i])
+			}
+		}
+	case *ArrayType:
+		add(node.Element)
+	case *HashType:
+		add(node.Key, node.Value)
+	case *FunctionType:
+		for _, param := range node.Parameters {
+			add(param)
+		}
+		add(node.Result)
+	}
+	return children
+}
+
+// Returns the keys of the pairs of the hash literal in source order, as the order of the map is random
+func (hl *HashLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return FirstToken(keys[i]).Pos.Offset < FirstToken(keys[j]).Pos.Offset
+	})
+	return keys
+}
+
+// A Visitor's Visit method is called for every node found by Walk.
+// When it returns a non-nil visitor w, Walk visits each child of the node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Traverses the tree rooted at node in depth-first order, starting with v.Visit(node).
+func Walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range Children(node) {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Calls fn for the node and every node below it, in depth-first order.
+// The children of a node are skipped when fn returns false.
+// Once the children of a node are done, fn is called with nil.
+func Inspect(node Node, fn func(Node) bool) {
+	Walk(inspector(fn), node)
+}
+
+// Returns the tree rooted at node with every node replaced by the result of fn,
+// leaving the original tree untouched.
+//
+// The children of a node are rewritten before the node itself, so fn sees the node holding
+// its rewritten children. Nodes whose children didn't change are shared with the original
+// tree rather than copied: fn returns its argument to keep a node as it is.
+// Returning nil removes the node from the list holding it, like the statements of a block
+// or the arguments of a call, or clears the field holding it.
+//
+// The replacement must fit the place of the node: an expression for an expression,
+// a statement for a statement, a block for a block, an identifier for an identifier, a pattern for a pattern
+// and a type for a type.
+// Rewrite panics otherwise.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	if isNil(node) {
+		return node
+	}
+	return fn(rewriteChildren(node, fn))
+}
+
+func rewriteChildren(node Node, fn func(Node) Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		if stmts, changed := rewriteStatements(node.Statements, fn); changed {
+			n := *node
+			n.Statements = stmts
+			return &n
+		}
+	case *LetStatement:
+		name, nameChanged := rewriteIdentifier(node.Name, fn)
+		pattern, patternChanged := rewritePattern(node.Pattern, fn)
+		t, typeChanged := rewriteType(node.Type, fn)
+		value, valueChanged := rewriteExpression(node.Value, fn)
+		if nameChanged || patternChanged || typeChanged || valueChanged {
+			n := *node
+			n.Name, n.Pattern, n.Type, n.Value = name, pattern, t, value
+			return &n
+		}
+	case *ReturnStatement:
+		if value, changed := rewriteExpression(node.ReturnValue, fn); changed {
+			n := *node
+			n.ReturnValue = value
+			return &n
+		}
+	case *ThrowStatement:
+		if value, changed := rewriteExpression(node.Value, fn); changed {
+			n := *node
+			n.Value = value
+			return &n
+		}
+	case *ExpressionStatement:
+		if expr, changed := rewriteExpression(node.Expression, fn); changed {
+			n := *node
+			n.Expression = expr
+			return &n
+		}
+	case *BlockStatement:
+		if stmts, changed := rewriteStatements(node.Statements, fn); changed {
+			n := *node
+			n.Statements = stmts
+			return &n
+		}
+	case *PrefixExpression:
+		if right, changed := rewriteExpression(node.Right, fn); changed {
+			n := *node
+			n.Right = right
+			return &n
+		}
+	case *InfixExpression:
+		left, leftChanged := rewriteExpression(node.Left, fn)
+		right, rightChanged := rewriteExpression(node.Right, fn)
+		if leftChanged || rightChanged {
+			n := *node
+			n.Left, n.Right = left, right
+			return &n
+		}
+	case *IfExpression:
+		condition, conditionChanged := rewriteExpression(node.TestCondition, fn)
+		then, thenChanged := rewriteBlock(node.ThenPath, fn)
+		otherwise, elseChanged := rewriteBlock(node.ElsePath, fn)
+		if conditionChanged || thenChanged || elseChanged {
+			n := *node
+			n.TestCondition, n.ThenPath, n.ElsePath = condition, then, otherwise
+			return &n
+		}
+	case *TryExpression:
+		body, bodyChanged := rewriteBlock(node.Body, fn)
+		param, paramChanged := rewriteIdentifier(node.Parameter, fn)
+		catch, catchChanged := rewriteBlock(node.Catch, fn)
+		finally, finallyChanged := rewriteBlock(node.Finally, fn)
+		if bodyChanged || paramChanged || catchChanged || finallyChanged {
+			n := *node
+			n.Body, n.Parameter, n.Catch, n.Finally = body, param, catch, finally
+			return &n
+		}
+	case *FunctionLiteral:
+		// Parameters, their types and their defaults are rewritten in place, so that they stay aligned
+		name, nameChanged := rewriteIdentifier(node.Name, fn)
+		params, paramsChanged := rewriteAligned(node.Parameters, fn, rewriteIdentifier)
+		types, typesChanged := rewriteAligned(node.ParameterTypes, fn, rewriteType)
+		defaults, defaultsChanged := rewriteAligned(node.Defaults, fn, rewriteExpression)
+		result, resultChanged := rewriteType(node.ReturnType, fn)
+		body, bodyChanged := rewriteBlock(node.Body, fn)
+		if nameChanged || paramsChanged || typesChanged || defaultsChanged || resultChanged || bodyChanged {
+			n := *node
+			n.Name, n.Parameters, n.ParameterTypes, n.Defaults = name, params, types, defaults
+			n.ReturnType, n.Body = result, body
+			return &n
+		}
+	case *CallExpression:
+		function, functionChanged := rewriteExpression(node.Function, fn)
+		args, argsChanged := rewriteList(node.Arguments, fn, rewriteExpression)
+		if functionChanged || argsChanged {
+			n := *node
+			n.Function, n.Arguments = function, args
+			return &n
+		}
+	case *SpreadExpression:
+		if value, changed := rewriteExpression(node.Value, fn); changed {
+			n := *node
+			n.Value = value
+			return &n
+		}
+	case *TemplateLiteral:
+		if values, changed := rewriteAligned(node.Values, fn, rewriteExpression); changed {
+			n := *node
+			n.Values = values
+			return &n
+		}
+	case *ArrayLiteral:
+		if elements, changed := rewriteList(node.Elements, fn, rewriteExpression); changed {
+			n := *node
+			n.Elements = elements
+			return &n
+		}
+	case *IndexExpression:
+		left, leftChanged := rewriteExpression(node.Left, fn)
+		index, indexChanged := rewriteExpression(node.Index, fn)
+		if leftChanged || indexChanged {
+			n := *node
+			n.Left, n.Index = left, index
+			return &n
+		}
+	case *SliceExpression:
+		left, leftChanged := rewriteExpression(node.Left, fn)
+		low, lowChanged := rewriteExpression(node.Low, fn)
+		high, highChanged := rewriteExpression(node.High, fn)
+		if leftChanged || lowChanged || highChanged {
+			n := *node
+			n.Left, n.Low, n.High = left, low, high
+			return &n
+		}
+	case *HashLiteral:
+		pairs, changed := map[Expression]Expression{}, false
+		for _, key := range node.Keys() {
+			newKey, keyChanged := rewriteExpression(key, fn)
+			newValue, valueChanged := rewriteExpression(node.Pairs[key], fn)
+			changed = changed || keyChanged || valueChanged
+			if newKey != nil && newValue != nil {
+				pairs[newKey] = newValue
+			}
+		}
+		if changed {
+			n := *node
+			n.Pairs = pairs
+			return &n
+		}
+	case *MatchExpression:
+		value, valueChanged := rewriteExpression(node.Value, fn)
+		arms, armsChanged := rewriteList(node.Arms, fn, rewriteArm)
+		if valueChanged || armsChanged {
+			n := *node
+			n.Value, n.Arms = value, arms
+			return &n
+		}
+	case *MatchArm:
+		pattern, patternChanged := rewritePattern(node.Pattern, fn)
+		guard, guardChanged := rewriteExpression(node.Guard, fn)
+		value, valueChanged := rewriteExpression(node.Value, fn)
+		if patternChanged || guardChanged || valueChanged {
+			n := *node
+			n.Pattern, n.Guard, n.Value = pattern, guard, value
+			return &n
+		}
+	case *LiteralPattern:
+		if value, changed := rewriteExpression(node.Value, fn); changed {
+			n := *node
+			n.Value = value
+			return &n
+		}
+	case *ArrayPattern:
+		elements, elementsChanged := rewriteList(node.Elements, fn, rewritePattern)
+		rest, restChanged := rewritePattern(node.Rest, fn)
+		if elementsChanged || restChanged {
+			n := *node
+			n.Elements, n.Rest = elements, rest
+			return &n
+		}
+	case *HashPattern:
+		// Keys and their patterns are rewritten in place, so that they stay aligned
+		keys, keysChanged := rewriteAligned(node.Keys, fn, rewriteExpression)
+		values, valuesChanged := rewriteAligned(node.Values, fn, rewritePattern)
+		if keysChanged || valuesChanged {
+			n := *node
+			n.Keys, n.Values = keys, values
+			return &n
+		}
+	case *ArrayType:
+		if element, changed := rewriteType(node.Element, fn); changed {
+			n := *node
+			n.Element = element
+			return &n
+		}
+	case *HashType:
+		key, keyChanged := rewriteType(node.Key, fn)
+		value, valueChanged := rewriteType(node.Value, fn)
+		if keyChanged || valueChanged {
+			n := *node
+			n.Key, n.Value = key, value
+			return &n
+		}
+	case *FunctionType:
+		params, paramsChanged := rewriteList(node.Parameters, fn, rewriteType)
+		result, resultChanged := rewriteType(node.Result, fn)
+		if paramsChanged || resultChanged {
+			n := *node
+			n.Parameters, n.Result = params, result
+			return &n
+		}
+	}
+	return node
+}
+
+// Rewrites the nodes of the list, dropping the ones replaced by nil.
+// The list is only copied when one of its nodes changed.
+func rewriteList[T Node](list []T, fn func(Node) Node, rewrite func(T, func(Node) Node) (T, bool)) ([]T, bool) {
+	var rewritten []T
+	for i, node := range list {
+		n, changed := rewrite(node, fn)
+		if changed && rewritten == nil {
+			rewritten = make([]T, i, len(list))
+			copy(rewritten, list[:i])
+		}
+		if rewritten != nil && !isNil(n) {
+			rewritten = append(rewritten, n)
+		}
+	}
+	if rewritten == nil {
+		return list, false
+	}
+	return rewritten, true
+}
+
+// Rewrites the nodes of the list, keeping the ones replaced by nil as nil
+func rewriteAligned[T Node](list []T, fn func(Node) Node, rewrite func(T, func(Node) Node) (T, bool)) ([]T, bool) {
+	var rewritten []T
+	for i, node := range list {
+		n, changed := rewrite(node, fn)
+		if changed && rewritten == nil {
+			rewritten = make([]T, len(list))
+			copy(rewritten, list)
+		}
+		if rewritten != nil {
+			rewritten[i] = n
+		}
+	}
+	if rewritten == nil {
+		return list, false
+	}
+	return rewritten, true
+}
+
+func rewriteStatements(stmts []Statement, fn func(Node) Node) ([]Statement, bool) {
+	return rewriteList(stmts, fn, rewriteStatement)
+}
+
+func rewriteStatement(stmt Statement, fn func(Node) Node) (Statement, bool) {
+	return rewriteAs[Statement](stmt, fn, "statement")
+}
+
+func rewriteExpression(expr Expression, fn func(Node) Node) (Expression, bool) {
+	return rewriteAs[Expression](expr, fn, "expression")
+}
+
+func rewriteBlock(block *BlockStatement, fn func(Node) Node) (*BlockStatement, bool) {
+	return rewriteAs[*BlockStatement](block, fn, "block")
+}
+
+func rewriteType(t TypeNode, fn func(Node) Node) (TypeNode, bool) {
+	return rewriteAs[TypeNode](t, fn, "type")
+}
+
+func rewritePattern(pattern Pattern, fn func(Node) Node) (Pattern, bool) {
+	return rewriteAs[Pattern](pattern, fn, "pattern")
+}
+
+func rewriteArm(arm *MatchArm, fn func(Node) Node) (*MatchArm, bool) {
+	return rewriteAs[*MatchArm](arm, fn, "match arm")
+}
+
+func rewriteIdentifier(ident *Identifier, fn func(Node) Node) (*Identifier, bool) {
+	return rewriteAs[*Identifier](ident, fn, "identifier")
+}
+
+// Rewrites the node, checking that its replacement fits the place of the node
+func rewriteAs[T Node](node T, fn func(Node) Node, place string) (T, bool) {
+	var zero T
+	if isNil(node) {
+		return node, false
+	}
+
+	n := Rewrite(node, fn)
+	if isNil(n) {
+		return zero, true
+	}
+	replacement, ok := n.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast: cannot replace the %s %s with %T", place, node.String(), n))
+	}
+	return replacement, Node(replacement) != Node(node)
+}
+
+// Reports whether the node is missing, either as a nil interface or a nil pointer
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
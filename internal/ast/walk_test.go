@@ -0,0 +1,421 @@
+package ast
+
+import (
+	"YARTBML/token"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Builds the tree of the following program, which holds every kind of node but the types,
+// which typedLet holds:
+//
+//	let f = fn(a) { return -a; };
+//	if (true) { f(1); } else { ["s"][0]; };
+//	{"k": 1 + 2};
+//	match (f) { [a, ...r] if a => f(...r), {"k": _} => `t${a}`, 3 => a[1:] };
+//	try { throw 4; } catch (e) { e; };
+func testProgram() *Program {
+	offset := 0
+	tok := func(t token.TokenType, literal string) token.Token {
+		offset++
+		return token.Token{Type: t, Literal: literal, Pos: token.Position{Offset: offset}}
+	}
+	ident := func(name string) *Identifier { return &Identifier{Token: tok(token.IDENT, name), Value: name} }
+	integer := func(v int64) *IntegerLiteral {
+		return &IntegerLiteral{Token: tok(token.INT, fmt.Sprint(v)), Value: v}
+	}
+
+	return &Program{Statements: []Statement{
+		&LetStatement{Token: tok(token.LET, "let"), Name: ident("f"), Value: &FunctionLiteral{
+			Token:      tok(token.FUNCTION, "fn"),
+			Parameters: []*Identifier{ident("a")},
+			Body: &BlockStatement{Token: tok(token.LBRACE, "{"), Statements: []Statement{
+				&ReturnStatement{Token: tok(token.RETURN, "return"), ReturnValue: &PrefixExpression{
+					Token: tok(token.MINUS, "-"), Operator: "-", Right: ident("a"),
+				}},
+			}},
+		}},
+		&ExpressionStatement{Token: tok(token.IF, "if"), Expression: &IfExpression{
+			Token:         tok(token.IF, "if"),
+			TestCondition: &BooleanLiteral{Token: tok(token.TRUE, "true"), Value: true},
+			ThenPath: &BlockStatement{Token: tok(token.LBRACE, "{"), Statements: []Statement{
+				&ExpressionStatement{Token: tok(token.IDENT, "f"), Expression: &CallExpression{
+					Token: tok(token.LPAREN, "("), Function: ident("f"), Arguments: []Expression{integer(1)},
+				}},
+			}},
+			ElsePath: &BlockStatement{Token: tok(token.LBRACE, "{"), Statements: []Statement{
+				&ExpressionStatement{Token: tok(token.LBRACKET, "["), Expression: &IndexExpression{
+					Token: tok(token.LBRACKET, "["),
+					Left: &ArrayLiteral{Token: tok(token.LBRACKET, "["), Elements: []Expression{
+						&StringLiteral{Token: tok(token.STRING, "s"), Value: "s"},
+					}},
+					Index: integer(0),
+				}},
+			}},
+		}},
+		&ExpressionStatement{Token: tok(token.LBRACE, "{"), Expression: &HashLiteral{
+			Token: tok(token.LBRACE, "{"),
+			Pairs: map[Expression]Expression{
+				&StringLiteral{Token: tok(token.STRING, "k"), Value: "k"}: &InfixExpression{
+					Token: tok(token.PLUS, "+"), Left: integer(1), Operator: "+", Right: integer(2),
+				},
+			},
+		}},
+		&ExpressionStatement{Token: tok(token.MATCH, "match"), Expression: &MatchExpression{
+			Token: tok(token.MATCH, "match"),
+			Value: ident("f"),
+			Arms: []*MatchArm{
+				{
+					Token: tok(token.FAT_ARROW, "=>"),
+					Pattern: &ArrayPattern{
+						Token: tok(token.LBRACKET, "["), Elements: []Pattern{ident("a")}, Rest: ident("r"),
+					},
+					Guard: ident("a"),
+					Value: &CallExpression{Token: tok(token.LPAREN, "("), Function: ident("f"), Arguments: []Expression{
+						&SpreadExpression{Token: tok(token.ELLIPSIS, "..."), Value: ident("r")},
+					}},
+				},
+				{
+					Token: tok(token.FAT_ARROW, "=>"),
+					Pattern: &HashPattern{
+						Token:  tok(token.LBRACE, "{"),
+						Keys:   []Expression{&StringLiteral{Token: tok(token.STRING, "k"), Value: "k"}},
+						Values: []Pattern{&WildcardPattern{Token: tok(token.IDENT, "_")}},
+					},
+					Value: &TemplateLiteral{
+						Token: tok(token.TEMPLATE_HEAD, "t"), Parts: []string{"t", ""}, Values: []Expression{ident("a")},
+						Tail: tok(token.TEMPLATE_TAIL, ""),
+					},
+				},
+				{
+					Token:   tok(token.FAT_ARROW, "=>"),
+					Pattern: &LiteralPattern{Token: tok(token.INT, "3"), Value: integer(3)},
+					Value:   &SliceExpression{Token: tok(token.LBRACKET, "["), Left: ident("a"), Low: integer(1)},
+				},
+			},
+		}},
+		&ExpressionStatement{Token: tok(token.TRY, "try"), Expression: &TryExpression{
+			Token: tok(token.TRY, "try"),
+			Body: &BlockStatement{Token: tok(token.LBRACE, "{"), Statements: []Statement{
+				&ThrowStatement{Token: tok(token.THROW, "throw"), Value: integer(4)},
+			}},
+			Parameter: ident("e"),
+			Catch: &BlockStatement{Token: tok(token.LBRACE, "{"), Statements: []Statement{
+				&ExpressionStatement{Token: tok(token.IDENT, "e"), Expression: ident("e")},
+			}},
+		}},
+	}}
+}
+
+// Returns `let f: fn(int, [bool]) -> {string: int} = fn(a, b: [bool]) -> {string: int} {};`
+func typedLet() *LetStatement {
+	named := func(name string) *NamedType {
+		return &NamedType{Token: token.Token{Type: token.IDENT, Literal: name}, Name: name}
+	}
+	result := func() *HashType { return &HashType{Key: named("string"), Value: named("int")} }
+	return &LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let"},
+		Name:  &Identifier{Value: "f"},
+		Type:  &FunctionType{Parameters: []TypeNode{named("int"), &ArrayType{Element: named("bool")}}, Result: result()},
+		Value: &FunctionLiteral{
+			Token:          token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Parameters:     []*Identifier{{Value: "a"}, {Value: "b"}},
+			ParameterTypes: []TypeNode{nil, &ArrayType{Element: named("bool")}},
+			ReturnType:     result(),
+			Body:           &BlockStatement{},
+		},
+	}
+}
+
+func typeName(node Node) string {
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+func TestInspect(t *testing.T) {
+	visited := []string{}
+	Inspect(testProgram(), func(node Node) bool {
+		if node != nil {
+			visited = append(visited, typeName(node))
+		}
+		return true
+	})
+
+	expected := []string{
+		"Program",
+		"LetStatement", "Identifier", "FunctionLiteral", "Identifier", "BlockStatement",
+		"ReturnStatement", "PrefixExpression", "Identifier",
+		"ExpressionStatement", "IfExpression", "BooleanLiteral",
+		"BlockStatement", "ExpressionStatement", "CallExpression", "Identifier", "IntegerLiteral",
+		"BlockStatement", "ExpressionStatement", "IndexExpression", "ArrayLiteral", "StringLiteral", "IntegerLiteral",
+		"ExpressionStatement", "HashLiteral", "StringLiteral", "InfixExpression", "IntegerLiteral", "IntegerLiteral",
+		"ExpressionStatement", "MatchExpression", "Identifier",
+		"MatchArm", "ArrayPattern", "Identifier", "Identifier", "Identifier",
+		"CallExpression", "Identifier", "SpreadExpression", "Identifier",
+		"MatchArm", "HashPattern", "StringLiteral", "WildcardPattern", "TemplateLiteral", "Identifier",
+		"MatchArm", "LiteralPattern", "IntegerLiteral", "SliceExpression", "Identifier", "IntegerLiteral",
+		"ExpressionStatement", "TryExpression", "BlockStatement", "ThrowStatement", "IntegerLiteral",
+		"Identifier", "BlockStatement", "ExpressionStatement", "Identifier",
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong nodes visited.\nexpected=%v\ngot=%v", expected, visited)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	visited := []string{}
+	Inspect(testProgram(), func(node Node) bool {
+		if node == nil {
+			return false
+		}
+		visited = append(visited, typeName(node))
+		_, isStatement := node.(Statement)
+		return !isStatement
+	})
+
+	expected := []string{
+		"Program", "LetStatement", "ExpressionStatement", "ExpressionStatement", "ExpressionStatement", "ExpressionStatement",
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong nodes visited.\nexpected=%v\ngot=%v", expected, visited)
+	}
+}
+
+type depthVisitor struct {
+	depth int
+	out   *strings.Builder
+}
+
+func (v *depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		fmt.Fprintf(v.out, "%s)\n", strings.Repeat(" ", v.depth-1))
+		return nil
+	}
+	fmt.Fprintf(v.out, "%s(%s\n", strings.Repeat(" ", v.depth), typeName(node))
+	return &depthVisitor{depth: v.depth + 1, out: v.out}
+}
+
+func TestWalk(t *testing.T) {
+	var out strings.Builder
+	program := testProgram()
+	program.Statements = program.Statements[:1]
+	Walk(&depthVisitor{out: &out}, program)
+
+	expected := `(Program
+ (LetStatement
+  (Identifier
+  )
+  (FunctionLiteral
+   (Identifier
+   )
+   (BlockStatement
+    (ReturnStatement
+     (PrefixExpression
+      (Identifier
+      )
+     )
+    )
+   )
+  )
+ )
+)
+`
+	if out.String() != expected {
+		t.Errorf("wrong walk.\nexpected=%s\ngot=%s", expected, out.String())
+	}
+
+	// The missing finally block isn't visited
+	out.Reset()
+	Walk(&depthVisitor{out: &out}, testProgram().Statements[4])
+	expected = `(ExpressionStatement
+ (TryExpression
+  (BlockStatement
+   (ThrowStatement
+    (IntegerLiteral
+    )
+   )
+  )
+  (Identifier
+  )
+  (BlockStatement
+   (ExpressionStatement
+    (Identifier
+    )
+   )
+  )
+ )
+)
+`
+	if out.String() != expected {
+		t.Errorf("wrong walk of the try expression.\nexpected=%s\ngot=%s", expected, out.String())
+	}
+}
+
+func TestWalkTypes(t *testing.T) {
+	visited := []string{}
+	Inspect(typedLet(), func(node Node) bool {
+		if node != nil {
+			visited = append(visited, typeName(node))
+		}
+		return true
+	})
+
+	expected := []string{
+		"LetStatement", "Identifier", "FunctionType", "NamedType", "ArrayType", "NamedType",
+		"HashType", "NamedType", "NamedType",
+		"FunctionLiteral", "Identifier", "Identifier", "ArrayType", "NamedType",
+		"HashType", "NamedType", "NamedType", "BlockStatement",
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong nodes visited.\nexpected=%v\ngot=%v", expected, visited)
+	}
+}
+
+func TestRewriteTypes(t *testing.T) {
+	let := typedLet()
+
+	// Replaces every array type by `any` and drops the result type of the function
+	rewritten := Rewrite(let, func(node Node) Node {
+		switch node := node.(type) {
+		case *ArrayType:
+			return &NamedType{Name: "any"}
+		case *FunctionLiteral:
+			n := *node
+			n.ReturnType = nil
+			return &n
+		}
+		return node
+	})
+
+	expected := "let f: fn(int, any) -> {string: int} = fn(a, b: any) ;"
+	if rewritten.String() != expected {
+		t.Errorf("wrong rewritten let. expected=%q, got=%q", expected, rewritten.String())
+	}
+	function := rewritten.(*LetStatement).Value.(*FunctionLiteral)
+	if len(function.ParameterTypes) != 2 || function.ParameterTypes[0] != nil {
+		t.Errorf("parameter types aren't aligned with the parameters. got=%v", function.ParameterTypes)
+	}
+}
+
+func TestChildrenOfIncompleteNodes(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected int
+	}{
+		{&IfExpression{TestCondition: &BooleanLiteral{}, ThenPath: &BlockStatement{}}, 2},
+		{&LetStatement{Name: &Identifier{}, Value: (*FunctionLiteral)(nil)}, 1},
+		{&ReturnStatement{}, 0},
+		{&FunctionLiteral{Parameters: []*Identifier{{}, nil}}, 1},
+		{&Identifier{}, 0},
+		{&IntegerLiteral{}, 0},
+	}
+
+	for _, tt := range tests {
+		if children := Children(tt.node); len(children) != tt.expected {
+			t.Errorf("wrong number of children for %T. expected=%d, got=%d", tt.node, tt.expected, len(children))
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := testProgram()
+	before := program.String()
+
+	// Doubles every integer
+	rewritten := Rewrite(program, func(node Node) Node {
+		if il, ok := node.(*IntegerLiteral); ok {
+			return &IntegerLiteral{Token: il.Token, Value: il.Value * 2}
+		}
+		return node
+	}).(*Program)
+
+	if program.String() != before {
+		t.Errorf("original tree changed. got=%q", program.String())
+	}
+
+	integers := []int64{}
+	Inspect(rewritten, func(node Node) bool {
+		if il, ok := node.(*IntegerLiteral); ok {
+			integers = append(integers, il.Value)
+		}
+		return true
+	})
+	if !reflect.DeepEqual(integers, []int64{2, 0, 2, 4, 6, 2, 8}) {
+		t.Errorf("wrong integers. got=%v", integers)
+	}
+
+	// The let statement holds no integer, so it's shared with the original tree
+	if rewritten.Statements[0] != program.Statements[0] {
+		t.Errorf("unchanged statement was copied")
+	}
+	for i := 1; i < len(program.Statements); i++ {
+		if rewritten.Statements[i] == program.Statements[i] {
+			t.Errorf("changed statement %d wasn't copied", i)
+		}
+	}
+
+	// Within the match expression, only the arm holding an integer is copied
+	match := rewritten.Statements[3].(*ExpressionStatement).Expression.(*MatchExpression)
+	original := program.Statements[3].(*ExpressionStatement).Expression.(*MatchExpression)
+	if match.Arms[0] != original.Arms[0] || match.Arms[1] != original.Arms[1] || match.Arms[2] == original.Arms[2] {
+		t.Errorf("wrong arms copied")
+	}
+
+	// Within the try expression, only the body holds an integer
+	try := rewritten.Statements[4].(*ExpressionStatement).Expression.(*TryExpression)
+	originalTry := program.Statements[4].(*ExpressionStatement).Expression.(*TryExpression)
+	if try.Body == originalTry.Body || try.Catch != originalTry.Catch || try.Parameter != originalTry.Parameter {
+		t.Errorf("wrong blocks copied")
+	}
+}
+
+func TestRewriteKeepsUnchangedTrees(t *testing.T) {
+	program := testProgram()
+	if rewritten := Rewrite(program, func(node Node) Node { return node }); rewritten != program {
+		t.Errorf("unchanged tree was copied")
+	}
+}
+
+func TestRewriteRemovesNodes(t *testing.T) {
+	program := testProgram()
+
+	// Drops the else branch, the integers, the hash, the match and try expressions and the return statement
+	rewritten := Rewrite(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *IfExpression:
+			n := *node
+			n.ElsePath = nil
+			return &n
+		case *IntegerLiteral, *ReturnStatement, *HashLiteral, *MatchExpression, *TryExpression:
+			return nil
+		}
+		return node
+	}).(*Program)
+
+	expected := "let f = fn(a) ;iftrue f()"
+	if rewritten.String() != expected {
+		t.Errorf("wrong rewritten program. expected=%q, got=%q", expected, rewritten.String())
+	}
+	if len(rewritten.Statements) != 5 {
+		t.Fatalf("wrong number of statements. got=%d", len(rewritten.Statements))
+	}
+	if es := rewritten.Statements[2].(*ExpressionStatement); es.Expression != nil {
+		t.Errorf("hash literal wasn't removed. got=%s", es.Expression)
+	}
+}
+
+func TestRewritePanicsOnMisplacedNodes(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "cannot replace the block") {
+			t.Errorf("wrong panic. got=%v", r)
+		}
+	}()
+
+	Rewrite(testProgram(), func(node Node) Node {
+		if _, ok := node.(*BlockStatement); ok {
+			return &Identifier{Value: "x"}
+		}
+		return node
+	})
+}
@@ -0,0 +1,658 @@
+// Package checker checks the types of YARTBML programs before they run.
+//
+// Type annotations are optional: `let x: int = 5;` and `fn(a: int, b: int) -> int { a + b; }`.
+// The types of unannotated expressions are inferred locally, from literals, operators and the
+// annotated or inferred types of the bindings they use. Whatever can't be inferred, like the
+// unannotated parameters of functions, is of type any and is never reported, so that unannotated
+// programs stay as dynamic as ever: the checker only reports what would fail at runtime anyway,
+// or what contradicts an annotation.
+//
+// Only contradicting an annotation is an error. What would fail at runtime is a warning,
+// since the code may never run, and isn't reported within the bodies of try expressions,
+// where the error it raises may be caught.
+package checker
+
+import (
+	"YARTBML/ast"
+	"YARTBML/diagnostic"
+	"YARTBML/evaluator"
+	"YARTBML/object"
+	"YARTBML/symbols"
+	"YARTBML/token"
+)
+
+// Code of the diagnostics reported by the checker
+const CODE = "type-error"
+
+// Types of the objects returned by the builtins, whose arguments aren't checked.
+// Builtins without a result type return ANY.
+var builtinResults = map[object.ObjectType]Type{
+	object.INTEGER_OBJ: INT,
+	object.STRING_OBJ:  STRING,
+	object.BOOLEAN_OBJ: BOOL,
+	object.NULL_OBJ:    NULL,
+}
+
+type checker struct {
+	symbols     *symbols.Table
+	diagnostics []diagnostic.Diagnostic
+
+	types       map[ast.Expression]Type
+	annotations map[ast.TypeNode]Type
+	bindings    map[*symbols.Binding]Type
+	inferring   map[*symbols.Binding]bool // Bindings whose type is being inferred
+
+	lets      map[*ast.Identifier]*ast.LetStatement         // Let statement binding each name
+	functions map[*ast.ReturnStatement]*ast.FunctionLiteral // Function left by each return statement
+	returns   map[*ast.FunctionLiteral][]*ast.ReturnStatement
+	tries     [][2]int // Offsets of the start and the end of the body of every try expression
+}
+
+// Checks the types of the program, returning the mismatches found.
+func Check(program *ast.Program) []diagnostic.Diagnostic {
+	c := &checker{
+		symbols:     symbols.Resolve(program),
+		diagnostics: []diagnostic.Diagnostic{},
+		types:       map[ast.Expression]Type{},
+		annotations: map[ast.TypeNode]Type{},
+		bindings:    map[*symbols.Binding]Type{},
+		inferring:   map[*symbols.Binding]bool{},
+		lets:        map[*ast.Identifier]*ast.LetStatement{},
+		functions:   map[*ast.ReturnStatement]*ast.FunctionLiteral{},
+		returns:     map[*ast.FunctionLiteral][]*ast.ReturnStatement{},
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil {
+				c.lets[node.Name] = node
+			}
+		case *ast.TryExpression:
+			// The body ends where the catch or the finally block starts
+			end := node.Finally
+			if node.Catch != nil {
+				end = node.Catch
+			}
+			if end != nil {
+				c.tries = append(c.tries, [2]int{node.Body.Token.Pos.Offset, end.Token.Pos.Offset})
+			}
+		case *ast.FunctionLiteral:
+			ast.Inspect(node.Body, func(n ast.Node) bool {
+				if ret, ok := n.(*ast.ReturnStatement); ok && c.functions[ret] == nil {
+					c.functions[ret] = node
+					c.returns[node] = append(c.returns[node], ret)
+				}
+				_, nested := n.(*ast.FunctionLiteral)
+				return !nested
+			})
+		}
+		return true
+	})
+
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+	diagnostic.Sort(c.diagnostics)
+	return c.diagnostics
+}
+
+// Reports an error located at the token, for what contradicts an annotation.
+func (c *checker) errorf(tok token.Token, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, diagnostic.Errorf(diagnostic.TokenSpan(tok), CODE, format, a...))
+}
+
+// Reports a warning located at the token, for what would fail at runtime.
+// Errors the evaluator would raise are located at the same token as at runtime.
+func (c *checker) warnf(tok token.Token, format string, a ...interface{}) {
+	for _, body := range c.tries {
+		if body[0] <= tok.Pos.Offset && tok.Pos.Offset < body[1] {
+			return
+		}
+	}
+	d := diagnostic.Errorf(diagnostic.TokenSpan(tok), CODE, format, a...)
+	d.Severity = diagnostic.WARNING
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+func (c *checker) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Pattern != nil {
+			c.destructuring(stmt)
+			return
+		}
+		// The value may refer to its own binding, which has no type until the value has one
+		b := c.symbols.BindingOf(stmt.Name)
+		c.inferring[b] = true
+		t := c.expression(stmt.Value)
+		delete(c.inferring, b)
+		if stmt.Type == nil {
+			return
+		}
+		if target := c.annotation(stmt.Type); !Assignable(t, target) {
+			c.errorf(ast.FirstToken(stmt.Value), "cannot assign %s to %s of type %s", t, stmt.Name.Value, target)
+		}
+	case *ast.ReturnStatement:
+		t := c.expression(stmt.ReturnValue)
+		fn := c.functions[stmt]
+		if fn == nil || fn.ReturnType == nil {
+			return
+		}
+		if result := c.annotation(fn.ReturnType); !Assignable(t, result) {
+			c.errorf(ast.FirstToken(stmt.ReturnValue), "cannot return %s from a function returning %s", t, result)
+		}
+	case *ast.ThrowStatement:
+		c.expression(stmt.Value)
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression)
+	}
+}
+
+// Checks the value of a destructuring let against its annotation and the kind of its pattern.
+// The names bound by the pattern are of type any.
+func (c *checker) destructuring(stmt *ast.LetStatement) {
+	t := c.expression(stmt.Value)
+	if stmt.Type != nil {
+		if target := c.annotation(stmt.Type); !Assignable(t, target) {
+			c.errorf(ast.FirstToken(stmt.Value), "cannot assign %s to %s of type %s", t, stmt.Pattern, target)
+			return
+		}
+	}
+
+	switch stmt.Pattern.(type) {
+	case *ast.ArrayPattern:
+		if _, ok := t.(*Array); !ok && t != ANY {
+			c.warnf(ast.FirstToken(stmt.Pattern), "cannot destructure: expected an array, got %s", t)
+		}
+	case *ast.HashPattern:
+		if _, ok := t.(*Hash); !ok && t != ANY {
+			c.warnf(ast.FirstToken(stmt.Pattern), "cannot destructure: expected a hash, got %s", t)
+		}
+	}
+}
+
+// Checks the statements of the block, returning the type of its value
+func (c *checker) block(block *ast.BlockStatement) Type {
+	if block == nil {
+		return ANY
+	}
+	for _, stmt := range block.Statements {
+		c.statement(stmt)
+	}
+
+	// The value of a block is the value of its last statement
+	if es, ok := lastStatement(block).(*ast.ExpressionStatement); ok {
+		return c.expression(es.Expression)
+	}
+	return ANY
+}
+
+// Returns the type of the annotation, reporting unknown type names
+func (c *checker) annotation(node ast.TypeNode) Type {
+	if t, ok := c.annotations[node]; ok {
+		return t
+	}
+
+	var t Type = ANY
+	switch node := node.(type) {
+	case *ast.NamedType:
+		if basic, ok := basics[node.Name]; ok {
+			t = basic
+		} else {
+			c.errorf(ast.FirstToken(node), "unknown type: %s", node.Name)
+		}
+	case *ast.ArrayType:
+		t = &Array{Element: c.annotation(node.Element)}
+	case *ast.HashType:
+		key := c.annotation(node.Key)
+		if !hashable(key) {
+			c.errorf(ast.FirstToken(node.Key), "unusable as hash key: %s", key)
+		}
+		t = &Hash{Key: key, Value: c.annotation(node.Value)}
+	case *ast.FunctionType:
+		params := []Type{}
+		for _, param := range node.Parameters {
+			params = append(params, c.annotation(param))
+		}
+		t = &Function{Parameters: params, Result: c.annotation(node.Result)}
+	}
+
+	c.annotations[node] = t
+	return t
+}
+
+// Returns the type of the expression, checking it the first time around
+func (c *checker) expression(expr ast.Expression) Type {
+	if expr == nil {
+		return ANY
+	}
+	if t, ok := c.types[expr]; ok {
+		return t
+	}
+	t := c.infer(expr)
+	c.types[expr] = t
+	return t
+}
+
+func (c *checker) infer(expr ast.Expression) Type {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return INT
+	case *ast.StringLiteral:
+		return STRING
+	case *ast.TemplateLiteral:
+		// Any value can be embedded, as it's converted to text
+		for _, value := range expr.Values {
+			c.expression(value)
+		}
+		return STRING
+	case *ast.BooleanLiteral:
+		return BOOL
+	case *ast.Identifier:
+		return c.identifier(expr)
+	case *ast.PrefixExpression:
+		return c.prefix(expr)
+	case *ast.InfixExpression:
+		return c.infix(expr)
+	case *ast.IfExpression:
+		c.expression(expr.TestCondition)
+		then := c.block(expr.ThenPath)
+		if expr.ElsePath == nil {
+			return ANY
+		}
+		return join(then, c.block(expr.ElsePath))
+	case *ast.TryExpression:
+		// The caught error is of type any
+		t := c.block(expr.Body)
+		if expr.Catch != nil {
+			t = join(t, c.block(expr.Catch))
+		}
+		c.block(expr.Finally)
+		return t
+	case *ast.FunctionLiteral:
+		return c.function(expr)
+	case *ast.CallExpression:
+		return c.call(expr)
+	case *ast.SpreadExpression:
+		t := c.expression(expr.Value)
+		if _, ok := t.(*Array); !ok && t != ANY {
+			c.warnf(expr.Token, "spread operator not supported: %s", t)
+		}
+		return t
+	case *ast.ArrayLiteral:
+		var element Type
+		for _, el := range expr.Elements {
+			t := c.expression(el)
+			if element == nil {
+				element = t
+			} else {
+				element = join(element, t)
+			}
+		}
+		if element == nil {
+			element = ANY
+		}
+		return &Array{Element: element}
+	case *ast.HashLiteral:
+		var key, value Type
+		for _, k := range expr.Keys() {
+			kt, vt := c.expression(k), c.expression(expr.Pairs[k])
+			if !hashable(kt) {
+				c.warnf(ast.FirstToken(k), "unusable as hash key: %s", kt)
+			}
+			if key == nil {
+				key, value = kt, vt
+			} else {
+				key, value = join(key, kt), join(value, vt)
+			}
+		}
+		if key == nil {
+			key, value = ANY, ANY
+		}
+		return &Hash{Key: key, Value: value}
+	case *ast.IndexExpression:
+		return c.index(expr)
+	case *ast.SliceExpression:
+		return c.slice(expr)
+	case *ast.MatchExpression:
+		// Names bound by patterns are of type any
+		c.expression(expr.Value)
+		var result Type
+		for _, arm := range expr.Arms {
+			c.expression(arm.Guard)
+			t := c.expression(arm.Value)
+			if result == nil {
+				result = t
+			} else {
+				result = join(result, t)
+			}
+		}
+		if result == nil {
+			return ANY
+		}
+		return result
+	}
+	return ANY
+}
+
+// Returns the type of the binding the identifier refers to.
+// Only names bound once within their scope have a type, as the others may refer to either binding.
+func (c *checker) identifier(ident *ast.Identifier) Type {
+	b := c.symbols.BindingOf(ident)
+	if b == nil || !boundOnce(b) {
+		return ANY
+	}
+	if t, ok := c.bindings[b]; ok {
+		return t
+	}
+
+	var t Type = ANY
+	switch b.Kind {
+	case symbols.PARAMETER:
+		for i, param := range b.Function.Parameters {
+			if param == b.Name && b.Function.ParameterType(i) != nil {
+				t = c.annotation(b.Function.ParameterType(i))
+			}
+		}
+	case symbols.LET:
+		if let := c.lets[b.Name]; let != nil && let.Type != nil {
+			t = c.annotation(let.Type)
+			break
+		}
+		if c.inferring[b] {
+			// The value refers to its own binding, like recursive functions do
+			if fn, ok := b.Value.(*ast.FunctionLiteral); ok && fn.ReturnType != nil {
+				return c.signature(fn, c.annotation(fn.ReturnType))
+			}
+			return ANY
+		}
+		c.inferring[b] = true
+		t = c.expression(b.Value)
+		delete(c.inferring, b)
+	case symbols.FUNCTION:
+		fn := b.Function
+		if fn.ReturnType != nil {
+			t = c.signature(fn, c.annotation(fn.ReturnType))
+			break
+		}
+		if c.inferring[b] {
+			// The function calls itself while its type is being inferred
+			break
+		}
+		c.inferring[b] = true
+		t = c.expression(fn)
+		delete(c.inferring, b)
+	}
+
+	c.bindings[b] = t
+	return t
+}
+
+// Reports whether the binding is the only binding of its name within its scope
+func boundOnce(b *symbols.Binding) bool {
+	for _, other := range b.Scope.Bindings {
+		if other != b && other.Name.Value == b.Name.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *checker) prefix(expr *ast.PrefixExpression) Type {
+	right := c.expression(expr.Right)
+	switch expr.Operator {
+	case "!":
+		return BOOL
+	case "-":
+		if right != INT && right != ANY {
+			c.warnf(expr.Token, "unknown operator: -%s", right)
+			return ANY
+		}
+		return INT
+	}
+	return ANY
+}
+
+// Mirrors the rules the evaluator applies to the operands of infix operators
+func (c *checker) infix(expr *ast.InfixExpression) Type {
+	left, right := c.expression(expr.Left), c.expression(expr.Right)
+	operator := expr.Operator
+
+	switch operator {
+	case "==", "!=":
+		return BOOL
+	case "??":
+		if left == NULL {
+			return right
+		}
+		return join(left, right)
+	case "in":
+		return c.membership(expr, left, right)
+	}
+	if left == ANY || right == ANY {
+		switch operator {
+		case "<", ">":
+			return BOOL
+		}
+		return ANY
+	}
+
+	switch {
+	case left == INT && right == INT:
+		switch operator {
+		case "+", "-", "*", "/":
+			return INT
+		case "<", ">":
+			return BOOL
+		}
+	case !sameKind(left, right):
+		c.warnf(expr.Token, "type mismatch: %s %s %s", left, operator, right)
+		return ANY
+	case left == STRING && operator == "+":
+		return STRING
+	}
+	c.warnf(expr.Token, "unknown operator: %s %s %s", left, operator, right)
+	return ANY
+}
+
+// Membership tests are booleans, whenever the right operand supports them: `x in y`.
+// Sets are of type any.
+func (c *checker) membership(expr *ast.InfixExpression, left, right Type) Type {
+	switch right.(type) {
+	case *Array:
+		return BOOL
+	case *Hash:
+		if !hashable(left) {
+			c.warnf(expr.Token, "unusable as hash key: %s", left)
+			return ANY
+		}
+		return BOOL
+	}
+	switch {
+	case right == ANY:
+		return BOOL
+	case right == STRING && left != STRING && left != ANY:
+		c.warnf(expr.Token, "type mismatch: %s in %s", left, right)
+		return ANY
+	case right == STRING:
+		return BOOL
+	}
+	c.warnf(expr.Token, "unknown operator: %s in %s", left, right)
+	return ANY
+}
+
+// Returns the type of the function, checking its body.
+// The result of unannotated functions is inferred from their returns and the value of their body.
+func (c *checker) function(fn *ast.FunctionLiteral) Type {
+	for i, param := range fn.Parameters {
+		d := fn.Default(i)
+		if d == nil {
+			continue
+		}
+		t := c.expression(d)
+		if fn.ParameterType(i) == nil {
+			continue
+		}
+		if target := c.annotation(fn.ParameterType(i)); !Assignable(t, target) {
+			c.errorf(ast.FirstToken(d), "cannot assign %s to %s of type %s", t, param.Value, target)
+		}
+	}
+	body := c.block(fn.Body)
+
+	if fn.ReturnType != nil {
+		result := c.annotation(fn.ReturnType)
+		if last := lastStatement(fn.Body); last != nil && !Assignable(body, result) {
+			c.errorf(ast.FirstToken(last), "cannot return %s from a function returning %s", body, result)
+		}
+		return c.signature(fn, result)
+	}
+
+	// Functions ending with a return statement don't return the value of their body
+	results := []Type{}
+	if _, ok := lastStatement(fn.Body).(*ast.ReturnStatement); !ok && lastStatement(fn.Body) != nil {
+		results = append(results, body)
+	}
+	for _, ret := range c.returns[fn] {
+		results = append(results, c.expression(ret.ReturnValue))
+	}
+	if len(results) == 0 {
+		return c.signature(fn, ANY)
+	}
+	result := results[0]
+	for _, t := range results[1:] {
+		result = join(result, t)
+	}
+	return c.signature(fn, result)
+}
+
+// Returns the last statement of the block, or nil when the block is empty
+func lastStatement(block *ast.BlockStatement) ast.Statement {
+	if block == nil || len(block.Statements) == 0 {
+		return nil
+	}
+	return block.Statements[len(block.Statements)-1]
+}
+
+// Returns the type of the function with the given result, from the annotations of its parameters
+// The parameter of a variadic function collecting the remaining arguments is typed by the type of its elements.
+func (c *checker) signature(fn *ast.FunctionLiteral, result Type) *Function {
+	params := []Type{}
+	for i := range fn.Parameters {
+		var t Type = ANY
+		if annotation := fn.ParameterType(i); annotation != nil {
+			t = c.annotation(annotation)
+		}
+		if fn.Variadic && i == len(fn.Parameters)-1 {
+			if array, ok := t.(*Array); ok {
+				t = array.Element
+			} else {
+				t = ANY
+			}
+		}
+		params = append(params, t)
+	}
+	least, _ := fn.Arity()
+	if fn.Variadic {
+		least++
+	}
+	return &Function{Parameters: params, Optional: len(params) - least, Variadic: fn.Variadic, Result: result}
+}
+
+func (c *checker) call(call *ast.CallExpression) Type {
+	callee := c.expression(call.Function)
+	args := []Type{}
+	for _, arg := range call.Arguments {
+		args = append(args, c.expression(arg))
+	}
+
+	if ident, ok := call.Function.(*ast.Identifier); ok && c.symbols.BindingOf(ident) == nil {
+		if builtin, ok := evaluator.LookupBuiltin(ident.Value); ok {
+			if result, ok := builtinResults[builtin.Result]; ok {
+				return result
+			}
+		}
+		return ANY
+	}
+
+	switch fn := callee.(type) {
+	case *Function:
+		// Calls passing the wrong number of arguments are reported by the wrong-arity rule of the linter.
+		// The arguments following a spread one aren't known to go to any particular parameter.
+		for i, arg := range args {
+			if _, ok := call.Arguments[i].(*ast.SpreadExpression); ok {
+				break
+			}
+			if param := fn.Parameter(i); param != nil && !Assignable(arg, param) {
+				c.errorf(ast.FirstToken(call.Arguments[i]), "cannot use %s as %s in argument %d", arg, param, i+1)
+			}
+		}
+		return fn.Result
+	case *Basic:
+		if fn != ANY {
+			c.warnf(callToken(call), "not a function: %s", fn)
+		}
+	case *Array, *Hash:
+		c.warnf(callToken(call), "not a function: %s", fn)
+	}
+	return ANY
+}
+
+// Returns the token the evaluator locates errors raised by the call at: the name of named functions
+func callToken(call *ast.CallExpression) token.Token {
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		return ident.Token
+	}
+	return call.Token
+}
+
+// Mirrors the rules the evaluator applies to index expressions.
+// Indexing arrays and strings out of bounds and hashes with missing keys results in null,
+// so the elements are of type any.
+func (c *checker) index(expr *ast.IndexExpression) Type {
+	left, index := c.expression(expr.Left), c.expression(expr.Index)
+	if left == NULL && expr.Optional() {
+		return NULL
+	}
+
+	switch left := left.(type) {
+	case *Array:
+		if index == INT || index == ANY {
+			return ANY
+		}
+	case *Hash:
+		if !hashable(index) {
+			c.warnf(ast.FirstToken(expr.Index), "unusable as hash key: %s", index)
+			return ANY
+		}
+		return ANY
+	default:
+		if left == ANY {
+			return ANY
+		}
+		if left == STRING && (index == INT || index == ANY) {
+			return ANY
+		}
+	}
+	c.warnf(expr.Token, "index operator not supported: %s", left)
+	return ANY
+}
+
+// Slices of arrays are arrays of the same elements, and slices of strings are strings
+func (c *checker) slice(expr *ast.SliceExpression) Type {
+	left := c.expression(expr.Left)
+	for _, bound := range []ast.Expression{expr.Low, expr.High} {
+		if t := c.expression(bound); t != INT && t != ANY && t != NULL {
+			c.warnf(ast.FirstToken(bound), "slice bound must be int, got %s", t)
+		}
+	}
+	if left == NULL && expr.Optional() {
+		return NULL
+	}
+
+	if _, ok := left.(*Array); ok || left == STRING || left == ANY {
+		return left
+	}
+	c.warnf(expr.Token, "slice operator not supported: %s", left)
+	return ANY
+}
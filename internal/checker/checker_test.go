@@ -0,0 +1,226 @@
+package checker
+
+import (
+	"YARTBML/diagnostic"
+	"YARTBML/lexer"
+	"YARTBML/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Checks the input, returning its diagnostics as `line:column: message` joined with "|"
+func check(t *testing.T, input string) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	messages := []string{}
+	for _, d := range Check(program) {
+		if d.Code != CODE {
+			t.Errorf("wrong code. expected=%q, got=%q", CODE, d.Code)
+		}
+		messages = append(messages, d.String())
+	}
+	return strings.Join(messages, "|")
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Annotated bindings
+		{"let x: int = 5;", ""},
+		{`let x: int = "five";`, "1:14: cannot assign string to x of type int"},
+		{"let xs: [int] = [1, 2];", ""},
+		{"let xs: [int] = [];", ""},
+		{`let xs: [int] = [1, "2"];`, ""},
+		{`let xs: [string] = [1, 2];`, "1:20: cannot assign [int] to xs of type [string]"},
+		{`let h: {string: int} = {"a": 1};`, ""},
+		{`let h: {string: int} = {"a": true};`, "1:24: cannot assign {string: bool} to h of type {string: int}"},
+		{"let x: number = 5;", "1:8: unknown type: number"},
+		{"let h: {[int]: int} = {};", "1:9: unusable as hash key: [int]"},
+		{"let f: fn(int) -> int = fn(x: int) -> int { x; };", ""},
+		{"let f: fn(int) -> int = fn(x: string) -> int { 1; };", "1:25: cannot assign fn(string) -> int to f of type fn(int) -> int"},
+		{"let f: fn(int) -> int = fn(x) { x; };", ""},
+
+		// Operators mirror the evaluator
+		{`1 + "a";`, "1:3: type mismatch: int + string"},
+		{`"a" - "b";`, "1:5: unknown operator: string - string"},
+		{"true + false;", "1:6: unknown operator: bool + bool"},
+		{`-"a";`, "1:1: unknown operator: -string"},
+		{`1 == "a"; !5; "a" + "b";`, ""},
+		{`let n = 5; let s = "s"; n * s;`, "1:27: type mismatch: int * string"},
+		{`let b = 1 < 2; b + 1;`, "1:18: type mismatch: bool + int"},
+		{`let s = "a" + "b"; s + 1;`, "1:22: type mismatch: string + int"},
+		{`[1] + [2];`, "1:5: unknown operator: [int] + [int]"},
+		{"`${1} and ${[true]}` + \"!\";", ""},
+		{"`${1} and ${[true]}` + 1;", "1:22: type mismatch: string + int"},
+		{"`value: ${1 + \"a\"}`;", "1:13: type mismatch: int + string"},
+
+		// Functions
+		{"let add = fn(a: int, b: int) -> int { a + b; }; add(1, 2);", ""},
+		{`let add = fn(a: int, b: int) -> int { a + b; }; add(1, "2");`, "1:56: cannot use string as int in argument 2"},
+		{`let add = fn(a: int, b: int) -> int { a + b; }; add("1");`, "1:53: cannot use string as int in argument 1"},
+		{`let add = fn(a: int, b: int) -> int { a + b; }; add(1, 2) + "a";`, "1:59: type mismatch: int + string"},
+		{`let f = fn(a: string) -> int { a; };`, "1:32: cannot return string from a function returning int"},
+		{`let f = fn(a) -> int { if (a) { return "a"; }; 1; };`, "1:40: cannot return string from a function returning int"},
+		{`let f = fn(a: int) { a * 2; }; f(1) + "a";`, "1:37: type mismatch: int + string"},
+		{`let f = fn() { return 1; }; f() + "a";`, "1:33: type mismatch: int + string"},
+		{`let f = fn(a) { if (a) { return 1; }; "a"; }; f(1) + 1;`, ""},
+		{`let f = fn(a: string) { a - 1; };`, "1:27: type mismatch: string - int"},
+		{`5(1);`, "1:2: not a function: int"},
+		{`let fib = fn(n: int) -> int { if (n < 2) { n; } else { fib(n - 1) + fib(n - 2); }; }; fib("a");`,
+			"1:91: cannot use string as int in argument 1"},
+		{`let fib = fn(n) { if (n < 2) { n; } else { fib(n - 1) + fib(n - 2); }; }; fib(1) + "a";`, ""},
+		{`let f = fn fib(n: int) -> int { if (n < 2) { n; } else { fib(n - 1) + fib(n - 2); }; }; f(5) + 1;`, ""},
+		{`let f = fn fib(n: int) -> int { fib("a"); };`, "1:37: cannot use string as int in argument 1"},
+		{`let f = fn fib(n) { fib(n - 1) + "a"; };`, ""},
+		{"let apply = fn(f: fn(int) -> int, x: int) -> int { f(x); }; apply(fn(x) { x; }, 1);", ""},
+		{`let apply = fn(f: fn(int) -> int) -> int { f(1); }; apply(fn(x: string) -> int { 1; });`,
+			"1:59: cannot use fn(string) -> int as fn(int) -> int in argument 1"},
+
+		// Indexing
+		{`[1, 2][0] + 1;`, ""},
+		{`[1, 2][0] + "a";`, ""},
+		{`[1, 2]["a"];`, "1:7: index operator not supported: [int]"},
+		{`let h = {"a": 1}; h["a"] + "b";`, ""},
+		{`{"a": 1}[[1]];`, "1:10: unusable as hash key: [int]"},
+		{`{[1]: 1};`, "1:2: unusable as hash key: [int]"},
+		{`5[0];`, "1:2: index operator not supported: int"},
+		{`len("abc") + 1; len([1]) + "a";`, "1:26: type mismatch: int + string"},
+
+		// Builtins return the type of their result, or anything when it depends on the arguments
+		{`let x: string = now();`, "1:17: cannot assign int to x of type string"},
+		{`let x: int = readFile("a");`, "1:14: cannot assign string to x of type int"},
+		{`let x: int = puts(1);`, "1:14: cannot assign null to x of type int"},
+		{`let x: int = first([1]);`, ""},
+		{`let len = fn() { "a"; }; len() + 1;`, "1:32: type mismatch: string + int"},
+
+		// Names bound more than once, and unannotated parameters, may hold anything
+		{`let x = 1; let x = "a"; x + 1;`, ""},
+		{`let f = fn(x) { x + 1; }; f("a");`, ""},
+		{`let x = 1; let f = fn(x) { x + "a"; };`, ""},
+		{`let x = if (true) { 1; }; x + "a";`, ""},
+		{`let x = if (true) { 1; } else { "a"; }; x + 1;`, ""},
+		{`let x = if (true) { 1; } else { 2; }; x + "a";`, "1:41: type mismatch: int + string"},
+
+		// Match expressions
+		{`match (5) { 1 => "a", n => "b" } + 1;`, "1:34: type mismatch: string + int"},
+		{`match (5) { 1 => "a", n => n } + 1;`, ""},
+		{`match ([1]) { [x, ...xs] if "a" - 1 => xs, _ => [] };`, "1:33: type mismatch: string - int"},
+
+		// Default and rest parameters, spread arguments
+		{`let f = fn(a: int, b: int = 1) -> int { a + b; }; f(1); f(1, "a");`, "1:62: cannot use string as int in argument 2"},
+		{`let f = fn(a: int = "a") { a; };`, "1:21: cannot assign string to a of type int"},
+		{`let f = fn(a, ...xs: [int]) { xs; }; f(1, 2, "c");`, "1:46: cannot use string as int in argument 3"},
+		{`let f = fn(...xs: [int]) { len(xs); }; f(1, 2) + "a";`, "1:48: type mismatch: int + string"},
+		{`let f = fn(a: int, b: int) { a; }; f(...["a"], "b");`, ""},
+		{`let f = fn(a) { a; }; f(...5);`, "1:25: spread operator not supported: int"},
+		{"let apply = fn(f: fn(int) -> int) -> int { f(1); }; apply(fn(x, y = 1) { x; });", ""},
+		{"let apply = fn(f: fn(int) -> int) -> int { f(1); }; apply(fn(x, y) { x; });",
+			"1:59: cannot use fn(any, any) -> any as fn(int) -> int in argument 1"},
+		{"let apply = fn(f: fn(int) -> int) -> int { f(1); }; apply(fn(...xs) { 1; });",
+			"1:59: cannot use fn(...any) -> int as fn(int) -> int in argument 1"},
+		{"let f: fn(int, int) -> int = fn(a: int, b: int = 1) -> int { a; }; f(1, 2);", ""},
+		{"let g = fn(a, b = 1) { a; }; g + 1;", "1:32: type mismatch: fn(any, any?) -> any + int"},
+
+		// Try expressions and throw statements
+		{`try { 1; } catch (e) { 2; } + 1;`, ""},
+		{`try { 1; } catch (e) { "a"; } + 1;`, ""},
+		{`try { 1; } finally { "a"; } + "b";`, "1:29: type mismatch: int + string"},
+		{`try { 1 + "a"; } catch (e) { e["message"] + 1; } finally { -"b"; };`,
+			"1:60: unknown operator: -string"},
+		// The errors raised within the body may be caught, but not the ones contradicting annotations
+		{`let r = try { [1][0] + "x"; } catch (e) { e["kind"]; };`, ""},
+		{`try { -true; } catch (e) { 0; };`, ""},
+		{`try { -true; } finally { 0; };`, ""},
+		{`try { let x: int = "a"; } catch (e) { 0; };`, "1:20: cannot assign string to x of type int"},
+		{`throw 1 - "a";`, "1:9: type mismatch: int - string"},
+
+		// Null-safe indexing and defaults
+		{`let h = {"a": 1}; h?.a + 1; h?["a"] ?? 0;`, ""},
+		{`let people = [{"name": "a"}]; puts(people[0]?["address"]?["city"]);`, ""},
+		{`let h = {"a": {"b": 1}}; h["a"]?["b"] ?? 0; h?.c?.d;`, ""},
+		{`if (false) { 1; } ?? 2 + 1;`, ""},
+		{`if (false) { 1; } ?? "a" + 1;`, "1:26: type mismatch: string + int"},
+		{`(5 ?? "a") + 1;`, ""},
+		{`let xs = [1]; -(xs ?? [2]);`, "1:15: unknown operator: -[int]"},
+
+		// Strings and slices
+		{`"abc"[-1] + "d"; [1, 2, 3][1:][0] + 1; "abc"[:2] + "d";`, ""},
+		{`[1, 2][1:] + 1;`, "1:12: type mismatch: [int] + int"},
+		{`[1, 2]["a":];`, "1:8: slice bound must be int, got string"},
+		{`let h = {"a": 1}; h[0:1];`, "1:20: slice operator not supported: {string: int}"},
+
+		// Sets
+		{"let s = set(1, 2); 1 in s; (1 in s) + 1;", "1:37: type mismatch: bool + int"},
+		{"1 in 2;", "1:3: unknown operator: int in int"},
+
+		// Membership
+		{`(1 in [1]) + 1; "a" in {"a": 1}; "a" in "abc";`, "1:12: type mismatch: bool + int"},
+		{`[1] in {"a": 1};`, "1:5: unusable as hash key: [int]"},
+		{`1 in "abc";`, "1:3: type mismatch: int in string"},
+		{`let f = fn(x) { x in "abc"; }; [1] in [[1]];`, ""},
+
+		// Destructuring lets
+		{`let [a, b] = [1, 2]; let {"a": c} = {"a": 1}; a + "x"; c + "x";`, ""},
+		{"let [a, b] = 5;", "1:5: cannot destructure: expected an array, got int"},
+		{`let {"a": a} = [1];`, "1:5: cannot destructure: expected a hash, got [int]"},
+		{`let [a, b]: [int] = ["a"];`, "1:21: cannot assign [string] to [a, b] of type [int]"},
+		{`let f = fn(x) { x; }; let [a] = f(1);`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := check(t, tt.input); got != tt.expected {
+			t.Errorf("wrong diagnostics for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// Contradicting an annotation is an error, while what would fail at runtime is a warning,
+// since the code may never run
+func TestSeverities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected diagnostic.Severity
+	}{
+		{`let x: int = "five";`, diagnostic.ERROR},
+		{`let f = fn(a: int) -> int { a; }; f("a");`, diagnostic.ERROR},
+		{`let f = fn() { 1 + true; }; puts("never called");`, diagnostic.WARNING},
+		{`if (false) { 1 + "a"; }; puts("ok");`, diagnostic.WARNING},
+		{`5(1);`, diagnostic.WARNING},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		diagnostics := Check(p.ParseProgram())
+		if len(diagnostics) != 1 {
+			t.Fatalf("wrong number of diagnostics for %q. got=%v", tt.input, diagnostics)
+		}
+		if diagnostics[0].Severity != tt.expected {
+			t.Errorf("wrong severity for %q. expected=%v, got=%v", tt.input, tt.expected, diagnostics[0].Severity)
+		}
+	}
+}
+
+func TestExamplesHaveNoTypeErrors(t *testing.T) {
+	examples, err := filepath.Glob("../../examples/*.ybml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, example := range examples {
+		source, err := os.ReadFile(example)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := check(t, string(source)); got != "" {
+			t.Errorf("unexpected diagnostics for %s: %s", example, got)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package checker
+
+import "strings"
+
+// Type of the values an expression may evaluate to
+type Type interface {
+	String() string
+}
+
+// Type given by its name
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	INT    = &Basic{Name: "int"}
+	STRING = &Basic{Name: "string"}
+	BOOL   = &Basic{Name: "bool"}
+	NULL   = &Basic{Name: "null"}
+
+	// Type of the values the checker knows nothing about, which are never reported
+	ANY = &Basic{Name: "any"}
+)
+
+// Named types, as written in annotations
+var basics = map[string]*Basic{
+	"int":    INT,
+	"string": STRING,
+	"bool":   BOOL,
+	"null":   NULL,
+	"any":    ANY,
+}
+
+// Type of arrays holding elements of the same type
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+// Type of hashes with keys and values of the same types
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+// Type of functions.
+// The last Optional parameters may be omitted, and the last parameter of a variadic function
+// takes any number of arguments of its type.
+type Function struct {
+	Parameters []Type
+	Optional   int
+	Variadic   bool
+	Result     Type
+}
+
+func (f *Function) String() string {
+	params := []string{}
+	for i, p := range f.Parameters {
+		switch {
+		case f.Variadic && i == len(f.Parameters)-1:
+			params = append(params, "..."+p.String())
+		case i >= f.required():
+			params = append(params, p.String()+"?")
+		default:
+			params = append(params, p.String())
+		}
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Result.String()
+}
+
+// Returns the type of the parameter taking the i-th argument, or nil when there is none
+func (f *Function) Parameter(i int) Type {
+	if f.Variadic && i >= len(f.Parameters)-1 {
+		return f.Parameters[len(f.Parameters)-1]
+	}
+	if i < len(f.Parameters) {
+		return f.Parameters[i]
+	}
+	return nil
+}
+
+// Returns the number of parameters that may not be omitted
+func (f *Function) required() int {
+	n := len(f.Parameters) - f.Optional
+	if f.Variadic {
+		n--
+	}
+	return n
+}
+
+// Reports whether values of type t may be used where values of type target are expected.
+// Values of type any may be used anywhere, and anything may be used as any.
+func Assignable(t, target Type) bool {
+	if t == ANY || target == ANY {
+		return true
+	}
+
+	switch target := target.(type) {
+	case *Array:
+		a, ok := t.(*Array)
+		return ok && Assignable(a.Element, target.Element)
+	case *Hash:
+		h, ok := t.(*Hash)
+		return ok && Assignable(h.Key, target.Key) && Assignable(h.Value, target.Value)
+	case *Function:
+		// The function must accept every call the target accepts
+		f, ok := t.(*Function)
+		if !ok || f.Variadic != target.Variadic || f.required() > target.required() {
+			return false
+		}
+		if (f.Variadic && len(f.Parameters) != len(target.Parameters)) || len(f.Parameters) < len(target.Parameters) {
+			return false
+		}
+		for i, param := range target.Parameters {
+			if !Assignable(param, f.Parameters[i]) {
+				return false
+			}
+		}
+		return Assignable(f.Result, target.Result)
+	}
+	return t == target
+}
+
+// Returns the type of values of either type: the type itself when both are the same, any otherwise
+func join(a, b Type) Type {
+	if Assignable(a, b) && Assignable(b, a) && a != ANY && b != ANY {
+		return a
+	}
+	return ANY
+}
+
+// Reports whether both types are of the same kind, like two arrays or two integers,
+// which is what the evaluator compares when applying operators
+func sameKind(a, b Type) bool {
+	switch a.(type) {
+	case *Array:
+		_, ok := b.(*Array)
+		return ok
+	case *Hash:
+		_, ok := b.(*Hash)
+		return ok
+	case *Function:
+		_, ok := b.(*Function)
+		return ok
+	}
+	return a == b
+}
+
+// Reports whether values of the type can be used as hash keys
+func hashable(t Type) bool {
+	return t == INT || t == STRING || t == BOOL || t == ANY
+}
@@ -0,0 +1,162 @@
+// Package diagnostic provides a structured representation of the problems found within YARTBML programs.
+// The lexer, the parser and the evaluator all report their errors as diagnostics, which can either be
+// rendered for humans, printing the offending source line with a caret underline, or encoded as JSON
+// for editors and other tools.
+package diagnostic
+
+import (
+	"YARTBML/token"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Severity of a diagnostic
+type Severity string
+
+const (
+	ERROR   Severity = "error"
+	WARNING Severity = "warning"
+	INFO    Severity = "info"
+	HINT    Severity = "hint"
+)
+
+// Span of source code a diagnostic refers to.
+// Start is the position of the first character, End is the position right after the last character.
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+// Returns the span covering the given token.
+func TokenSpan(tok token.Token) Span {
+	return Span{Start: tok.Pos, End: tok.End}
+}
+
+// Note related to a diagnostic, pointing at another piece of source code
+// e.g. the opening parenthesis of a missing closing parenthesis.
+type Note struct {
+	Message string `json:"message"`
+	Span    Span   `json:"span"`
+}
+
+// Diagnostic describes a single problem found within a program.
+// Code is a short stable identifier of the kind of problem, e.g. `unexpected-token`.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Span     Span     `json:"span"`
+	Related  []Note   `json:"related,omitempty"`
+}
+
+// Creates an error diagnostic with the given code and formatted message.
+func Errorf(span Span, code string, format string, a ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: ERROR,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     span,
+	}
+}
+
+// Formats the diagnostic as `line:column: message`.
+func (d Diagnostic) String() string {
+	return d.Span.Start.String() + ": " + d.Message
+}
+
+// Sorts diagnostics by their position in the source, keeping the order of diagnostics at the same position.
+func Sort(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Span.Start.Offset < diagnostics[j].Span.Start.Offset
+	})
+}
+
+// Reports whether any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes every diagnostic for humans, followed by the offending source line with a caret underline.
+//
+//	add.ybml:1:17: error[unexpected-token]: expected next token to be ), got ; instead
+//	    1 | let x = add(1, 2;
+//	      |                 ^
+//	add.ybml:1:12: note: unclosed ( opened here
+//	    1 | let x = add(1, 2;
+//	      |            ^
+//
+// The filename is omitted from the locations when it's empty.
+func Render(out io.Writer, filename, source string, diagnostics []Diagnostic) {
+	lines := strings.Split(source, "\n")
+
+	for _, d := range diagnostics {
+		fmt.Fprintf(out, "%s: %s[%s]: %s\n", location(filename, d.Span), d.Severity, d.Code, d.Message)
+		renderSnippet(out, lines, d.Span)
+
+		for _, note := range d.Related {
+			fmt.Fprintf(out, "%s: note: %s\n", location(filename, note.Span), note.Message)
+			renderSnippet(out, lines, note.Span)
+		}
+	}
+}
+
+// Returns the location of the span as `filename:line:column`
+func location(filename string, span Span) string {
+	if filename == "" {
+		return span.Start.String()
+	}
+	return filename + ":" + span.Start.String()
+}
+
+// Writes the source line the span starts on, underlined with carets from the start of the span
+// up to its end, or the end of the line when the span covers several lines.
+func renderSnippet(out io.Writer, lines []string, span Span) {
+	if span.Start.Line < 1 || span.Start.Line > len(lines) {
+		return
+	}
+	line := strings.TrimSuffix(lines[span.Start.Line-1], "\r")
+
+	start := span.Start.Column - 1
+	if start > len(line) {
+		start = len(line)
+	}
+	end := len(line)
+	if span.End.Line == span.Start.Line && span.End.Column-1 < end {
+		end = span.End.Column - 1
+	}
+
+	// Keep tabs in the padding so that the carets line up with the source line
+	var padding strings.Builder
+	for _, ch := range line[:start] {
+		if ch == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+	carets := strings.Repeat("^", max(end-start, 1))
+
+	gutter := fmt.Sprintf("%5d", span.Start.Line)
+	fmt.Fprintf(out, "%s | %s\n", gutter, line)
+	fmt.Fprintf(out, "%s | %s%s\n", strings.Repeat(" ", len(gutter)), padding.String(), carets)
+}
+
+// Writes the diagnostics as a JSON array, for editors and other tools.
+// An empty list is written as `[]`.
+func WriteJSON(out io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
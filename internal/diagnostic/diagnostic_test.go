@@ -0,0 +1,114 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"YARTBML/token"
+)
+
+func span(line, startCol, endCol int) Span {
+	return Span{
+		Start: token.Position{Line: line, Column: startCol},
+		End:   token.Position{Line: line, Column: endCol},
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "let x = add(1, 2;\n\tlet y = x +;"
+	diagnostics := []Diagnostic{
+		{
+			Severity: ERROR,
+			Code:     "unexpected-token",
+			Message:  "expected next token to be ), got ; instead",
+			Span:     span(1, 17, 18),
+			Related:  []Note{{Message: "unclosed ( opened here", Span: span(1, 12, 13)}},
+		},
+		{
+			Severity: WARNING,
+			Code:     "unused-binding",
+			Message:  "y is never used",
+			Span:     span(2, 6, 7),
+		},
+		{
+			Severity: ERROR,
+			Code:     "expected-expression",
+			Message:  "no prefix parse function for ; found",
+			Span:     Span{Start: token.Position{Line: 2, Column: 13}, End: token.Position{Line: 3, Column: 1}},
+		},
+	}
+
+	expected := `add.ybml:1:17: error[unexpected-token]: expected next token to be ), got ; instead
+    1 | let x = add(1, 2;
+      |                 ^
+add.ybml:1:12: note: unclosed ( opened here
+    1 | let x = add(1, 2;
+      |            ^
+add.ybml:2:6: warning[unused-binding]: y is never used
+    2 | 	let y = x +;
+      | 	    ^
+add.ybml:2:13: error[expected-expression]: no prefix parse function for ; found
+    2 | 	let y = x +;
+      | 	           ^
+`
+
+	var out bytes.Buffer
+	Render(&out, "add.ybml", source, diagnostics)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRenderWithoutFilename(t *testing.T) {
+	var out bytes.Buffer
+	Render(&out, "", "len(1, 2);", []Diagnostic{Errorf(span(1, 1, 4), "runtime-error", "wrong number of arguments. got=%d, want=1", 2)})
+
+	expected := "1:1: error[runtime-error]: wrong number of arguments. got=2, want=1\n" +
+		"    1 | len(1, 2);\n" +
+		"      | ^^^\n"
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJSON(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("empty diagnostics not written as an empty array. got=%q", out.String())
+	}
+
+	original := []Diagnostic{{
+		Severity: ERROR,
+		Code:     "unexpected-token",
+		Message:  "expected next token to be ), got ; instead",
+		Span:     span(1, 17, 18),
+		Related:  []Note{{Message: "unclosed ( opened here", Span: span(1, 12, 13)}},
+	}}
+
+	out.Reset()
+	if err := WriteJSON(&out, original); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []Diagnostic
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("could not decode JSON output: %s", err)
+	}
+	if len(decoded) != 1 || decoded[0].Code != "unexpected-token" ||
+		decoded[0].Span != original[0].Span || decoded[0].Related[0].Span != original[0].Related[0].Span {
+		t.Errorf("JSON round-trip lost information. got=%+v", decoded)
+	}
+
+	var fields []map[string]interface{}
+	json.Unmarshal(out.Bytes(), &fields)
+	for _, key := range []string{"severity", "code", "message", "span", "related"} {
+		if _, ok := fields[0][key]; !ok {
+			t.Errorf("JSON output is missing the %q field", key)
+		}
+	}
+}
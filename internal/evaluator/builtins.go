@@ -3,16 +3,42 @@ package evaluator
 import (
 	"YARTBML/object"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// Returns the names of every builtin function in sorted order
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the builtin function with the given name
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
 // Builtins maps built-in function names to their corresponding implementation
 // Each built-in function is an instance of 'object.Builtin' which includes a function definition
 var builtins = map[string]*object.Builtin{
 
-	// 'len' returns the length of an array or string
-	// Expects exactly one argument and returns an error if provided argument is not an array or string
+	// 'len' returns the length of an array or string, or the number of elements of a set
+	// Expects exactly one argument and returns an error if provided argument is not an array, string or set
 	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Name:   "len",
+		Arity:  1,
+		Result: object.INTEGER_OBJ,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -20,9 +46,12 @@ var builtins = map[string]*object.Builtin{
 
 			switch arg := args[0].(type) {
 			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
+				return &object.Integer{Value: int64(arg.Len())}
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				// Strings are measured in characters rather than in bytes
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *object.Set:
+				return &object.Integer{Value: int64(arg.Len())}
 			default:
 				return newError("argument to `len` not supported, got %s",
 					args[0].Type())
@@ -34,7 +63,9 @@ var builtins = map[string]*object.Builtin{
 	// 'first' retrieves the first element of an array
 	// Expects exactly one array argument and returns the first element or NULL if array is empty
 	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Name:  "first",
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -45,8 +76,8 @@ var builtins = map[string]*object.Builtin{
 			}
 
 			arr := args[0].(*object.Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
+			if arr.Len() > 0 {
+				return arr.At(0)
 			}
 
 			return NULL
@@ -56,7 +87,9 @@ var builtins = map[string]*object.Builtin{
 	// 'last' retrieves the last element of an array
 	// Expects exactly one array argument and returns the last element or NUll if array is empty
 	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Name:  "last",
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -67,18 +100,20 @@ var builtins = map[string]*object.Builtin{
 			}
 
 			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
+			length := arr.Len()
 			if length > 0 {
-				return arr.Elements[length-1]
+				return arr.At(length - 1)
 			}
 			return NULL
 		},
 	},
 
-	// 'rest' retrieves all but the first element of an array, returning a new array
+	// 'rest' retrieves all but the first element of an array, returning a new array sharing them with the original
 	// Expects exactly one array argument and returns a new array or Null is original array is empty
 	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Name:  "rest",
+		Arity: 1,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -89,21 +124,21 @@ var builtins = map[string]*object.Builtin{
 			}
 
 			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
+			length := arr.Len()
 			if length > 0 {
-				newElements := make([]object.Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
-				return &object.Array{Elements: newElements}
+				return arr.Slice(1, length)
 			}
 
 			return NULL
 		},
 	},
 
-	// 'push' adds an element to the end of an array and returns the new array
+	// 'push' adds an element to the end of an array and returns the new array, leaving the original as it was
 	// expects exactly two arguments: an array and the element to add
 	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Name:  "push",
+		Arity: 2,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",
 					len(args))
@@ -114,24 +149,273 @@ var builtins = map[string]*object.Builtin{
 			}
 
 			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-
-			return &object.Array{Elements: newElements}
+			return arr.Push(args[1])
 		},
 	},
 
 	// 'puts' displays an element to stdout (prints to console)
+	// Output is written to the sandbox's stdout and requires the stdout capability
 	"puts": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Name:       "puts",
+		Arity:      object.VARIADIC,
+		Result:     object.NULL_OBJ,
+		Capability: object.STDOUT_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(env.Sandbox().Stdout, arg.Inspect())
+			}
+
+			return NULL
+		},
+	},
+
+	// 'print' displays its arguments to stdout without a trailing newline
+	// Requires the stdout capability
+	"print": &object.Builtin{
+		Name:       "print",
+		Arity:      object.VARIADIC,
+		Result:     object.NULL_OBJ,
+		Capability: object.STDOUT_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprint(env.Sandbox().Stdout, arg.Inspect())
 			}
 
 			return NULL
 		},
 	},
+
+	// 'eprint' displays each element on its own line to stderr
+	// Requires the stderr capability
+	"eprint": &object.Builtin{
+		Name:       "eprint",
+		Arity:      object.VARIADIC,
+		Result:     object.NULL_OBJ,
+		Capability: object.STDERR_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(env.Sandbox().Stderr, arg.Inspect())
+			}
+
+			return NULL
+		},
+	},
+
+	// 'readLine' reads a line from stdin, without its line terminator
+	// Returns NULL once stdin has been exhausted and requires the stdin capability
+	"readLine": &object.Builtin{
+		Name:       "readLine",
+		Arity:      0,
+		Capability: object.STDIN_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			line, err := env.Sandbox().Stdin.ReadString('\n')
+			if err != nil && line == "" {
+				if err == io.EOF {
+					return NULL
+				}
+				return newError("could not read line: %s", err)
+			}
+
+			line = strings.TrimSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\r")
+			return &object.String{Value: line}
+		},
+	},
+
+	// 'readFile' reads the contents of the file at the given path and returns them as a string
+	// Requires the filesystem capability
+	"readFile": &object.Builtin{
+		Name:       "readFile",
+		Arity:      1,
+		Result:     object.STRING_OBJ,
+		Capability: object.FILESYSTEM_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ {
+				return newError("argument to `readFile` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			contents, err := os.ReadFile(args[0].(*object.String).Value)
+			if err != nil {
+				return newError("could not read file: %s", err)
+			}
+
+			return &object.String{Value: string(contents)}
+		},
+	},
+
+	// 'writeFile' writes the given string into the file at the given path, replacing its contents
+	// Requires the filesystem capability
+	"writeFile": &object.Builtin{
+		Name:       "writeFile",
+		Arity:      2,
+		Result:     object.NULL_OBJ,
+		Capability: object.FILESYSTEM_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ || args[1].Type() != object.STRING_OBJ {
+				return newError("arguments to `writeFile` must be STRING, got %s and %s",
+					args[0].Type(), args[1].Type())
+			}
+
+			path := args[0].(*object.String).Value
+			contents := args[1].(*object.String).Value
+			if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+				return newError("could not write file: %s", err)
+			}
+
+			return NULL
+		},
+	},
+
+	// 'getEnv' returns the value of the environment variable or NULL when it is not set
+	// Requires the env capability
+	"getEnv": &object.Builtin{
+		Name:       "getEnv",
+		Arity:      1,
+		Capability: object.ENV_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ {
+				return newError("argument to `getEnv` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			value, ok := os.LookupEnv(args[0].(*object.String).Value)
+			if !ok {
+				return NULL
+			}
+
+			return &object.String{Value: value}
+		},
+	},
+
+	// 'error' creates an error value with the given message, and kind when given, which may be thrown later on
+	// Errors created without a kind are of the "error" kind, like the values thrown as they are
+	"error": &object.Builtin{
+		Name:  "error",
+		Arity: object.VARIADIC,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			for _, arg := range args {
+				if arg.Type() != object.STRING_OBJ {
+					return newError("arguments to `error` must be STRING, got %s",
+						arg.Type())
+				}
+			}
+
+			err := &object.Error{Message: args[0].(*object.String).Value, Kind: object.THROWN_ERROR}
+			if len(args) == 2 {
+				err.Kind = args[1].(*object.String).Value
+			}
+			return &object.ErrorValue{Error: err}
+		},
+	},
+
+	// 'set' creates a set holding its arguments, which must be hashable
+	// Spreading an array gives the set of its elements: set(...xs)
+	"set": &object.Builtin{
+		Name:  "set",
+		Arity: object.VARIADIC,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			return newSet(args)
+		},
+	},
+
+	// 'union' returns the set of the elements of either set
+	"union": setBuiltin("union", func(a, b *object.Set) *object.Set {
+		if a.Len() < b.Len() {
+			a, b = b, a
+		}
+		for _, el := range b.Elements() {
+			a = a.Add(el.(object.Hashable))
+		}
+		return a
+	}),
+
+	// 'intersection' returns the set of the elements of both sets
+	"intersection": setBuiltin("intersection", func(a, b *object.Set) *object.Set {
+		if a.Len() > b.Len() {
+			a, b = b, a
+		}
+		result := &object.Set{}
+		for _, el := range a.Elements() {
+			if b.Has(el.(object.Hashable)) {
+				result = result.Add(el.(object.Hashable))
+			}
+		}
+		return result
+	}),
+
+	// 'difference' returns the set of the elements of the first set missing from the second one
+	"difference": setBuiltin("difference", func(a, b *object.Set) *object.Set {
+		result := &object.Set{}
+		for _, el := range a.Elements() {
+			if !b.Has(el.(object.Hashable)) {
+				result = result.Add(el.(object.Hashable))
+			}
+		}
+		return result
+	}),
+
+	// 'now' returns the current unix time in milliseconds
+	// Requires the time capability
+	"now": &object.Builtin{
+		Name:       "now",
+		Arity:      0,
+		Result:     object.INTEGER_OBJ,
+		Capability: object.TIME_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			return &object.Integer{Value: time.Now().UnixMilli()}
+		},
+	},
+
+	// 'random' returns a random integer within [0, n)
+	// Requires the random capability
+	"random": &object.Builtin{
+		Name:       "random",
+		Arity:      1,
+		Result:     object.INTEGER_OBJ,
+		Capability: object.RANDOM_CAP,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != object.INTEGER_OBJ {
+				return newError("argument to `random` must be INTEGER, got %s",
+					args[0].Type())
+			}
+
+			n := args[0].(*object.Integer).Value
+			if n <= 0 {
+				return newError("argument to `random` must be positive, got %d", n)
+			}
+
+			return &object.Integer{Value: rand.Int63n(n)}
+		},
+	},
 }
@@ -0,0 +1,62 @@
+package evaluator
+
+import (
+	"YARTBML/ast"
+	"YARTBML/object"
+)
+
+// Raises the value as an error.
+// Error values are raised again as they are, keeping the message, kind, location and stack they had,
+// while other values are raised with their text as the message.
+func throw(value object.Object) object.Object {
+	switch value := value.(type) {
+	case *object.ErrorValue:
+		err := *value.Error
+		err.Stack = append([]object.Frame{}, value.Error.Stack...)
+		return &err
+	case *object.String:
+		return &object.Error{Message: value.Value, Kind: object.THROWN_ERROR}
+	default:
+		return &object.Error{Message: value.Inspect(), Kind: object.THROWN_ERROR}
+	}
+}
+
+// Evaluates the try block, then the catch block with the caught error bound to its parameter
+// when the try block raised an error, then the finally block.
+// Evaluates to the value of the last block among the try and catch blocks, unless the finally
+// block raises an error or returns, which takes precedence.
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Body, env)
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		env.Bind(node.Parameter.Slot, &object.ErrorValue{Error: err})
+		result = Eval(node.Catch, env)
+	}
+
+	if node.Finally != nil {
+		final := Eval(node.Finally, env)
+		if isError(final) || (final != nil && final.Type() == object.RETURN_VALUE_OBJ) {
+			return final
+		}
+	}
+
+	return result
+}
+
+// Returns the field of the error value with the given name, or NULL when there is none.
+// The stack is an array describing every call the error went through, innermost first.
+func evalErrorField(value *object.ErrorValue, field *object.String) object.Object {
+	switch field.Value {
+	case "message":
+		return &object.String{Value: value.Error.Message}
+	case "kind":
+		return &object.String{Value: value.Error.Kind}
+	case "stack":
+		frames := []object.Object{}
+		for _, frame := range value.Error.Stack {
+			frames = append(frames, &object.String{Value: frame.String()})
+		}
+		return object.NewArray(frames)
+	}
+	return NULL
+}
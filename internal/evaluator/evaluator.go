@@ -4,13 +4,25 @@ package evaluator
 
 import (
 	"YARTBML/ast"
+	"YARTBML/diagnostic"
 	"YARTBML/object"
+	"YARTBML/token"
 	"fmt"
+	"strings"
 )
 
 // Creates error objects with given message
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: object.RUNTIME_ERROR}
+}
+
+// Locates errors raised while evaluating an expression at the expression's token.
+// Errors that were already located by a nested expression keep their more precise span.
+func withSpan(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Span == (diagnostic.Span{}) {
+		err.Span = diagnostic.TokenSpan(tok)
+	}
+	return obj
 }
 
 // References to true and false objects
@@ -27,12 +39,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
+		if diagnostics := Resolve(node, env); len(diagnostics) != 0 {
+			return &object.Error{Message: diagnostics[0].Message, Kind: object.RUNTIME_ERROR, Span: diagnostics[0].Span}
+		}
 		return evalProgram(node, env)
 
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
+		if fn := node.Declaration(); fn != nil {
+			// The name is bound within the enclosing environment rather than within every call
+			function := newFunction(fn, env)
+			function.Self = nil
+			env.Bind(fn.Name.Slot, function)
+			return function
+		}
 		return Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
@@ -42,12 +64,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return withSpan(throw(val), node.Token)
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil {
+			return withSpan(evalDestructuring(node.Pattern, val, env), ast.FirstToken(node.Pattern))
+		}
+		env.Bind(node.Name.Slot, val)
 
 	// Expressions
 	case *ast.IntegerLiteral:
@@ -56,6 +88,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
+
 	case *ast.BooleanLiteral:
 		return nativeBoolToBooleanObject(node.Value)
 
@@ -64,61 +99,99 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withSpan(evalPrefixExpression(node.Operator, right), node.Token)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		// The default is only evaluated when the value is null
+		if node.Operator == "??" && left != NULL {
+			return left
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return withSpan(evalInfixExpression(node.Operator, left, right), node.Token)
 
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return withSpan(evalIdentifier(node, env), node.Token)
 
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return newFunction(node, env)
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := evalArguments(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return withSpan(applyFunction(function, args, env, callToken(node)), callToken(node))
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return object.NewArray(elements)
 
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if left == NULL && node.Optional() {
+			return NULL
+		}
 		index := Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return withSpan(evalIndexExpression(left, index), node.Token)
+
+	case *ast.SliceExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		if left == NULL && node.Optional() {
+			return NULL
+		}
+		low, high := object.Object(NULL), object.Object(NULL)
+		if node.Low != nil {
+			low = Eval(node.Low, env)
+			if isError(low) {
+				return low
+			}
+		}
+		if node.High != nil {
+			high = Eval(node.High, env)
+			if isError(high) {
+				return high
+			}
+		}
+		return withSpan(evalSliceExpression(left, low, high), node.Token)
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return withSpan(evalHashLiteral(node, env), node.Token)
+
+	case *ast.MatchExpression:
+		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		return withSpan(evalMatchExpression(node, value, env), node.Token)
 	}
 
 	return nil
@@ -174,6 +247,11 @@ func evalInfixExpression(
 	left, right object.Object,
 ) object.Object {
 	switch {
+	case operator == "??":
+		// Reached when the value is null, as its default is only evaluated then
+		return right
+	case operator == "in":
+		return evalInExpression(left, right)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 	case operator == "==":
@@ -291,17 +369,19 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-// Returns the value of an identifier stored in an enviornment
+// Returns the value of an identifier stored in the slot it was resolved to,
+// or the builtin function it names
+// Bindings made within an if expression whose branch wasn't taken are not found
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
 ) object.Object {
-	if val, ok := env.Get(node.Value); ok {
-		return val
+	if node.Slot < 0 {
+		return builtins[node.Value]
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
+	if val, ok := env.Lookup(node.Depth, node.Slot); ok {
+		return val
 	}
 
 	return newError("identifier not found: " + node.Value)
@@ -325,60 +405,134 @@ func evalExpressions(
 	return result
 }
 
+// Evaluates the arguments of a call, spreading the elements of the arrays and sets preceded by `...`
+func evalArguments(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, e := range exps {
+		spread, isSpread := e.(*ast.SpreadExpression)
+		if isSpread {
+			e = spread.Value
+		}
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		if !isSpread {
+			result = append(result, evaluated)
+			continue
+		}
+		switch value := evaluated.(type) {
+		case *object.Array:
+			result = append(result, value.Elements()...)
+		case *object.Set:
+			result = append(result, value.Elements()...)
+		default:
+			return []object.Object{withSpan(newError("spread operator not supported: %s", evaluated.Type()), spread.Token)}
+		}
+	}
+	return result
+}
+
 // Checks that we have a function
 // Creates a new environment with function object and args,
 // then evaluates the function body.
+// Builtins are only invoked when the sandbox of the calling environment grants their capability.
+// Errors raised within the function record the call, located at the given token, in their stack.
 // Returns result of the function call
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment, call token.Token) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		if len(fn.Parameters) != len(args) {
+		if least, most := ast.Arity(len(fn.Parameters), fn.Defaults, fn.Variadic); len(args) < least || (most >= 0 && len(args) > most) {
 			return newError(
-				"wrong number of arguments. want=%d. got=%d",
-				len(fn.Parameters),
+				"wrong number of arguments. want=%s. got=%d",
+				arity(least, most),
 				len(args))
 		}
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		extendedEnv, evaluated := extendFunctionEnv(fn, args)
+		if evaluated == nil {
+			evaluated = unwrapReturnValue(Eval(fn.Body, extendedEnv))
+		}
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Stack = append(err.Stack, object.Frame{Function: fn.Name, Span: diagnostic.TokenSpan(call)})
+		}
+		return evaluated
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if !env.Sandbox().Allows(fn.Capability) {
+			return newError("permission denied: %s requires the %s capability",
+				fn.Name, fn.Capability)
+		}
+		return fn.Fn(env, args...)
 
 	default:
-		return newError("not a functionL %s", fn.Type())
+		return newError("not a function: %s", fn.Type())
 	}
+}
 
-	// function, ok := fn.(*object.Function)
-	// if !ok {
-	// 	return newError("not a function: %s", fn.Type())
-	// }
-	// if len(function.Parameters) != len(args) {
-	// 	return newError(
-	// 		"wrong number of arguments. want=%d. got=%d",
-	// 		len(function.Parameters),
-	// 		len(args))
-	// }
-
-	// extendedEnv := extendFunctionEnv(function, args)
-	// evaluated := Eval(function.Body, extendedEnv)
-	// return unwrapReturnValue(evaluated)
+// Returns the closure of the function over the environment it is defined in
+func newFunction(node *ast.FunctionLiteral, env *object.Environment) *object.Function {
+	return &object.Function{Name: node.DisplayName(), Self: node.Name,
+		Parameters: node.Parameters, Defaults: node.Defaults, Variadic: node.Variadic,
+		Env: env, Body: node.Body, Slots: node.Slots}
 }
 
 // Extends the enviornment with a new enclosed enviornment
 // This is important when accessing a closure so that the,
 // function env is used rather than the outer environment.
+//
+// Named functions are bound to their name.
+// Parameters without an argument are bound to their default value, evaluated in the new environment
+// so that it may use the parameters before it. The last parameter of a variadic function is bound
+// to an array of the remaining arguments.
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+) (*object.Environment, object.Object) {
+	env := object.NewEnclosedEnvironment(fn.Env, fn.Slots)
+	if fn.Self != nil {
+		env.Bind(fn.Self.Slot, fn)
+	}
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		switch {
+		case fn.Variadic && paramIdx == len(fn.Parameters)-1:
+			rest := []object.Object{}
+			if paramIdx < len(args) {
+				rest = append(rest, args[paramIdx:]...)
+			}
+			env.Bind(param.Slot, object.NewArray(rest))
+		case paramIdx < len(args):
+			env.Bind(param.Slot, args[paramIdx])
+		default:
+			value := Eval(fn.Defaults[paramIdx], env)
+			if isError(value) {
+				return nil, value
+			}
+			env.Bind(param.Slot, value)
+		}
+	}
+
+	return env, nil
+}
+
+// Describes the number of arguments a function expects, as returned by ast.Arity
+func arity(least, most int) string {
+	switch {
+	case most < 0:
+		return fmt.Sprintf("at least %d", least)
+	case least != most:
+		return fmt.Sprintf("%d to %d", least, most)
 	}
+	return fmt.Sprint(least)
+}
 
-	return env
+// Returns the token errors raised by a call are located at
+// Calls of named functions are located at the name, e.g. `len` in `len(1, 2)`
+func callToken(call *ast.CallExpression) token.Token {
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		return ident.Token
+	}
+	return call.Token
 }
 
 // Returns the value in the return value object
@@ -406,14 +560,53 @@ func evalStringInfixExpression(
 	return &object.String{Value: leftVal + rightVal}
 }
 
-// Handles indexing for arrays and hashes
+// Evaluates membership tests: `x in y` reports whether
+// the hash y has the key x, the array y holds an element equal to x,
+// the string y contains the string x, or the set y holds x
+func evalInExpression(left, right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Hash:
+		key, ok := left.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", left.Type())
+		}
+		_, found := right.Get(key.HashKey())
+		return nativeBoolToBooleanObject(found)
+	case *object.Array:
+		for i := 0; i < right.Len(); i++ {
+			if equals(left, right.At(i)) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *object.String:
+		substring, ok := left.(*object.String)
+		if !ok {
+			return newError("type mismatch: %s in %s", left.Type(), right.Type())
+		}
+		return nativeBoolToBooleanObject(strings.Contains(right.Value, substring.Value))
+	case *object.Set:
+		el, ok := left.(object.Hashable)
+		if !ok {
+			return newError("unusable as set element: %s", left.Type())
+		}
+		return nativeBoolToBooleanObject(right.Has(el))
+	}
+	return newError("unknown operator: %s in %s", left.Type(), right.Type())
+}
+
+// Handles indexing for arrays, strings and hashes
 // Delegates to the specific functions based on the object type being indexed
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.ERROR_VALUE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalErrorField(left.(*object.ErrorValue), index.(*object.String))
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -421,17 +614,107 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 // Retrieves an element at a specific index from an array
 // Checks for out-of-bounds access and returns NULL if index is invalid
-// Supports negative indexing which counts from the end of the array
+// Supports negative indexing which counts from the end of the array: -1 is the last element
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	idx, ok := position(index.(*object.Integer).Value, arrayObject.Len())
+	if !ok {
+		return NULL
+	}
 
-	if idx < 0 || idx > max {
+	return arrayObject.At(idx)
+}
+
+// Retrieves the character at a specific index of a string, as a string of its own
+// Strings are indexed by character rather than by byte, the way `len` measures them
+// Returns NULL for indexes out of bounds, and counts negative indexes from the end like arrays do
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	chars := []rune(str.(*object.String).Value)
+	idx, ok := position(index.(*object.Integer).Value, len(chars))
+	if !ok {
 		return NULL
 	}
 
-	return arrayObject.Elements[idx]
+	return &object.String{Value: string(chars[idx])}
+}
+
+// Returns the position an index refers to within a sequence of the given length
+// Negative indexes count from the end: -1 is the last position
+// Reports false when the index is out of bounds
+func position(index int64, length int) (int, bool) {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 || index >= int64(length) {
+		return 0, false
+	}
+	return int(index), true
+}
+
+// Slices arrays and strings, from the low bound up to, but not including, the high bound
+// Missing bounds are NULL and default to the start and the end.
+// Negative bounds count from the end, and bounds out of range are clamped, so slicing never fails on them.
+func evalSliceExpression(left, low, high object.Object) object.Object {
+	var length int
+	var chars []rune
+	switch left := left.(type) {
+	case *object.Array:
+		length = left.Len()
+	case *object.String:
+		chars = []rune(left.Value)
+		length = len(chars)
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	start, err := sliceBound(low, 0, length)
+	if err != nil {
+		return err
+	}
+	end, err := sliceBound(high, length, length)
+	if err != nil {
+		return err
+	}
+	if end < start {
+		end = start
+	}
+
+	if array, ok := left.(*object.Array); ok {
+		return array.Slice(start, end)
+	}
+	return &object.String{Value: string(chars[start:end])}
+}
+
+// Returns the position a bound of a slice refers to, clamped within the sequence
+func sliceBound(bound object.Object, missing, length int) (int, *object.Error) {
+	if bound == NULL {
+		return missing, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bound must be INTEGER, got %s", bound.Type())
+	}
+	idx := integer.Value
+	if idx < 0 {
+		idx += int64(length)
+	}
+	return int(max(0, min(idx, int64(length)))), nil
+}
+
+// Evaluates template strings by joining their parts with the values embedded between them
+// Values are converted to text like `puts` prints them
+func evalTemplateLiteral(node *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
+	out.WriteString(node.Parts[0])
+	for i, value := range node.Values {
+		val := Eval(value, env)
+		if isError(val) {
+			return val
+		}
+		out.WriteString(val.Inspect())
+		out.WriteString(node.Parts[i+1])
+	}
+	return &object.String{Value: out.String()}
 }
 
 // Evaluates hash literals to produce a hash object
@@ -442,7 +725,7 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
@@ -460,11 +743,10 @@ func evalHashLiteral(
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash = hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 // Retrieves a value from a hash using a specified index
@@ -479,7 +761,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(key.HashKey())
 	if !ok {
 		return NULL
 	}
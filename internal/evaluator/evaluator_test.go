@@ -1,8 +1,12 @@
 package evaluator
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
 	"testing"
 
+	"YARTBML/ast"
 	"YARTBML/lexer"
 	"YARTBML/object"
 	"YARTBML/parser"
@@ -198,6 +202,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true;",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"let x = 5; x(1);",
+			"not a function: INTEGER",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -301,6 +309,187 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+func TestNamedFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"fn fact(n) { if (n < 2) { 1; } else { n * fact(n - 1); }; }(5);", 120},
+		{"let f = fn fib(n) { if (n < 2) { n; } else { fib(n - 1) + fib(n - 2); }; }; f(10);", 55},
+		{"let fib = 1; let f = fn fib(n) { if (n < 2) { n; } else { fib(n - 1) + fib(n - 2); }; }; f(7) + fib;", 14},
+		{"let f = fn g(g) { g; }; f(3);", 3},
+		// A named function used as a statement binds its name within the enclosing scope
+		{"fn g(x) { x; }; g(1);", 1},
+		{"fn fact(n) { if (n < 2) { 1; } else { n * fact(n - 1); }; }; fact(5);", 120},
+		{"let f = fn() { fn double(x) { x * 2; }; double(4); }; f();", 8},
+		{"fn g() { 1; }; let h = g; fn g() { 2; }; h() + g();", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	inspects := []struct {
+		input    string
+		expected string
+	}{
+		{"fn fib(n) { n; };", "fn fib(n) { ... }"},
+		{"let add = fn(a, b = 1) { a + b; }; add;", "fn add(a, b = 1) { ... }"},
+		{"let f = fn g(...xs) { xs; }; f;", "fn g(...xs) { ... }"},
+		{"fn(x) { x; };", "fn(x) { ... }"},
+		{"let f = fn() { fn(x) { x; }; }; f();", "fn(x) { ... }"},
+	}
+	for _, tt := range inspects {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong inspect of %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestErrorStacks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let f = fn(x) { x + true; };\nf(1);", []string{"f, called at 2:1"}},
+		{"let inner = fn() { -true; };\nlet outer = fn() { inner(); };\nouter();",
+			[]string{"inner, called at 2:20", "outer, called at 3:1"}},
+		{"fn(x) { x + true; }(1);", []string{"anonymous function, called at 1:20"}},
+		{"let f = fn(a) { a; }; f();", []string{}},
+		{"let f = fn(a = -true) { a; }; f();", []string{"f, called at 1:31"}},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		frames := []string{}
+		for _, frame := range errObj.Stack {
+			frames = append(frames, frame.String())
+		}
+		if strings.Join(frames, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("wrong stack for %q. expected=%q, got=%q", tt.input, tt.expected, frames)
+		}
+	}
+
+	input := "let countdown = fn(n) { if (n == 0) { -true; } else { countdown(n - 1); }; };\ncountdown(3);"
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned for %q", input)
+	}
+	expected := "ERROR: unknown operator: -BOOLEAN\n\tin countdown, called at 1:55 (3 times)\n\tin countdown, called at 2:1"
+	if got := errObj.Inspect(); got != expected {
+		t.Errorf("wrong inspect. expected=%q, got=%q", expected, got)
+	}
+	d := errObj.Diagnostic()
+	if len(d.Related) != 2 || d.Related[0].Message != "in countdown, called here (3 times)" || d.Related[1].Span.Start.String() != "2:1" {
+		t.Errorf("wrong notes. got=%+v", d.Related)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1; } catch (e) { 2; };", "1"},
+		{"try { [1][\"a\"]; } catch (e) { 2; };", "2"},
+		{`try { throw "bad"; } catch (e) { e["message"]; };`, "bad"},
+		{`try { throw "bad"; } catch (e) { e["kind"]; };`, "error"},
+		{`try { throw error("negative", "validation"); } catch (e) { e["kind"] + ": " + e["message"]; };`, "validation: negative"},
+		{`try { 1 + true; } catch (e) { e; };`, "runtime: type mismatch: INTEGER + BOOLEAN"},
+		{`try { throw 5; } catch (e) { e["message"]; };`, "5"},
+		{`try { throw "bad"; } catch (e) { e["other"]; };`, "null"},
+		{`let e = error("bad"); e;`, "error: bad"},
+		{"let f = fn(x) { if (x < 0) { throw \"negative\"; }; x; };\ntry { f(-1); } catch (e) { e[\"stack\"]; };", "[f, called at 2:7]"},
+		{"let f = fn() { try { return 1; } finally { puts; }; 2; }; f();", "1"},
+		{"let f = fn() { try { 1; } finally { return 2; }; }; f();", "2"},
+		{"let n = 0; let n = try { throw \"a\"; } catch (e) { 1; } finally { 2; }; n;", "1"},
+		{"let f = fn() { try { throw \"a\"; } catch (e) { return e[\"message\"]; }; \"b\"; }; f();", "a"},
+		{"try { try { throw \"inner\"; } catch (e) { throw e; }; } catch (e) { e[\"message\"]; };", "inner"},
+		{"try { try { throw \"inner\"; } finally { 1; }; } catch (e) { e[\"message\"]; };", "inner"},
+		// The caught error is only bound within the catch block, leaving the bindings of the same name alone
+		{`let e = 5; try { throw "x"; } catch (e) { 1; }; e;`, "5"},
+		{`let f = fn() { let e = 5; [try { throw "x"; } catch (e) { e["message"]; }, e]; }; f();`, "[x, 5]"},
+		{`let e = 5; let g = try { throw "x"; } catch (e) { fn() { e["message"]; }; }; [g(), e];`, "[x, 5]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("no result for %q", tt.input)
+			continue
+		}
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestNullSafeIndexing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let people = [{"address": {"city": "Oslo"}}]; people[0]?.address?.city;`, "Oslo"},
+		{`let people = [{"address": {"city": "Oslo"}}]; people[1]?.address?.city;`, "null"},
+		{`let people = [{"address": {"city": "Oslo"}}]; people[1]?.address?.city ?? "unknown";`, "unknown"},
+		{`let people = [{"address": {"city": "Oslo"}}]; people[1]?["address"]?["city"];`, "null"},
+		{"let xs = if (false) { [1]; }; xs?[puts(1)];", "null"},
+		{"5 ?? 6;", "5"},
+		{"false ?? true;", "false"},
+		{"if (false) { 1; } ?? 2 ?? 3;", "2"},
+		{`1 ?? [1]["a"];`, "1"},
+		{`let h = {"a": 1}; h?.b ?? h?.a;`, "1"},
+		{"let h = if (false) { 1; }; h?.a[\"b\"];", "ERROR: index operator not supported: NULL"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("no result for %q", tt.input)
+			continue
+		}
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedKind    string
+		expectedSpan    string
+	}{
+		{`throw "bad";`, "bad", object.THROWN_ERROR, "1:1-1:6"},
+		{`throw error("bad", "input");`, "bad", "input", "1:1-1:6"},
+		{"let e = try { 1 + true; } catch (e) { e; };\nthrow e;", "type mismatch: INTEGER + BOOLEAN", object.RUNTIME_ERROR, "1:17-1:18"},
+		{`try { 1; } catch (e) { 2; } finally { throw "final"; };`, "final", object.THROWN_ERROR, "1:39-1:44"},
+		{`try { throw "a"; } catch (e) { throw "b"; };`, "b", object.THROWN_ERROR, "1:32-1:37"},
+		{`error(5);`, "arguments to `error` must be STRING, got INTEGER", object.RUNTIME_ERROR, "1:1-1:6"},
+		{`error();`, "wrong number of arguments. got=0, want=1 or 2", object.RUNTIME_ERROR, "1:1-1:6"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage || errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error for %q. expected=%s %q, got=%s %q",
+				tt.input, tt.expectedKind, tt.expectedMessage, errObj.Kind, errObj.Message)
+		}
+		d := errObj.Diagnostic()
+		if span := d.Span.Start.String() + "-" + d.Span.End.String(); span != tt.expectedSpan {
+			t.Errorf("wrong span for %q. expected=%s, got=%s", tt.input, tt.expectedSpan, span)
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -319,6 +508,52 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let add = fn(a, b = 10) { a + b; }; add(1);", 11},
+		{"let add = fn(a, b = 10) { a + b; }; add(1, 2);", 3},
+		{"let f = fn(a, b = a * 2) { b; }; f(4);", 8},
+		{"let n = 0; let f = fn(a = n + 1) { a; }; let n = 5; f();", 6},
+		{"let count = fn(first, ...others) { len(others); }; count(1, 2, 3);", 2},
+		{"let count = fn(first, ...others) { len(others); }; count(1);", 0},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest); }; f(1);", 3},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest); }; f(1, 1, 1, 1);", 4},
+		{"let add = fn(a, b) { a + b; }; add(...[1, 2]);", 3},
+		{"let add = fn(a, b, c) { a + b + c; }; add(1, ...[2], ...[], 3);", 6},
+		{"let sum = fn(...xs) { if (len(xs) == 0) { 0; } else { first(xs) + sum(...rest(xs)); }; }; sum(1, 2, 3);", 6},
+		{"let wrap = fn(f, ...args) { f(...args); }; wrap(fn(a, b) { a - b; }, 5, 3);", 2},
+		{"len(...[[1, 2, 3]]);", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let f = fn(a, b = 1) { a; }; f();", "wrong number of arguments. want=1 to 2. got=0"},
+		{"let f = fn(a, b = 1) { a; }; f(1, 2, 3);", "wrong number of arguments. want=1 to 2. got=3"},
+		{"let f = fn(a, ...b) { a; }; f();", "wrong number of arguments. want=at least 1. got=0"},
+		{"let f = fn(a, b) { a; }; f(...[1, 2, 3]);", "wrong number of arguments. want=2. got=3"},
+		{"let f = fn(a) { a; }; f(...5);", "spread operator not supported: INTEGER"},
+		{`let f = fn(a = 1 + "a") { a; }; f();`, "type mismatch: INTEGER + STRING"},
+	}
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 	let newAdder = fn(x) {
@@ -357,6 +592,32 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestTemplateStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"`Hello World!`;", "Hello World!"},
+		{"let name = \"Anna\"; let age = 24; `Hello ${name}, you are ${age}`;", "Hello Anna, you are 24"},
+		{"`${1 + 2}${true}${[1, \"a\"]}`;", "3true[1, a]"},
+		{"let f = fn(x) { `<${x}>`; }; `${f(`${f(1)}`)}`;", "<<1>>"},
+		{"`${ {\"a\": 1}[\"a\"] }`;", "1"},
+		{"`a\n${if (false) { 1; }}b`;", "a\nnullb"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong value for %q. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -365,6 +626,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("");`, 0},
 		{`len("four");`, 4},
 		{`len("hello world");`, 11},
+		{`len("héllo");`, 5},
+		{`len("日本語");`, 3},
 		{`len(1);`, "argument to `len` not supported, got INTEGER"}, 
 		{`len("one", "two");`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -388,6 +651,95 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"set();", "set()"},
+		{"set(3, 1, 2, 1);", "set(1, 2, 3)"},
+		{`set("b", "a", "b");`, "set(a, b)"},
+		{"let xs = [2, 2, 1]; set(...xs);", "set(1, 2)"},
+		{"len(set(1, 1, 2));", "2"},
+		{"2 in set(1, 2);", "true"},
+		{"3 in set(1, 2);", "false"},
+		{`"a" in set(1, 2);`, "false"},
+		{"1 + 1 in set(2) == true;", "true"},
+		{"union(set(1, 2), set(2, 3));", "set(1, 2, 3)"},
+		{"intersection(set(1, 2), set(2, 3));", "set(2)"},
+		{"difference(set(1, 2), set(2, 3));", "set(1)"},
+		{"let s = set(1); let t = union(s, set(2)); s;", "set(1)"},
+		{"let toArray = fn(...xs) { xs; }; toArray(...set(3, 1, 2));", "[1, 2, 3]"},
+		{"set([1]);", "ERROR: unusable as set element: ARRAY"},
+		{"[1] in set(1);", "ERROR: unusable as set element: ARRAY"},
+		{"union(set(1), [1]);", "ERROR: arguments to `union` must be SET, got ARRAY"},
+		{"1 in 2;", "ERROR: unknown operator: INTEGER in INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("no result for %q", tt.input)
+			continue
+		}
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMembership(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a" in {"a": 1};`, "true"},
+		{`"b" in {"a": 1};`, "false"},
+		{`let h = {"a": if (false) { 1; }}; [h["a"], "a" in h, h["b"], "b" in h];`, "[null, true, null, false]"},
+		{`1 in {1: "one", true: "yes"}; 2 in {true: 1};`, "false"},
+		{"2 in [1, 2, 3];", "true"},
+		{"4 in [1, 2, 3];", "false"},
+		{`"b" in ["a", "b"];`, "true"},
+		{`"1" in [1];`, "false"},
+		// Arrays, hashes and sets are compared by value, unlike with ==
+		{"[1] in [[1]];", "true"},
+		{"[1, [2]] in [[1, [2]]];", "true"},
+		{"[1, 2] in [[2, 1]];", "false"},
+		{"[1] in [[1, 2]];", "false"},
+		{`{"a": 1} in [{"a": 1}];`, "true"},
+		{`{"a": [1]} in [{"a": [1]}];`, "true"},
+		{`{"a": 1} in [{"a": 2}];`, "false"},
+		{`{"a": 1} in [{"a": 1, "b": 2}];`, "false"},
+		{`{1: 1} in [{true: 1}];`, "false"},
+		{"set(1, 2) in [set(2, 1)];", "true"},
+		{"set(1) in [set(1, 2)];", "false"},
+		{"[[1] == [1], [1] in [[1]]];", "[false, true]"},
+		{`["a" == "a", "a" in ["a"]];`, "[false, true]"},
+		{"let f = fn() { 1; }; [f in [f], f in [fn() { 1; }]];", "[true, false]"},
+		{"let xs = [1]; xs in [xs];", "true"},
+		{"true in [1, true];", "true"},
+		{"[] in [];", "false"},
+		{`"ell" in "hello";`, "true"},
+		{`"" in "hello";`, "true"},
+		{`"eh" in "hello";`, "false"},
+		{`!("a" in "b") == true;`, "true"},
+		{`[1] in {"a": 1};`, "ERROR: unusable as hash key: ARRAY"},
+		{`1 in "abc";`, "ERROR: type mismatch: INTEGER in STRING"},
+		{"1 in true;", "ERROR: unknown operator: INTEGER in BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("no result for %q", tt.input)
+			continue
+		}
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3];"
 
@@ -397,14 +749,14 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(result.Elements) != 3 {
+	if result.Len() != 3 {
 		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
+			result.Len())
 	}
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+	testIntegerObject(t, result.At(0), 1)
+	testIntegerObject(t, result.At(1), 4)
+	testIntegerObject(t, result.At(2), 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -450,6 +802,18 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1];",
+			3,
+		},
+		{
+			"[1, 2, 3][-3];",
+			1,
+		},
+		{
+			"[1, 2, 3][-4];",
+			nil,
+		},
+		{
+			"[][-1];",
 			nil,
 		},
 	}
@@ -466,6 +830,81 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0];`, "a"},
+		{`"abc"[2];`, "c"},
+		{`"abc"[-1];`, "c"},
+		{`"abc"[-3];`, "a"},
+		{`"abc"[3];`, nil},
+		{`"abc"[-4];`, nil},
+		{`""[0];`, nil},
+		// Strings are indexed by character, not by byte
+		{`"héllo"[1];`, "é"},
+		{`"héllo"[2];`, "l"},
+		{`"héllo"[-4];`, "é"},
+		{`"日本語"[2];`, "語"},
+		{`"日本語"[3];`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%+v", tt.input, expected, evaluated)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4][1:3];", "[2, 3]"},
+		{"[1, 2, 3, 4][:2];", "[1, 2]"},
+		{"[1, 2, 3, 4][2:];", "[3, 4]"},
+		{"[1, 2, 3, 4][:];", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][:-1];", "[1, 2, 3]"},
+		{"[1, 2, 3, 4][-2:];", "[3, 4]"},
+		{"[1, 2, 3, 4][-10:10];", "[1, 2, 3, 4]"},
+		{"[1, 2, 3, 4][3:1];", "[]"},
+		{"[1, 2, 3, 4][5:];", "[]"},
+		{"let i = 1; [1, 2, 3, 4][i:i + 2];", "[2, 3]"},
+		{`"hello"[1:3];`, "el"},
+		{`"hello"[:-1];`, "hell"},
+		{`"hello"[-3:];`, "llo"},
+		{`"hello"[4:2];`, ""},
+		{`"héllo"[1:3];`, "él"},
+		{`"héllo"[:-3];`, "hé"},
+		{`"日本語"[-2:];`, "本語"},
+		{"let xs = if (false) { [1]; }; xs?[1:];", "null"},
+		{"let xs = [1, 2]; let ys = xs[:]; let ys = push(ys, 3); xs;", "[1, 2]"},
+		{`[1, 2][1:"a"];`, "ERROR: slice bound must be INTEGER, got STRING"},
+		{`{"a": 1}[0:1];`, "ERROR: slice operator not supported: HASH"},
+		{`5[:1];`, "ERROR: slice operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("no result for %q", tt.input)
+			continue
+		}
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
 	{
@@ -491,12 +930,12 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := result.Get(expectedKey)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -549,4 +988,328 @@ func TestHashIndexExpressions(t *testing.T) {
 			testNullObject(t, evaluated)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func testEvalSandboxed(input string, sandbox *object.Sandbox) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewSandboxedEnvironment(sandbox)
+	return Eval(program, env)
+}
+
+func TestBuiltinCapabilities(t *testing.T) {
+	tests := []struct {
+		input           string
+		allowed         []object.Capability
+		expectedMessage string
+	}{
+		{`puts("hello");`, nil, "permission denied: puts requires the stdout capability"},
+		{`readFile("/etc/hostname");`, []object.Capability{object.STDOUT_CAP}, "permission denied: readFile requires the filesystem capability"},
+		{`writeFile("out.txt", "");`, nil, "permission denied: writeFile requires the filesystem capability"},
+		{`getEnv("HOME");`, nil, "permission denied: getEnv requires the env capability"},
+		{`now();`, []object.Capability{object.RANDOM_CAP}, "permission denied: now requires the time capability"},
+		{`random(10);`, []object.Capability{object.TIME_CAP}, "permission denied: random requires the random capability"},
+		{`let f = fn() { puts(1); }; f();`, nil, "permission denied: puts requires the stdout capability"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		evaluated := testEvalSandboxed(tt.input, object.NewSandbox(strings.NewReader(""), &out, &out, tt.allowed...))
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+		if out.Len() != 0 {
+			t.Errorf("denied builtin wrote output. got=%q", out.String())
+		}
+	}
+}
+
+func TestAllowedCapabilities(t *testing.T) {
+	var out bytes.Buffer
+	sandbox := object.NewSandbox(strings.NewReader(""), &out, &out,
+		object.STDOUT_CAP, object.TIME_CAP, object.RANDOM_CAP)
+
+	evaluated := testEvalSandboxed(`puts("hello", 5); len([1, 2]);`, sandbox)
+	testIntegerObject(t, evaluated, 2)
+	if out.String() != "hello\n5\n" {
+		t.Errorf("puts wrote wrong output. got=%q", out.String())
+	}
+
+	evaluated = testEvalSandboxed(`random(1);`, sandbox)
+	testIntegerObject(t, evaluated, 0)
+
+	evaluated = testEvalSandboxed(`now() > 0;`, sandbox)
+	testBooleanObject(t, evaluated, true)
+}
+
+func TestErrorSpans(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedSpan string
+	}{
+		{"5 + true;", "1:3-1:4"},
+		{"let f = fn(a) {\n  -a;\n};\nf(true);", "2:3-2:4"},
+		{"foobar;", "1:1-1:7"},
+		{"len(1, 2);", "1:1-1:4"},
+		{`{"a": 1}[fn(x) { x; }];`, "1:9-1:10"},
+		{`{fn(x) { x; }: 1};`, "1:1-1:2"},
+		{"len(1, ...2);", "1:8-1:11"},
+		{"`a ${-true} b`;", "1:6-1:7"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		d := errObj.Diagnostic()
+		span := d.Span.Start.String() + "-" + d.Span.End.String()
+		if span != tt.expectedSpan {
+			t.Errorf("wrong span for %q. expected=%s, got=%s", tt.input, tt.expectedSpan, span)
+		}
+		if d.Code != "runtime-error" || d.Message != errObj.Message {
+			t.Errorf("wrong diagnostic. got=%+v", d)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	input := "let x = 1; let f = fn(a) { let b = a + x; len(b); }; f(x);"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := object.NewEnvironment()
+	if diagnostics := Resolve(program, env); len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	// Name of every identifier along with its depth and slot
+	resolved := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			resolved = append(resolved, fmt.Sprintf("%s@%d:%d", ident.Value, ident.Depth, ident.Slot))
+		}
+		return true
+	})
+
+	expected := []string{"x@0:0", "f@0:1", "a@0:0", "b@0:1", "a@0:0", "x@1:0", "len@0:-1", "b@0:1", "f@0:1", "x@0:0"}
+	if strings.Join(resolved, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong resolution.\nexpected=%v\ngot=%v", expected, resolved)
+	}
+
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if fn.Slots != 2 {
+		t.Errorf("wrong number of slots for the function. got=%d", fn.Slots)
+	}
+}
+
+func TestUndefinedNamesAreReportedBeforeRunning(t *testing.T) {
+	var out bytes.Buffer
+	sandbox := object.NewSandbox(strings.NewReader(""), &out, &out, object.STDOUT_CAP)
+
+	evaluated := testEvalSandboxed(`puts("hello"); let f = fn() { y; };`, sandbox)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: y" {
+		t.Fatalf("wrong result. got=%T(%+v)", evaluated, evaluated)
+	}
+	if span := errObj.Span.Start.String(); span != "1:31" {
+		t.Errorf("wrong span. got=%s", span)
+	}
+	if out.Len() != 0 {
+		t.Errorf("program ran despite the undefined name. got=%q", out.String())
+	}
+}
+
+func TestBindingsMadeAtRuntime(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn() { g(); }; let g = fn() { 5; }; f();", 5},
+		{"let x = 1; let f = fn() { x; }; let x = 2; f();", 2},
+		{"let x = 1; let f = fn() { let y = x; let x = 3; y + x; }; f();", 4},
+		{"let f = fn(n) { if (n > 0) { let r = n; }; r; }; f(1);", 1},
+		{"let f = fn(n) { if (n > 0) { let r = n; }; r; }; f(0);", "identifier not found: r"},
+		{"g(); let g = fn() { 1; };", "identifier not found: g"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong result for %q. expected error %q, got=%T(%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestGlobalEnvironmentIsShared(t *testing.T) {
+	env := object.NewEnvironment()
+	eval := func(input string) object.Object {
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	if _, ok := eval("let x = 2; let f = fn() { x * y; };").(*object.Error); !ok {
+		t.Fatalf("expected an error for the undefined y")
+	}
+	if names := env.Names(); len(names) != 0 {
+		t.Errorf("program with errors bound names. got=%v", names)
+	}
+
+	eval("let x = 2; let y = 3;")
+	testIntegerObject(t, eval("let f = fn() { x * y; }; f();"), 6)
+	testIntegerObject(t, eval("let y = 5; f();"), 10)
+
+	if names := strings.Join(env.Names(), " "); names != "f x y" {
+		t.Errorf("wrong names. got=%s", names)
+	}
+	if value, ok := env.Get("y"); !ok || value.Inspect() != "5" {
+		t.Errorf("wrong value of y. got=%v", value)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"match (1) { 1 => 10, 2 => 20 };", 10},
+		{"match (2) { 1 => 10, 2 => 20 };", 20},
+		{"match (-3) { -3 => 1, _ => 2 };", 1},
+		{`match ("b") { "a" => 1, "b" => 2 };`, 2},
+		{`match ("1") { 1 => 1, _ => 2 };`, 2},
+		{"match (false) { true => 1, false => 2 };", 2},
+		{"match (5) { n => n * 2 };", 10},
+		{"match (5) { _ => 1, _ => 2 };", 1},
+		{"match (5) { n if n > 10 => 1, n if n > 1 => 2, _ => 3 };", 2},
+		{"match ([]) { [] => 0, [x] => x };", 0},
+		{"match ([7]) { [] => 0, [x] => x };", 7},
+		{"match ([1, 2]) { [x] => x, [x, y] => x + y };", 3},
+		{"match ([1, 2, 3]) { [x, y] => 0, [head, ...tail] => head + len(tail) };", 3},
+		{"match ([1]) { [head, ...tail] => len(tail) };", 0},
+		{"match ([[1, 2], 3]) { [[a, b], c] => a + b + c };", 6},
+		{`match ({"name": "Anna", "age": 24}) { {"age": a} => a };`, 24},
+		{`match ({"age": 24}) { {"name": n} => 1, {"age": 24} => 2 };`, 2},
+		{`match ({1: [2, 3]}) { {1: [_, x]} => x };`, 3},
+		{`match (5) { [x] => x, {"a": x} => x, x => x };`, 5},
+		{"let sum = fn(xs) { match (xs) { [] => 0, [x, ...rest] => x + sum(rest) }; }; sum([1, 2, 3, 4]);", 10},
+		{"let f = fn(x) { match (x) { 1 => if (true) { return 5; }, _ => 0 }; 9; }; f(1);", 5},
+		{"let f = fn(x) { match (x) { 1 => if (true) { return 5; }, _ => 0 }; 9; }; f(2);", 9},
+		// The names of a pattern are only bound within their arm, leaving the bindings of the same name alone
+		{"let x = 1; match (2) { x => x }; x;", 1},
+		{"let x = 1; match (2) { x => x } + x;", 3},
+		{"let x = 1; match ([2, 3]) { [x, 4] => 0, _ => x };", 1},
+		{"let n = 1; match (5) { n if n > 10 => 0, _ => n };", 1},
+		{"let f = fn() { let x = 1; match (2) { x => 0 }; x; }; f();", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errors := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"match (3) { 1 => 1, 2 => 2 };", "no pattern matches 3"},
+		{"match ([1, 2]) { [x] => x, [] => 0 };", "no pattern matches [1, 2]"},
+		{"match (3) { n if n > 5 => n };", "no pattern matches 3"},
+		{"match (3) { n if n + true => n };", "type mismatch: INTEGER + BOOLEAN"},
+		{"match (x) { _ => 1 };", "identifier not found: x"},
+		{"let x = match (3) { n => n }; x + n;", "identifier not found: n"},
+	}
+
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b;", 12},
+		{"let [x, ...xs] = [1, 2, 3]; x + len(xs);", 3},
+		{"let [x, ...xs] = [1]; len(xs);", 0},
+		{"let [_, [b, c]] = [1, [2, 3]]; b + c;", 5},
+		{`let {"name": n, "age": a} = {"name": "Anna", "age": 24}; len(n) + a;`, 28},
+		{`let {"point": [x, y]} = {"point": [3, 4], "other": 0}; x * y;`, 12},
+		{"let f = fn(pair) { let [a, b] = pair; a - b; }; f([5, 3]);", 2},
+		{"let [a, b] = [1, 2]; let [a, b] = [b, a]; a;", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input           string
+		expectedMessage string
+		expectedSpan    string
+	}{
+		{"let [a, b] = 5;", "cannot destructure: expected an array, got INTEGER", "1:5"},
+		{"let [a, b] = [1, 2, 3];", "cannot destructure: expected an array of 2 elements, got 3", "1:5"},
+		{"let [a, b, ...c] = [1];", "cannot destructure: expected an array of at least 2 elements, got 1", "1:5"},
+		{`let {"name": n} = [1];`, "cannot destructure: expected a hash, got ARRAY", "1:5"},
+		{`let {"name": n} = {"age": 1};`, "cannot destructure: missing hash key: name", "1:5"},
+		{`let [{"a": [x]}] = [{"a": 1}];`, "cannot destructure: expected an array, got INTEGER", "1:5"},
+		{"let [1, x] = [2, 3];", "cannot destructure: expected 1, got 2", "1:5"},
+		{"let [a] = [b];", "identifier not found: b", "1:12"},
+	}
+
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+		if span := errObj.Span.Start.String(); span != tt.expectedSpan {
+			t.Errorf("wrong error position for %q. expected=%s, got=%s", tt.input, tt.expectedSpan, span)
+		}
+	}
+}
+
+func BenchmarkRecursiveFibonacci(b *testing.B) {
+	input := "let fib = fn(n) { if (n < 2) { n; } else { fib(n - 1) + fib(n - 2); }; }; fib(15);"
+	for i := 0; i < b.N; i++ {
+		testEval(input)
+	}
+}
+
+// Builds a list by pushing onto it in a loop, which used to copy the whole list every time
+func BenchmarkBuildingArrays(b *testing.B) {
+	input := "let build = fn(xs, n) { if (n == 0) { xs; } else { build(push(xs, n), n - 1); }; }; len(build([], 2000));"
+	for i := 0; i < b.N; i++ {
+		testEval(input)
+	}
+}
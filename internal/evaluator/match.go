@@ -0,0 +1,174 @@
+package evaluator
+
+import (
+	"YARTBML/ast"
+	"YARTBML/object"
+	"fmt"
+)
+
+// Evaluates the value of the first arm whose pattern matches the value and whose guard is truthy.
+// The names bound by the pattern are bound before the guard is evaluated.
+// Returns an error when no arm is taken.
+func evalMatchExpression(node *ast.MatchExpression, value object.Object, env *object.Environment) object.Object {
+	for _, arm := range node.Arms {
+		matched, err := matchPattern(arm.Pattern, value, env)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, env)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Value, env)
+	}
+
+	return newError("no pattern matches %s", value.Inspect())
+}
+
+// Binds the names of the pattern of a destructuring let to the parts of the value they match.
+// Returns an error telling why when the value doesn't match the pattern.
+func evalDestructuring(pattern ast.Pattern, value object.Object, env *object.Environment) object.Object {
+	mismatch, err := bindPattern(pattern, value, env)
+	if err != nil {
+		return err
+	}
+	if mismatch != "" {
+		return newError("cannot destructure: %s", mismatch)
+	}
+	return nil
+}
+
+// Reports whether the value matches the pattern, binding the names of the pattern as it goes.
+// Names bound by a pattern that doesn't match as a whole may have been bound anyway, which is harmless
+// since they are only in view within their arm.
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, object.Object) {
+	mismatch, err := bindPattern(pattern, value, env)
+	return mismatch == "" && err == nil, err
+}
+
+// Binds the names of the pattern to the parts of the value they match.
+// Returns why the value doesn't match the pattern, which is empty when it does,
+// or an error when evaluating a literal of the pattern fails.
+func bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (string, object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return "", nil
+
+	case *ast.Identifier:
+		env.Bind(pattern.Slot, value)
+		return "", nil
+
+	case *ast.LiteralPattern:
+		literal := Eval(pattern.Value, env)
+		if isError(literal) {
+			return "", literal
+		}
+		if !equals(literal, value) {
+			return fmt.Sprintf("expected %s, got %s", literal.Inspect(), value.Inspect()), nil
+		}
+		return "", nil
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return fmt.Sprintf("expected an array, got %s", value.Type()), nil
+		}
+		if pattern.Rest == nil && array.Len() != len(pattern.Elements) {
+			return fmt.Sprintf("expected an array of %d elements, got %d", len(pattern.Elements), array.Len()), nil
+		}
+		if array.Len() < len(pattern.Elements) {
+			return fmt.Sprintf("expected an array of at least %d elements, got %d", len(pattern.Elements), array.Len()), nil
+		}
+		for i, element := range pattern.Elements {
+			if mismatch, err := bindPattern(element, array.At(i), env); mismatch != "" || err != nil {
+				return mismatch, err
+			}
+		}
+		if pattern.Rest != nil {
+			return bindPattern(pattern.Rest, array.Slice(len(pattern.Elements), array.Len()), env)
+		}
+		return "", nil
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return fmt.Sprintf("expected a hash, got %s", value.Type()), nil
+		}
+		for i, keyNode := range pattern.Keys {
+			key := Eval(keyNode, env)
+			if isError(key) {
+				return "", key
+			}
+			pair, ok := hash.Get(key.(object.Hashable).HashKey())
+			if !ok {
+				return fmt.Sprintf("missing hash key: %s", key.Inspect()), nil
+			}
+			if mismatch, err := bindPattern(pattern.Values[i], pair.Value, env); mismatch != "" || err != nil {
+				return mismatch, err
+			}
+		}
+		return "", nil
+	}
+
+	return "unknown pattern", nil
+}
+
+// Reports whether both values are equal: integers, strings and booleans of the same value,
+// arrays of equal elements in the same order, hashes holding equal values for the same keys,
+// sets of the same elements, or both null. Other values, like functions, are only equal to themselves.
+// Unlike `==`, which compares strings, arrays and hashes by identity, this is how `in` and
+// the literal patterns of match expressions compare values.
+func equals(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		b, ok := b.(*object.Integer)
+		return ok && a.Value == b.Value
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Array:
+		b, ok := b.(*object.Array)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equals(a.At(i), b.At(i)) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		b, ok := b.(*object.Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for _, pair := range a.Pairs() {
+			other, ok := b.Get(pair.Key.(object.Hashable).HashKey())
+			if !ok || !equals(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	case *object.Set:
+		b, ok := b.(*object.Set)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for _, el := range a.Elements() {
+			if !b.Has(el.(object.Hashable)) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
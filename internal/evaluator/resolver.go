@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"YARTBML/ast"
+	"YARTBML/diagnostic"
+	"YARTBML/object"
+	"YARTBML/symbols"
+)
+
+// Resolves every identifier of the program to the slot of the binding it refers to,
+// so that the evaluator doesn't have to look bindings up by name.
+//
+// The program and the body of every function get an environment of their own when evaluated,
+// holding one slot per name bound within them. Identifiers record how many functions out
+// the environment of their binding is, along with the slot of the binding within it.
+// The names of the program are bound in the global environment env, which keeps the names
+// bound by previously evaluated programs: the REPL evaluates each input as a program of its own.
+//
+// Identifiers that refer to no binding nor builtin are reported before anything is evaluated.
+// The environment is left untouched when there are errors.
+func Resolve(program *ast.Program, env *object.Environment) []diagnostic.Diagnostic {
+	table := symbols.Resolve(program)
+
+	diagnostics := []diagnostic.Diagnostic{}
+	for _, ident := range table.Identifiers {
+		if table.BindingOf(ident) != nil {
+			continue
+		}
+		if _, ok := env.Slot(ident.Value); ok {
+			continue
+		}
+		if _, ok := builtins[ident.Value]; ok {
+			continue
+		}
+		diagnostics = append(diagnostics, diagnostic.Errorf(diagnostic.TokenSpan(ident.Token),
+			"undefined-name", "identifier not found: %s", ident.Value))
+	}
+	if len(diagnostics) != 0 {
+		return diagnostics
+	}
+
+	// Slots of the names bound in each scope, the names of the program being global.
+	// Local bindings get a slot of their own, so that they never replace the bindings of the same name.
+	slots := map[*symbols.Scope]map[string]int{}
+	locals := map[*symbols.Binding]int{}
+	for _, s := range table.Scopes {
+		names := map[string]int{}
+		size := 0
+		for _, b := range s.Bindings {
+			name := b.Name.Value
+			if _, ok := names[name]; ok && !b.Local() {
+				continue
+			}
+			switch {
+			case b.Local() && s.Outer == nil:
+				locals[b] = env.Reserve()
+			case b.Local():
+				locals[b] = size
+				size++
+			case s.Outer == nil:
+				names[name] = env.Define(name)
+			default:
+				names[name] = size
+				size++
+			}
+		}
+		slots[s] = names
+		if s.Function != nil {
+			s.Function.Slots = size
+		}
+	}
+
+	for _, ident := range table.Identifiers {
+		scope := table.Enclosing(ident)
+		var target *symbols.Scope
+		if b := table.BindingOf(ident); b != nil {
+			target = b.Scope
+			ident.Slot = slots[target][ident.Value]
+			if slot, ok := locals[b]; ok {
+				ident.Slot = slot
+			}
+		} else if slot, ok := env.Slot(ident.Value); ok {
+			target = table.Scopes[0]
+			ident.Slot = slot
+		} else {
+			ident.Depth, ident.Slot = 0, -1
+			continue
+		}
+
+		ident.Depth = 0
+		for s := scope; s != target; s = s.Outer {
+			ident.Depth++
+		}
+	}
+
+	return nil
+}
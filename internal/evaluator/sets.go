@@ -0,0 +1,38 @@
+package evaluator
+
+import "YARTBML/object"
+
+// Returns the set of the elements, which must be hashable
+func newSet(elements []object.Object) object.Object {
+	set := &object.Set{}
+	for _, el := range elements {
+		hashable, ok := el.(object.Hashable)
+		if !ok {
+			return newError("unusable as set element: %s", el.Type())
+		}
+		set = set.Add(hashable)
+	}
+	return set
+}
+
+// Returns a builtin combining two sets into a new one
+func setBuiltin(name string, combine func(a, b *object.Set) *object.Set) *object.Builtin {
+	return &object.Builtin{
+		Name:  name,
+		Arity: 2,
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			for _, arg := range args {
+				if arg.Type() != object.SET_OBJ {
+					return newError("arguments to `%s` must be SET, got %s",
+						name, arg.Type())
+				}
+			}
+
+			return combine(args[0].(*object.Set), args[1].(*object.Set))
+		},
+	}
+}
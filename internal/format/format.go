@@ -0,0 +1,436 @@
+// Package format prints YARTBML programs back out in a canonical style, used by `yartbml fmt`.
+//
+// Every statement goes on a line of its own and blocks are indented by one tab per level,
+// with the opening brace on the same line as the construct owning the block:
+//
+//	let max = fn(a, b) {
+//		if (a > b) {
+//			return a;
+//		} else {
+//			return b;
+//		};
+//	};
+//
+// Infix operators are surrounded by single spaces, commas and colons are followed by one,
+// and parentheses are only kept where the precedence of the operators requires them.
+// Comments are kept, as well as single blank lines separating statements.
+// Formatting a formatted program leaves it unchanged.
+package format
+
+import (
+	"YARTBML/ast"
+	"YARTBML/diagnostic"
+	"YARTBML/lexer"
+	"YARTBML/parser"
+	"YARTBML/token"
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Formats the source of a program.
+// Programs that can't be parsed aren't formatted: their diagnostics are returned instead.
+func Source(source string) (string, []diagnostic.Diagnostic) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", p.Errors()
+	}
+
+	pr := newPrinter(source)
+	pr.program(program)
+	return pr.out.String(), nil
+}
+
+// Prints the AST of a program, putting the comments of its source back in between statements
+type printer struct {
+	out    bytes.Buffer
+	indent int
+
+	tokens    []token.Token       // Tokens and comments of the source, in order
+	comments  []token.Token       // Comments that haven't been printed yet
+	blockEnds map[int]token.Token // Offset of each `{` mapped to its matching `}`
+	end       int                 // Offset of the end of the source
+
+	fresh bool // Set at the start of the program and of every block, until a line is printed
+}
+
+func newPrinter(source string) *printer {
+	p := &printer{blockEnds: map[int]token.Token{}, end: len(source)}
+
+	l := lexer.New(source)
+	open := []int{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		p.tokens = append(p.tokens, tok)
+		switch tok.Type {
+		case token.LBRACE:
+			open = append(open, tok.Pos.Offset)
+		case token.RBRACE:
+			if len(open) > 0 {
+				p.blockEnds[open[len(open)-1]] = tok
+				open = open[:len(open)-1]
+			}
+		}
+	}
+
+	p.comments = l.Comments()
+	p.tokens = append(p.tokens, p.comments...)
+	sort.Slice(p.tokens, func(i, j int) bool {
+		return p.tokens[i].Pos.Offset < p.tokens[j].Pos.Offset
+	})
+
+	return p
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.fresh = true
+	for _, stmt := range program.Statements {
+		p.statement(stmt)
+	}
+	p.flushComments(p.end + 1)
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	pos := ast.FirstToken(stmt).Pos
+	p.flushComments(pos.Offset)
+	p.separate(pos)
+	p.writeIndent()
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		if stmt.Pattern != nil {
+			p.pattern(stmt.Pattern)
+		} else {
+			p.write(stmt.Name.Value)
+		}
+		if stmt.Type != nil {
+			p.write(": ", stmt.Type.String())
+		}
+		p.write(" = ")
+		p.expression(stmt.Value)
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue)
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value)
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+	}
+
+	p.write(";\n")
+	p.fresh = false
+}
+
+// Prints the block with its statements indented, or `{}` when the block is empty.
+// Comments found before the closing brace of the block are printed within the block.
+func (p *printer) block(block *ast.BlockStatement) {
+	closing := p.blockEnds[block.Token.Pos.Offset]
+	hasComments := len(p.comments) > 0 && p.comments[0].Pos.Offset < closing.Pos.Offset
+	if len(block.Statements) == 0 && !hasComments {
+		p.write("{}")
+		return
+	}
+
+	p.write("{\n")
+	p.indent++
+	p.fresh = true
+	for _, stmt := range block.Statements {
+		p.statement(stmt)
+	}
+	p.flushComments(closing.Pos.Offset)
+	p.indent--
+	p.writeIndent()
+	p.write("}")
+}
+
+// Prints every comment found before the offset.
+// A comment following code on the same line stays at the end of the line printed last,
+// every other comment goes on a line of its own.
+func (p *printer) flushComments(offset int) {
+	for len(p.comments) > 0 && p.comments[0].Pos.Offset < offset {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+
+		if prev, ok := p.previous(comment.Pos.Offset); ok && prev.Type != token.COMMENT &&
+			prev.End.Line == comment.Pos.Line && p.out.Len() > 0 {
+			p.out.Truncate(p.out.Len() - 1) // Drop the newline ending the line printed last
+			p.write(" ", comment.Literal, "\n")
+			continue
+		}
+
+		p.separate(comment.Pos)
+		p.writeIndent()
+		p.write(comment.Literal, "\n")
+		p.fresh = false
+	}
+}
+
+// Keeps a single blank line before the statement or comment starting at the position
+// when there was at least one in the source, except at the start of the program or a block.
+func (p *printer) separate(pos token.Position) {
+	if p.fresh {
+		return
+	}
+	if prev, ok := p.previous(pos.Offset); ok && pos.Line-prev.End.Line > 1 {
+		p.write("\n")
+	}
+}
+
+// Returns the `}` matching the last `{` found before the offset
+func (p *printer) closingBrace(offset int) token.Token {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Pos.Offset >= offset })
+	for i--; i >= 0; i-- {
+		if p.tokens[i].Type == token.LBRACE {
+			return p.blockEnds[p.tokens[i].Pos.Offset]
+		}
+	}
+	return token.Token{}
+}
+
+// Returns the token or comment right before the offset
+func (p *printer) previous(offset int) (token.Token, bool) {
+	i := sort.Search(len(p.tokens), func(i int) bool { return p.tokens[i].Pos.Offset >= offset })
+	if i == 0 {
+		return token.Token{}, false
+	}
+	return p.tokens[i-1], true
+}
+
+func (p *printer) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		p.write(expr.Value)
+	case *ast.IntegerLiteral:
+		p.write(expr.Token.Literal)
+	case *ast.BooleanLiteral:
+		p.write(expr.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(`"`, expr.Value, `"`)
+	case *ast.TemplateLiteral:
+		p.write("`", expr.Parts[0])
+		for i, value := range expr.Values {
+			p.write("${")
+			p.expression(value)
+			p.write("}", expr.Parts[i+1])
+		}
+		p.write("`")
+	case *ast.PrefixExpression:
+		p.write(expr.Operator)
+		p.operand(expr.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		// Infix operators are left associative: `a - (b - c)` keeps its parentheses, `(a - b) - c` doesn't
+		precedence := parser.Precedence(expr.Token.Type)
+		p.operand(expr.Left, precedence)
+		p.write(" ", expr.Operator, " ")
+		p.operand(expr.Right, precedence+1)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(expr.TestCondition)
+		p.write(") ")
+		p.block(expr.ThenPath)
+		if expr.ElsePath != nil {
+			p.write(" else ")
+			p.block(expr.ElsePath)
+		}
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(expr.Body)
+		if expr.Catch != nil {
+			p.write(" catch (", expr.Parameter.Value, ") ")
+			p.block(expr.Catch)
+		}
+		if expr.Finally != nil {
+			p.write(" finally ")
+			p.block(expr.Finally)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn")
+		if expr.Name != nil {
+			p.write(" " + expr.Name.Value)
+		}
+		p.write("(")
+		for i, param := range expr.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			if expr.Variadic && i == len(expr.Parameters)-1 {
+				p.write("...")
+			}
+			p.write(param.Value)
+			if t := expr.ParameterType(i); t != nil {
+				p.write(": ", t.String())
+			}
+			if d := expr.Default(i); d != nil {
+				p.write(" = ")
+				p.expression(d)
+			}
+		}
+		p.write(") ")
+		if expr.ReturnType != nil {
+			p.write("-> ", expr.ReturnType.String(), " ")
+		}
+		p.block(expr.Body)
+	case *ast.CallExpression:
+		p.operand(expr.Function, parser.CALL)
+		p.write("(")
+		p.expressionList(expr.Arguments)
+		p.write(")")
+	case *ast.SpreadExpression:
+		p.write("...")
+		p.expression(expr.Value)
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(expr.Elements)
+		p.write("]")
+	case *ast.IndexExpression:
+		p.operand(expr.Left, parser.CALL)
+		if field, ok := expr.Index.(*ast.StringLiteral); ok && expr.Token.Type == token.OPTIONAL_FIELD {
+			p.write("?.", field.Value)
+			break
+		}
+		if expr.Optional() {
+			p.write("?")
+		}
+		p.write("[")
+		p.expression(expr.Index)
+		p.write("]")
+	case *ast.SliceExpression:
+		p.operand(expr.Left, parser.CALL)
+		p.write(expr.Token.Literal)
+		if expr.Low != nil {
+			p.expression(expr.Low)
+		}
+		p.write(":")
+		if expr.High != nil {
+			p.expression(expr.High)
+		}
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, key := range expr.Keys() {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(key)
+			p.write(": ")
+			p.expression(expr.Pairs[key])
+		}
+		p.write("}")
+	case *ast.MatchExpression:
+		// One arm per line, each followed by a comma
+		p.write("match (")
+		p.expression(expr.Value)
+		p.write(") {")
+		if len(expr.Arms) == 0 {
+			p.write("}")
+			return
+		}
+		p.write("\n")
+		closing := p.closingBrace(ast.FirstToken(expr.Arms[0]).Pos.Offset)
+		p.indent++
+		for _, arm := range expr.Arms {
+			p.flushComments(ast.FirstToken(arm).Pos.Offset)
+			p.writeIndent()
+			p.pattern(arm.Pattern)
+			if arm.Guard != nil {
+				p.write(" if ")
+				p.expression(arm.Guard)
+			}
+			p.write(" => ")
+			p.expression(arm.Value)
+			p.write(",\n")
+		}
+		p.flushComments(closing.Pos.Offset)
+		p.indent--
+		p.writeIndent()
+		p.write("}")
+	}
+}
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		p.write(pattern.Value)
+	case *ast.WildcardPattern:
+		p.write("_")
+	case *ast.LiteralPattern:
+		p.expression(pattern.Value)
+	case *ast.ArrayPattern:
+		p.write("[")
+		for i, el := range pattern.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(el)
+		}
+		if pattern.Rest != nil {
+			if len(pattern.Elements) > 0 {
+				p.write(", ")
+			}
+			p.write("...")
+			p.pattern(pattern.Rest)
+		}
+		p.write("]")
+	case *ast.HashPattern:
+		p.write("{")
+		for i, key := range pattern.Keys {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(key)
+			p.write(": ")
+			p.pattern(pattern.Values[i])
+		}
+		p.write("}")
+	}
+}
+
+func (p *printer) expressionList(exprs []ast.Expression) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(expr)
+	}
+}
+
+// Prints the operand of an operator binding with the given precedence,
+// surrounded by parentheses when the operand binds less tightly.
+func (p *printer) operand(expr ast.Expression, precedence int) {
+	if precedenceOf(expr) >= precedence {
+		p.expression(expr)
+		return
+	}
+	p.write("(")
+	p.expression(expr)
+	p.write(")")
+}
+
+// Returns how tightly the expression binds its operands.
+// Expressions without operators never need parentheses.
+// Calls and index expressions are applied from left to right, so they may hold one another without parentheses.
+func precedenceOf(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.InfixExpression:
+		return parser.Precedence(expr.Token.Type)
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.SliceExpression:
+		return parser.INDEX
+	}
+	return parser.INDEX + 1
+}
+
+func (p *printer) write(s ...string) {
+	for _, part := range s {
+		p.out.WriteString(part)
+	}
+}
+
+func (p *printer) writeIndent() {
+	p.out.WriteString(strings.Repeat("\t", p.indent))
+}
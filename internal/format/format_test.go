@@ -0,0 +1,128 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5;", "let x = 5;\n"},
+		{"let   add = fn(a,b){return a+b;};", "let add = fn(a, b) {\n\treturn a + b;\n};\n"},
+		{"puts(add(2 ,3));", "puts(add(2, 3));\n"},
+		{"let f = fn() {};", "let f = fn() {};\n"},
+		{"if(x>y){x;}else{y;};", "if (x > y) {\n\tx;\n} else {\n\ty;\n};\n"},
+		{"if (x) { if (y) { return 1; }; };", "if (x) {\n\tif (y) {\n\t\treturn 1;\n\t};\n};\n"},
+		{`let h = {"a":1,"b" : [1,2], 3: true};`, "let h = {\"a\": 1, \"b\": [1, 2], 3: true};\n"},
+		{"let h = {};", "let h = {};\n"},
+		{"let a = [ ];", "let a = [];\n"},
+		{"people[0][\"name\"];", "people[0][\"name\"];\n"},
+
+		// Parentheses are only kept where precedence requires them
+		{"((1 + 2)) * 3;", "(1 + 2) * 3;\n"},
+		{"(1 * 2) + 3;", "1 * 2 + 3;\n"},
+		{"(a - b) - c;", "a - b - c;\n"},
+		{"a - (b - c);", "a - (b - c);\n"},
+		{"a / (b * c);", "a / (b * c);\n"},
+		{"(a < b) == (c > d);", "a < b == c > d;\n"},
+		{"(a == b) == c;", "a == b == c;\n"},
+		{"-(a + b) * !(c);", "-(a + b) * !c;\n"},
+		{"!(-a);", "!-a;\n"},
+		{"(f(1))[0];", "f(1)[0];\n"},
+		{"(a[0])(1);", "a[0](1);\n"},
+		{"(a + b)(1);", "(a + b)(1);\n"},
+		{"(-a)[0];", "(-a)[0];\n"},
+		{"(fn(x) { x; })(5);", "fn(x) {\n\tx;\n}(5);\n"},
+		{"let x=try{f();}catch(e){throw e;}finally{g();};", "let x = try {\n\tf();\n} catch (e) {\n\tthrow e;\n} finally {\n\tg();\n};\n"},
+		{"try {} finally {};", "try {} finally {};\n"},
+		{"let s=`a  ${x+1} b ${ `${y}` }`;", "let s = `a  ${x + 1} b ${`${y}`}`;\n"},
+		{"let f = fn   fib(n){fib(n-1);};", "let f = fn fib(n) {\n\tfib(n - 1);\n};\n"},
+
+		// Type annotations
+		{"let x:int=5;", "let x: int = 5;\n"},
+		{"let add = fn(a:int,b)->int{a+b;};", "let add = fn(a: int, b) -> int {\n\ta + b;\n};\n"},
+		{"let f = fn(a,b:int=1+2,...rest){f(...rest,a);};", "let f = fn(a, b: int = 1 + 2, ...rest) {\n\tf(...rest, a);\n};\n"},
+		{"let h: {string:[int]} = {};", "let h: {string: [int]} = {};\n"},
+		{"let f: fn( int,bool )->fn()->null = g;", "let f: fn(int, bool) -> fn() -> null = g;\n"},
+
+		// Match expressions
+		{"match(x){1=>a,n if n>1=>b,_=>c};", "match (x) {\n\t1 => a,\n\tn if n > 1 => b,\n\t_ => c,\n};\n"},
+		{"let f = fn(xs) { match (xs) { [ ] => 0, [x,...rest] => x, {\"a\":-1} => 2 }; };",
+			"let f = fn(xs) {\n\tmatch (xs) {\n\t\t[] => 0,\n\t\t[x, ...rest] => x,\n\t\t{\"a\": -1} => 2,\n\t};\n};\n"},
+		{"match (x) {};", "match (x) {};\n"},
+		{"let [a,b,...rest]:[int]=xs;", "let [a, b, ...rest]: [int] = xs;\n"},
+		{"let {\"name\":n,\"tags\":[t]}=person;", "let {\"name\": n, \"tags\": [t]} = person;\n"},
+		{"match (x) {\n  // one\n  1 => a,\n  _ => b, // other\n};", "match (x) {\n\t// one\n\t1 => a,\n\t_ => b, // other\n};\n"},
+
+		{"h?.address ?.city??\"x\";", "h?.address?.city ?? \"x\";\n"},
+		{"xs ?[0]?[1] ?? a??b;", "xs?[0]?[1] ?? a ?? b;\n"},
+
+		{"xs[ 1 :i+1 ]; s[:-1]; s [2:]; xs?[:]; f()[1:][0];", "xs[1:i + 1];\ns[:-1];\ns[2:];\nxs?[:];\nf()[1:][0];\n"},
+
+		// Layout and comments
+		{"let x = 1;\n\n\n\nlet y = 2;\nlet z = 3;", "let x = 1;\n\nlet y = 2;\nlet z = 3;\n"},
+		{"\n\nlet x = 1;\n\n", "let x = 1;\n"},
+		{"// header\n\n// about x\nlet x = 1; // one\nx;\n// footer", "// header\n\n// about x\nlet x = 1; // one\nx;\n// footer\n"},
+		{"let f = fn(x) { // doubles x\n  x * 2;\n\n  // unreachable\n};", "let f = fn(x) { // doubles x\n\tx * 2;\n\n\t// unreachable\n};\n"},
+		{"let f = fn() {\n// todo\n};", "let f = fn() {\n\t// todo\n};\n"},
+		{"let f = fn() { // todo\n};", "let f = fn() { // todo\n};\n"},
+		{"let a = [1, // one\n  2];\nlet b = 3;", "let a = [1, 2]; // one\nlet b = 3;\n"},
+		{"let x = 10 / 2; // half", "let x = 10 / 2; // half\n"},
+		{"// only a comment", "// only a comment\n"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		formatted, diagnostics := Source(tt.input)
+		if len(diagnostics) != 0 {
+			t.Errorf("unexpected diagnostics for %q: %v", tt.input, diagnostics)
+			continue
+		}
+		if formatted != tt.expected {
+			t.Errorf("wrong formatting of %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		again, _ := Source(formatted)
+		if again != formatted {
+			t.Errorf("formatting is not idempotent for %q.\nfirst=%q\nsecond=%q", tt.input, formatted, again)
+		}
+	}
+}
+
+func TestSourceWithErrors(t *testing.T) {
+	formatted, diagnostics := Source("let x = add(1, 2;")
+	if formatted != "" {
+		t.Errorf("programs with errors shouldn't be formatted. got=%q", formatted)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Code != "unexpected-token" {
+		t.Errorf("wrong diagnostics. got=%v", diagnostics)
+	}
+}
+
+func TestExamplesAreIdempotent(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.ybml")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		formatted, diagnostics := Source(string(contents))
+		if len(diagnostics) != 0 {
+			t.Errorf("%s: unexpected diagnostics: %v", file, diagnostics)
+			continue
+		}
+		if again, _ := Source(formatted); again != formatted {
+			t.Errorf("%s: formatting is not idempotent.\nfirst=%q\nsecond=%q", file, formatted, again)
+		}
+	}
+}
@@ -2,34 +2,59 @@
 // The lexer (lexical analyzer) reads the input string character by character, identifying tokens such as identifiers,
 // keywords, operators, and literals, and creating corresponding tokens.
 // Each token has a type and a literal value associated with it.
+// Problems found while tokenizing (illegal characters, unterminated strings)
+// are collected as diagnostics.
+// Template strings are split into the text around their embedded values: the lexer
+// remembers the braces opened within each value, so that the `}` closing the value
+// resumes the text of the template.
+// Line comments, starting with `//` and running up to the end of the line, are skipped
+// and collected separately, so that tools like the formatter can put them back.
 package lexer
 
-import "YARTBML/token"
+import (
+	"YARTBML/diagnostic"
+	"YARTBML/token"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of the current char
+	lineStart    int  // position in input where the current line starts
+
+	errors    []diagnostic.Diagnostic // Problems found while tokenizing
+	comments  []token.Token           // Comments skipped while tokenizing
+	templates []int                   // Braces left open within each embedded template value, innermost last
 }
 
 // Initialize a new Lexer with the given program contents as a string input.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 // Reads the next character from the input string
 // and advances the lexer's position.
+// Moving past a newline advances the lexer to the next line.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
 		l.ch = l.input[l.readPosition]
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	if l.position > len(l.input) {
+		l.position = len(l.input)
+	}
+	l.readPosition = l.position + 1
 }
 
 // Create a new token with the given `TokenType` and character.
@@ -37,10 +62,20 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// Returns the position of the current character.
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Offset: l.position,
+		Line:   l.line,
+		Column: l.position - l.lineStart + 1,
+	}
+}
+
 // Returns the NextToken from the input string (program contents).
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	pos := l.currentPosition()
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -48,13 +83,21 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.FAT_ARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "->"}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -65,6 +108,10 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
+		if l.peekChar() == '/' {
+			l.readComment(pos)
+			return l.NextToken()
+		}
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
@@ -81,9 +128,23 @@ func (l *Lexer) NextToken() token.Token {
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '{':
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.templates)
+		if n > 0 && l.templates[n-1] == 0 {
+			l.templates = l.templates[:n-1]
+			tok = l.readTemplate(pos, token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL)
+			break
+		}
+		if n > 0 {
+			l.templates[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
+	case '`':
+		tok = l.readTemplate(pos, token.TEMPLATE_HEAD, token.TEMPLATE)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -91,28 +152,95 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
+		if l.ch == 0 {
+			span := diagnostic.Span{Start: pos, End: l.currentPosition()}
+			l.errorAt(span, "unterminated-string", "unterminated string literal")
+		}
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '?':
+		switch l.peekChar() {
+		case '[':
+			l.readChar()
+			tok = token.Token{Type: token.OPTIONAL_INDEX, Literal: "?["}
+		case '.':
+			l.readChar()
+			tok = token.Token{Type: token.OPTIONAL_FIELD, Literal: "?."}
+		case '?':
+			l.readChar()
+			tok = token.Token{Type: token.COALESCE, Literal: "??"}
+		default:
+			tok = l.illegal(pos)
+		}
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = l.illegal(pos)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
+		tok.Pos = pos
+		tok.End = pos
+		return tok
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
+			tok.End = l.currentPosition()
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Pos = pos
+			tok.End = l.currentPosition()
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = l.illegal(pos)
 		}
 	}
 	l.readChar()
+	tok.Pos = pos
+	tok.End = l.currentPosition()
 	return tok
 }
 
+// Reports the current character, found at the position, as illegal
+func (l *Lexer) illegal(pos token.Position) token.Token {
+	end := token.Position{Offset: pos.Offset + 1, Line: pos.Line, Column: pos.Column + 1}
+	l.errorAt(diagnostic.Span{Start: pos, End: end}, "illegal-character", "illegal character %q", l.ch)
+	return newToken(token.ILLEGAL, l.ch)
+}
+
+// Returns every problem found so far while tokenizing.
+func (l *Lexer) Errors() []diagnostic.Diagnostic {
+	return l.errors
+}
+
+// Returns every comment skipped so far, in the order they appear within the input.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// Reads a line comment up to the end of the line, without the newline.
+func (l *Lexer) readComment(pos token.Position) {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	literal := strings.TrimSuffix(l.input[pos.Offset:l.position], "\r")
+	end := token.Position{Offset: pos.Offset + len(literal), Line: pos.Line, Column: pos.Column + len(literal)}
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: literal, Pos: pos, End: end})
+}
+
+// Records a problem found within the given span of the input.
+func (l *Lexer) errorAt(span diagnostic.Span, code string, format string, a ...interface{}) {
+	l.errors = append(l.errors, diagnostic.Errorf(span, code, format, a...))
+}
+
 // When a series of letters are encountered, the assumption
 // is that unless if it is a keyword, then it reads it as an
 // identifier token.
@@ -162,6 +290,30 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// Reads the text of a template string, from the backtick or the `}` under the lexer
+// up to the closing backtick or the `${` starting an embedded value.
+// The token is of the part type when the text is followed by a value, and of the end type otherwise.
+func (l *Lexer) readTemplate(pos token.Position, part token.TokenType, end token.TokenType) token.Token {
+	position := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == '$' && l.peekChar() == '{' {
+			literal := l.input[position:l.position]
+			l.readChar()
+			l.templates = append(l.templates, 0)
+			return token.Token{Type: part, Literal: literal}
+		}
+		if l.ch == '`' || l.ch == 0 {
+			break
+		}
+	}
+	if l.ch == 0 {
+		span := diagnostic.Span{Start: pos, End: l.currentPosition()}
+		l.errorAt(span, "unterminated-string", "unterminated template string")
+	}
+	return token.Token{Type: end, Literal: l.input[position:l.position]}
+}
+
 // Reads a string literal from the input, starting and ending with quotation mark
 // Handles reading characters until another quote reaches end of file
 func (l *Lexer) readString() string {
@@ -30,6 +30,10 @@ func TestNextToken(t *testing.T) {
 		"foo bar"
 		[1, 2];
 		{"foo": "bar"}
+		fn(a: int) -> int
+		match (x) { [_, ...t] => 1 }
+		a?.b?[0] ?? c
+		x in s
 		`
 	tests := []struct {
 		expectedType    token.TokenType
@@ -121,6 +125,39 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENT, "int"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "_"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "t"},
+		{token.RBRACKET, "]"},
+		{token.FAT_ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "a"},
+		{token.OPTIONAL_FIELD, "?."},
+		{token.IDENT, "b"},
+		{token.OPTIONAL_INDEX, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "c"},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "s"},
 		{token.EOF, ""},
 	}
 
@@ -139,3 +176,156 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let five = 5;\n\tlet s = \"foo\";\r\nfive == 5"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, token.Position{Offset: 9, Line: 1, Column: 10}},
+		{token.INT, token.Position{Offset: 11, Line: 1, Column: 12}},
+		{token.SEMICOLON, token.Position{Offset: 12, Line: 1, Column: 13}},
+		{token.LET, token.Position{Offset: 15, Line: 2, Column: 2}},
+		{token.IDENT, token.Position{Offset: 19, Line: 2, Column: 6}},
+		{token.ASSIGN, token.Position{Offset: 21, Line: 2, Column: 8}},
+		{token.STRING, token.Position{Offset: 23, Line: 2, Column: 10}},
+		{token.SEMICOLON, token.Position{Offset: 28, Line: 2, Column: 15}},
+		{token.IDENT, token.Position{Offset: 31, Line: 3, Column: 1}},
+		{token.EQ, token.Position{Offset: 36, Line: 3, Column: 6}},
+		{token.INT, token.Position{Offset: 39, Line: 3, Column: 9}},
+		{token.EOF, token.Position{Offset: 40, Line: 3, Column: 10}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+		expectedMsg  string
+		expectedSpan string
+	}{
+		{"let x = @;", "illegal-character", "illegal character '@'", "1:9-1:10"},
+		{"x.y;", "illegal-character", "illegal character '.'", "1:2-1:3"},
+		{"x ? y;", "illegal-character", "illegal character '?'", "1:3-1:4"},
+		{"let s = \"abc", "unterminated-string", "unterminated string literal", "1:9-1:13"},
+		{"let s = `abc${x}", "unterminated-string", "unterminated template string", "1:16-1:17"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("wrong number of errors for %q. got=%d", tt.input, len(errors))
+		}
+		err := errors[0]
+		if err.Code != tt.expectedCode || err.Message != tt.expectedMsg {
+			t.Errorf("wrong error. expected=%s %q, got=%s %q",
+				tt.expectedCode, tt.expectedMsg, err.Code, err.Message)
+		}
+		if span := err.Span.Start.String() + "-" + err.Span.End.String(); span != tt.expectedSpan {
+			t.Errorf("wrong span. expected=%s, got=%s", tt.expectedSpan, span)
+		}
+	}
+}
+
+func TestTemplateStrings(t *testing.T) {
+	input := "`a ${x} b ${ {\"k\": `${y}`}[\"k\"] }` `${}` `$ {x}`"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{token.TEMPLATE_HEAD, "a ", "1:1"},
+		{token.IDENT, "x", "1:6"},
+		{token.TEMPLATE_MIDDLE, " b ", "1:7"},
+		{token.LBRACE, "{", "1:14"},
+		{token.STRING, "k", "1:15"},
+		{token.COLON, ":", "1:18"},
+		{token.TEMPLATE_HEAD, "", "1:20"},
+		{token.IDENT, "y", "1:23"},
+		{token.TEMPLATE_TAIL, "", "1:24"},
+		{token.RBRACE, "}", "1:26"},
+		{token.LBRACKET, "[", "1:27"},
+		{token.STRING, "k", "1:28"},
+		{token.RBRACKET, "]", "1:31"},
+		{token.TEMPLATE_TAIL, "", "1:33"},
+		{token.TEMPLATE_HEAD, "", "1:36"},
+		{token.TEMPLATE_TAIL, "", "1:39"},
+		{token.TEMPLATE, "$ {x}", "1:42"},
+		{token.EOF, "", "1:49"},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral || tok.Pos.String() != tt.expectedPos {
+			t.Fatalf("tests[%d] wrong. expected=%s %q at %s, got=%s %q at %s",
+				i, tt.expectedType, tt.expectedLiteral, tt.expectedPos, tok.Type, tok.Literal, tok.Pos)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// leading comment\nlet x = 10 / 2; // trailing comment\r\n//\nx;"
+
+	expectedTokens := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON,
+		token.IDENT, token.SEMICOLON, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []struct {
+		literal string
+		pos     string
+		end     string
+	}{
+		{"// leading comment", "1:1", "1:19"},
+		{"// trailing comment", "2:17", "2:36"},
+		{"//", "3:1", "3:3"},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		c := comments[i]
+		if c.Type != token.COMMENT || c.Literal != expected.literal ||
+			c.Pos.String() != expected.pos || c.End.String() != expected.end {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected, c)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package lint checks YARTBML programs for likely mistakes that the parser accepts,
+// like unused bindings or unreachable code, and reports them as diagnostics.
+//
+// Every check is a rule registered under a name, which is also the code of the diagnostics it reports.
+// The severity of each rule can be configured, and rules can be turned off entirely.
+// Diagnostics can be suppressed with comments naming the rules to silence:
+//
+//	// lint:ignore unused-binding
+//	let x = 5; // lint:ignore shadowed-name, unused-binding
+//
+// A `lint:ignore` comment ending a line of code silences the diagnostics reported on that line,
+// while one on a line of its own silences the diagnostics of the next line.
+// `// lint:file-ignore <rules>` silences them in the whole program.
+// Without any rule name, every rule is silenced.
+package lint
+
+import (
+	"YARTBML/ast"
+	"YARTBML/diagnostic"
+	"YARTBML/lexer"
+	"YARTBML/parser"
+	"YARTBML/symbols"
+	"YARTBML/token"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity turning a rule off
+const OFF diagnostic.Severity = "off"
+
+// Prefixes of the comments suppressing diagnostics
+const (
+	IGNORE_PREFIX      = "lint:ignore"
+	FILE_IGNORE_PREFIX = "lint:file-ignore"
+)
+
+// A rule checks programs for one kind of problem
+type Rule struct {
+	Name        string              // Code of the diagnostics reported by the rule, e.g. `unused-binding`
+	Description string              // One line description of the problem found by the rule
+	Severity    diagnostic.Severity // Default severity of the diagnostics reported by the rule
+	Check       func(pass *Pass)
+}
+
+// Pass holds the program checked by a rule and collects the diagnostics it reports
+type Pass struct {
+	Program     *ast.Program
+	Symbols     *symbols.Table
+	rule        *Rule
+	severity    diagnostic.Severity
+	diagnostics []diagnostic.Diagnostic
+}
+
+// Reports a problem found within the span of the program.
+// Returns the diagnostic so that related notes can be attached to it.
+func (p *Pass) Report(span diagnostic.Span, format string, a ...interface{}) *diagnostic.Diagnostic {
+	d := diagnostic.Errorf(span, p.rule.Name, format, a...)
+	d.Severity = p.severity
+	p.diagnostics = append(p.diagnostics, d)
+	return &p.diagnostics[len(p.diagnostics)-1]
+}
+
+// Rules by name
+var registry = map[string]*Rule{}
+
+// Registers the rule, so that it's checked by every run of the linter
+func Register(rule *Rule) {
+	if _, ok := registry[rule.Name]; ok {
+		panic("lint: rule registered twice: " + rule.Name)
+	}
+	registry[rule.Name] = rule
+}
+
+// Returns every registered rule, sorted by name
+func Rules() []*Rule {
+	rules := make([]*Rule, 0, len(registry))
+	for _, rule := range registry {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// Config overrides the default severity of rules by name.
+// Rules configured with the OFF severity aren't checked.
+//
+// Configurations are written as JSON:
+//
+//	{"rules": {"unused-binding": "error", "shadowed-name": "off"}}
+type Config map[string]diagnostic.Severity
+
+// Parses a JSON configuration
+func ParseConfig(data []byte) (Config, error) {
+	var file struct {
+		Rules map[string]diagnostic.Severity `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	config := Config{}
+	for name, severity := range file.Rules {
+		if err := config.configure(name, severity); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// Sets the severity of a rule given as `name=severity`, so that a Config can be used as a flag.
+func (c Config) Set(value string) error {
+	name, severity, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected rule=severity, got %q", value)
+	}
+	return c.configure(strings.TrimSpace(name), diagnostic.Severity(strings.TrimSpace(severity)))
+}
+
+func (c Config) String() string {
+	settings := []string{}
+	for name, severity := range c {
+		settings = append(settings, name+"="+string(severity))
+	}
+	sort.Strings(settings)
+	return strings.Join(settings, ",")
+}
+
+func (c Config) configure(name string, severity diagnostic.Severity) error {
+	if _, ok := registry[name]; !ok {
+		return fmt.Errorf("unknown rule: %s", name)
+	}
+	switch severity {
+	case diagnostic.ERROR, diagnostic.WARNING, diagnostic.INFO, diagnostic.HINT, OFF:
+		c[name] = severity
+		return nil
+	}
+	return fmt.Errorf("unknown severity for %s: %s", name, severity)
+}
+
+// Returns the severity of the rule within the configuration
+func (c Config) severity(rule *Rule) diagnostic.Severity {
+	if severity, ok := c[rule.Name]; ok {
+		return severity
+	}
+	return rule.Severity
+}
+
+// Lints the source of a program.
+// Programs that can't be parsed aren't linted: the diagnostics of the parser are returned instead.
+func Source(source string, config Config) []diagnostic.Diagnostic {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return p.Errors()
+	}
+	return Program(source, program, config)
+}
+
+// Lints the program parsed from the source, whose comments may suppress diagnostics.
+func Program(source string, program *ast.Program, config Config) []diagnostic.Diagnostic {
+	table := symbols.Resolve(program)
+
+	diagnostics := []diagnostic.Diagnostic{}
+	for _, rule := range Rules() {
+		severity := config.severity(rule)
+		if severity == OFF {
+			continue
+		}
+
+		pass := &Pass{Program: program, Symbols: table, rule: rule, severity: severity}
+		rule.Check(pass)
+		diagnostics = append(diagnostics, pass.diagnostics...)
+	}
+
+	diagnostics = suppress(diagnostics, suppressions(source))
+	diagnostic.Sort(diagnostics)
+	return diagnostics
+}
+
+// A comment silencing rules
+type suppression struct {
+	rules     []string // Empty for every rule
+	line      int      // Line whose diagnostics are silenced
+	wholeFile bool
+}
+
+// Finds the suppression comments of the source.
+// A comment ending a line of code silences that line, a comment on a line of its own silences the next line.
+func suppressions(source string) []suppression {
+	found := []suppression{}
+
+	l := lexer.New(source)
+	seen, previousLine := 0, 0
+	for tok := l.NextToken(); ; tok = l.NextToken() {
+		// Comments are skipped while reading the token following them
+		for _, comment := range l.Comments()[seen:] {
+			text := strings.TrimSpace(strings.TrimPrefix(comment.Literal, "//"))
+			prefix := IGNORE_PREFIX
+			if strings.HasPrefix(text, FILE_IGNORE_PREFIX) {
+				prefix = FILE_IGNORE_PREFIX
+			} else if !strings.HasPrefix(text, IGNORE_PREFIX) {
+				continue
+			}
+
+			s := suppression{
+				rules: strings.FieldsFunc(strings.TrimPrefix(text, prefix), func(r rune) bool {
+					return r == ',' || r == ' ' || r == '\t'
+				}),
+				line:      comment.Pos.Line,
+				wholeFile: prefix == FILE_IGNORE_PREFIX,
+			}
+			if previousLine != comment.Pos.Line {
+				s.line++
+			}
+			found = append(found, s)
+		}
+		seen = len(l.Comments())
+
+		if tok.Type == token.EOF {
+			return found
+		}
+		previousLine = tok.End.Line
+	}
+}
+
+// Drops the diagnostics silenced by suppression comments
+func suppress(diagnostics []diagnostic.Diagnostic, suppressions []suppression) []diagnostic.Diagnostic {
+	silenced := func(d diagnostic.Diagnostic) bool {
+		for _, s := range suppressions {
+			if !s.wholeFile && d.Span.Start.Line != s.line {
+				continue
+			}
+			if len(s.rules) == 0 {
+				return true
+			}
+			for _, rule := range s.rules {
+				if rule == d.Code {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	kept := []diagnostic.Diagnostic{}
+	for _, d := range diagnostics {
+		if !silenced(d) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
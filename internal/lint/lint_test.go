@@ -0,0 +1,238 @@
+package lint
+
+import (
+	"YARTBML/diagnostic"
+	"testing"
+)
+
+// Formats the diagnostics as `severity[code] line:column: message`
+func describe(diagnostics []diagnostic.Diagnostic) []string {
+	described := []string{}
+	for _, d := range diagnostics {
+		described = append(described, string(d.Severity)+"["+d.Code+"] "+d.String())
+	}
+	return described
+}
+
+func testLint(t *testing.T, input string, config Config, expected []string) {
+	t.Helper()
+
+	got := describe(Source(input, config))
+	if len(got) != len(expected) {
+		t.Errorf("wrong number of diagnostics for %q. expected=%d, got=%d\n%q", input, len(expected), len(got), got)
+		return
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("diagnostics[%d] wrong for %q. expected=%q, got=%q", i, input, expected[i], got[i])
+		}
+	}
+}
+
+func TestUnusedBinding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5;", []string{"warning[unused-binding] 1:5: x is declared but never used"}},
+		{"let x = 5; puts(x);", []string{}},
+		{"let _x = 5;", []string{}},
+		{"let f = fn(a, b) { a; }; f(1, 2);", []string{}},
+		{"let f = fn() { let y = 1; 2; }; f();", []string{"warning[unused-binding] 1:20: y is declared but never used"}},
+		{"let x = 1; let x = x + 1;", []string{"warning[unused-binding] 1:16: x is declared but never used"}},
+		{"let f = fn(n) { f(n); };", []string{}},
+	}
+
+	for _, tt := range tests {
+		testLint(t, tt.input, Config{"wrong-arity": OFF}, tt.expected)
+	}
+}
+
+func TestShadowedName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; let f = fn(x) { x; }; f(x);", []string{"warning[shadowed-name] 1:23: x shadows a binding of an enclosing scope"}},
+		{"let x = 1; let f = fn() { let x = 2; x; }; f(); puts(x);", []string{"warning[shadowed-name] 1:31: x shadows a binding of an enclosing scope"}},
+		{"let x = 1; let x = x + 1; puts(x);", []string{}},
+		{"let f = fn(a) { fn(a) { a; }; }; f(1);", []string{"warning[shadowed-name] 1:20: a shadows a binding of an enclosing scope"}},
+		{"let first = fn(a) { a; }; first(1);", []string{"warning[shadowed-name] 1:5: first shadows the builtin function first"}},
+		{"let f = fn(len) { len; }; f(1);", []string{"warning[shadowed-name] 1:12: len shadows the builtin function len"}},
+		{"let fib = fn fib(n) { fib(n - 1); }; fib(1);", []string{}},
+	}
+
+	for _, tt := range tests {
+		testLint(t, tt.input, Config{}, tt.expected)
+	}
+
+	diagnostics := Source("let x = 1; let f = fn(x) { x; }; f(x);", Config{})
+	if len(diagnostics[0].Related) != 1 || diagnostics[0].Related[0].Span.Start.String() != "1:5" ||
+		diagnostics[0].Related[0].Message != "x is declared here" {
+		t.Errorf("wrong related note. got=%+v", diagnostics[0].Related)
+	}
+}
+
+func TestUnreachableCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let f = fn() { return 1; puts(2); 3; }; f();", []string{"warning[unreachable-code] 1:26: unreachable code"}},
+		{"let f = fn() { return 1; }; f();", []string{}},
+		{"let f = fn(x) { if (x) { return 1; let y = 2; }; 3; }; f(1);", []string{
+			"warning[unreachable-code] 1:36: unreachable code",
+			"warning[unused-binding] 1:40: y is declared but never used",
+		}},
+		{"return 1; puts(2);", []string{"warning[unreachable-code] 1:11: unreachable code"}},
+		{"let f = fn() { throw \"a\"; puts(2); }; f();", []string{"warning[unreachable-code] 1:27: unreachable code"}},
+		{"let x = try { if (true) { 1; }; } catch (e) { 2; }; x;", []string{
+			"warning[if-without-else] 1:15: if without else used as a value is null when its condition is false",
+		}},
+		{"try { 1; } catch (e) { 2; } finally { if (true) { 1; }; };", []string{}},
+	}
+
+	for _, tt := range tests {
+		testLint(t, tt.input, Config{}, tt.expected)
+	}
+}
+
+func TestIfWithoutElse(t *testing.T) {
+	message := "if without else used as a value is null when its condition is false"
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = if (true) { 1; }; puts(x);", []string{"warning[if-without-else] 1:9: " + message}},
+		{"let x = if (true) { 1; } else { 2; }; puts(x);", []string{}},
+		{"if (true) { puts(1); };", []string{}},
+		{"puts(if (true) { 1; });", []string{"warning[if-without-else] 1:6: " + message}},
+		{"let f = fn(x) { return if (x) { 1; }; }; f(1);", []string{"warning[if-without-else] 1:24: " + message}},
+		{"let f = fn(x) { if (x) { puts(x); }; }; f(1);", []string{}},
+		{"let x = if (true) { if (false) { 1; }; } else { 2; }; puts(x);", []string{"warning[if-without-else] 1:21: " + message}},
+		{"let x = if (true) { if (false) { 1; }; 2; } else { 3; }; puts(x);", []string{}},
+		{"let x = 1 + if (true) { 1; }; puts(x);", []string{"warning[if-without-else] 1:13: " + message}},
+		{"let v = match (1) { _ => if (true) { 1; } }; puts(v);", []string{"warning[if-without-else] 1:26: " + message}},
+		{"match (1) { _ => if (true) { puts(1); } };", []string{}},
+		{"match (if (true) { 1; }) { _ => 0 };", []string{"warning[if-without-else] 1:8: " + message}},
+		{"puts(`a${if (true) { 1; }}`);", []string{"warning[if-without-else] 1:10: " + message}},
+		{"puts(...if (true) { [1]; });", []string{"warning[if-without-else] 1:9: " + message}},
+	}
+
+	for _, tt := range tests {
+		testLint(t, tt.input, Config{}, tt.expected)
+	}
+}
+
+func TestWrongArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let add = fn(a, b) { a + b; }; add(1);", []string{"error[wrong-arity] 1:32: add expects 2 arguments, got 1"}},
+		{"let add = fn(a, b) { a + b; }; add(1, 2);", []string{}},
+		{"let one = fn(a) { a; }; one();", []string{"error[wrong-arity] 1:25: one expects 1 argument, got 0"}},
+		{"len([1], [2]);", []string{"error[wrong-arity] 1:1: len expects 1 argument, got 2"}},
+		{"now(1);", []string{"error[wrong-arity] 1:1: now expects 0 arguments, got 1"}},
+		{"puts(1, 2, 3);", []string{}},
+		{"fn(x) { x; }(1, 2);", []string{"error[wrong-arity] 1:1: function expects 1 argument, got 2"}},
+		{"let f = fn(g) { g(1, 2); }; f(len);", []string{}},
+		{"unknown(1);", []string{}},
+		{"let add = fn(a, b = 1) { a + b; }; add(1); add(1, 2);", []string{}},
+		{"let add = fn(a, b = 1) { a + b; }; add();", []string{"error[wrong-arity] 1:36: add expects 1 to 2 arguments, got 0"}},
+		{"let f = fn(a, ...b) { a; }; f(1, 2, 3);", []string{}},
+		{"let f = fn(a, ...b) { a; }; f();", []string{"error[wrong-arity] 1:29: f expects at least 1 argument, got 0"}},
+		{"let add = fn(a, b) { a + b; }; add(...[1, 2]); len(1, ...[]);", []string{}},
+	}
+
+	for _, tt := range tests {
+		testLint(t, tt.input, Config{}, tt.expected)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	input := "let x = 5; len();"
+
+	testLint(t, input, Config{}, []string{
+		"warning[unused-binding] 1:5: x is declared but never used",
+		"error[wrong-arity] 1:12: len expects 1 argument, got 0",
+	})
+	testLint(t, input, Config{"unused-binding": diagnostic.ERROR, "wrong-arity": OFF}, []string{
+		"error[unused-binding] 1:5: x is declared but never used",
+	})
+
+	config, err := ParseConfig([]byte(`{"rules": {"unused-binding": "off", "wrong-arity": "warning"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLint(t, input, config, []string{"warning[wrong-arity] 1:12: len expects 1 argument, got 0"})
+
+	flag := Config{}
+	if err := flag.Set("unused-binding=hint"); err != nil || flag["unused-binding"] != diagnostic.HINT {
+		t.Errorf("rule not configured by Set. got=%v (%v)", flag, err)
+	}
+
+	for _, invalid := range []string{
+		`{"rules": {"no-such-rule": "error"}}`,
+		`{"rules": {"unused-binding": "fatal"}}`,
+		`{"rules": ["unused-binding"]}`,
+	} {
+		if _, err := ParseConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for the configuration %s", invalid)
+		}
+	}
+	if err := flag.Set("unused-binding"); err == nil {
+		t.Errorf("expected an error for a setting without severity")
+	}
+}
+
+func TestSuppressionComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 5; // lint:ignore unused-binding", []string{}},
+		{"// lint:ignore unused-binding\nlet x = 5;", []string{}},
+		{"// lint:ignore\nlet x = 5; len();", []string{}},
+		{"// lint:ignore wrong-arity\nlet x = 5; len();", []string{"warning[unused-binding] 2:5: x is declared but never used"}},
+		{"// lint:ignore unused-binding\n\nlet x = 5;", []string{"warning[unused-binding] 3:5: x is declared but never used"}},
+		{"let x = 5;\n  // lint:ignore unused-binding\nlet y = 6; puts(y);", []string{"warning[unused-binding] 1:5: x is declared but never used"}},
+		{"let x = 5; // lint:ignore shadowed-name, unused-binding\nlet y = 6;", []string{"warning[unused-binding] 2:5: y is declared but never used"}},
+		{"// lint:file-ignore unused-binding\nlet x = 5;\nlet y = 6; len();", []string{"error[wrong-arity] 3:12: len expects 1 argument, got 0"}},
+	}
+
+	for _, tt := range tests {
+		testLint(t, tt.input, Config{}, tt.expected)
+	}
+}
+
+func TestParserErrorsAreReported(t *testing.T) {
+	testLint(t, "let x = ;", Config{}, []string{"error[expected-expression] 1:9: no prefix parse function for ; found"})
+}
+
+func TestRegistry(t *testing.T) {
+	names := []string{}
+	for _, rule := range Rules() {
+		names = append(names, rule.Name)
+		if rule.Description == "" || rule.Severity == "" || rule.Check == nil {
+			t.Errorf("rule %s is incomplete", rule.Name)
+		}
+	}
+
+	expected := []string{"if-without-else", "shadowed-name", "unreachable-code", "unused-binding", "wrong-arity"}
+	if len(names) != len(expected) {
+		t.Fatalf("wrong rules. expected=%v, got=%v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("wrong rules. expected=%v, got=%v", expected, names)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a rule twice should panic")
+		}
+	}()
+	Register(&Rule{Name: "unused-binding"})
+}
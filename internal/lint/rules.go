@@ -0,0 +1,270 @@
+package lint
+
+import (
+	"YARTBML/ast"
+	"YARTBML/diagnostic"
+	"YARTBML/evaluator"
+	"YARTBML/object"
+	"YARTBML/symbols"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	Register(&Rule{
+		Name:        "unused-binding",
+		Description: "let binding that is never used; prefix its name with _ to keep it",
+		Severity:    diagnostic.WARNING,
+		Check:       checkUnusedBindings,
+	})
+	Register(&Rule{
+		Name:        "shadowed-name",
+		Description: "binding hiding a binding of an enclosing function or a builtin function",
+		Severity:    diagnostic.WARNING,
+		Check:       checkShadowedNames,
+	})
+	Register(&Rule{
+		Name:        "unreachable-code",
+		Description: "statement following a return or throw statement within the same block",
+		Severity:    diagnostic.WARNING,
+		Check:       checkUnreachableCode,
+	})
+	Register(&Rule{
+		Name:        "if-without-else",
+		Description: "if expression without an else branch used as a value, which is null when the condition is false",
+		Severity:    diagnostic.WARNING,
+		Check:       checkIfWithoutElse,
+	})
+	Register(&Rule{
+		Name:        "wrong-arity",
+		Description: "call passing the wrong number of arguments to a known function",
+		Severity:    diagnostic.ERROR,
+		Check:       checkArity,
+	})
+}
+
+// unused-binding
+func checkUnusedBindings(pass *Pass) {
+	for _, s := range pass.Symbols.Scopes {
+		for _, b := range s.Bindings {
+			if b.Kind == symbols.LET && len(b.Refs) == 0 && !strings.HasPrefix(b.Name.Value, "_") {
+				pass.Report(diagnostic.TokenSpan(b.Name.Token), "%s is declared but never used", b.Name.Value)
+			}
+		}
+	}
+}
+
+// shadowed-name
+// Binding a name again within the same scope isn't shadowing: `let x = x + 1;` updates x.
+func checkShadowedNames(pass *Pass) {
+	for _, s := range pass.Symbols.Scopes {
+		for _, b := range s.Bindings {
+			name := b.Name.Value
+			if b.Kind == symbols.FUNCTION {
+				// Naming a function after the binding holding it is how it's meant to be used
+				continue
+			}
+			if shadowed := s.Outer.Lookup(name); len(shadowed) > 0 {
+				d := pass.Report(diagnostic.TokenSpan(b.Name.Token), "%s shadows a binding of an enclosing scope", name)
+				d.Related = append(d.Related, diagnostic.Note{
+					Message: name + " is declared here",
+					Span:    diagnostic.TokenSpan(shadowed[0].Name.Token),
+				})
+			} else if _, ok := evaluator.LookupBuiltin(name); ok {
+				pass.Report(diagnostic.TokenSpan(b.Name.Token), "%s shadows the builtin function %s", name, name)
+			}
+		}
+	}
+}
+
+// unreachable-code
+func checkUnreachableCode(pass *Pass) {
+	check := func(statements []ast.Statement) {
+		for i, stmt := range statements {
+			if i == len(statements)-1 {
+				continue
+			}
+			var note diagnostic.Note
+			switch stmt := stmt.(type) {
+			case *ast.ReturnStatement:
+				note = diagnostic.Note{Message: "the block returns here", Span: diagnostic.TokenSpan(stmt.Token)}
+			case *ast.ThrowStatement:
+				note = diagnostic.Note{Message: "the block throws here", Span: diagnostic.TokenSpan(stmt.Token)}
+			default:
+				continue
+			}
+			d := pass.Report(diagnostic.TokenSpan(ast.FirstToken(statements[i+1])), "unreachable code")
+			d.Related = append(d.Related, note)
+			return
+		}
+	}
+
+	check(pass.Program.Statements)
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		if block, ok := node.(*ast.BlockStatement); ok {
+			check(block.Statements)
+		}
+		return true
+	})
+}
+
+// if-without-else
+// An if expression is used as a value when it's bound, returned, passed as an argument or operand,
+// or when it ends a block of an if expression that is itself used as a value.
+// The implicit return of the last statement of a function isn't considered a use,
+// as functions ending with an if statement are usually called for their effects.
+func checkIfWithoutElse(pass *Pass) {
+	c := &valueChecker{pass: pass}
+	for _, stmt := range pass.Program.Statements {
+		c.statement(stmt, false)
+	}
+}
+
+type valueChecker struct {
+	pass *Pass
+}
+
+func (c *valueChecker) statement(stmt ast.Statement, used bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.expression(stmt.Value, true)
+	case *ast.ReturnStatement:
+		c.expression(stmt.ReturnValue, true)
+	case *ast.ThrowStatement:
+		c.expression(stmt.Value, true)
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression, used)
+	}
+}
+
+func (c *valueChecker) block(block *ast.BlockStatement, used bool) {
+	if block == nil {
+		return
+	}
+	for i, stmt := range block.Statements {
+		c.statement(stmt, used && i == len(block.Statements)-1)
+	}
+}
+
+func (c *valueChecker) expression(expr ast.Expression, used bool) {
+	switch expr := expr.(type) {
+	case *ast.IfExpression:
+		if used && expr.ElsePath == nil {
+			c.pass.Report(diagnostic.TokenSpan(expr.Token), "if without else used as a value is null when its condition is false")
+		}
+		c.expression(expr.TestCondition, true)
+		c.block(expr.ThenPath, used)
+		c.block(expr.ElsePath, used)
+	case *ast.TryExpression:
+		c.block(expr.Body, used)
+		c.block(expr.Catch, used)
+		c.block(expr.Finally, false)
+	case *ast.FunctionLiteral:
+		c.block(expr.Body, false)
+	case *ast.PrefixExpression:
+		c.expression(expr.Right, true)
+	case *ast.InfixExpression:
+		c.expression(expr.Left, true)
+		c.expression(expr.Right, true)
+	case *ast.CallExpression:
+		c.expression(expr.Function, true)
+		for _, arg := range expr.Arguments {
+			c.expression(arg, true)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range expr.Elements {
+			c.expression(el, true)
+		}
+	case *ast.IndexExpression:
+		c.expression(expr.Left, true)
+		c.expression(expr.Index, true)
+	case *ast.SliceExpression:
+		c.expression(expr.Left, true)
+		c.expression(expr.Low, true)
+		c.expression(expr.High, true)
+	case *ast.HashLiteral:
+		for _, key := range expr.Keys() {
+			c.expression(key, true)
+			c.expression(expr.Pairs[key], true)
+		}
+	case *ast.MatchExpression:
+		c.expression(expr.Value, true)
+		for _, arm := range expr.Arms {
+			c.expression(arm.Guard, true)
+			c.expression(arm.Value, used)
+		}
+	case *ast.TemplateLiteral:
+		for _, value := range expr.Values {
+			c.expression(value, true)
+		}
+	case *ast.SpreadExpression:
+		c.expression(expr.Value, true)
+	}
+}
+
+// wrong-arity
+// Known functions are the builtins, the function literals bound by let statements and the ones called right away.
+// Calls spreading arguments pass a number of them that isn't known.
+func checkArity(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		for _, arg := range call.Arguments {
+			if _, ok := arg.(*ast.SpreadExpression); ok {
+				return true
+			}
+		}
+
+		name, least, most, declaration := "function", 0, object.VARIADIC, (*ast.Identifier)(nil)
+		switch callee := call.Function.(type) {
+		case *ast.FunctionLiteral:
+			least, most = callee.Arity()
+		case *ast.Identifier:
+			name = callee.Value
+			if b := pass.Symbols.BindingOf(callee); b != nil {
+				if fn, ok := b.Value.(*ast.FunctionLiteral); ok && (b.Kind == symbols.LET || b.Kind == symbols.FUNCTION) {
+					least, most = fn.Arity()
+					declaration = b.Name
+				}
+			} else if builtin, ok := evaluator.LookupBuiltin(callee.Value); ok {
+				least, most = builtin.Arity, builtin.Arity
+			}
+		}
+
+		got := len(call.Arguments)
+		if got >= least && (most == object.VARIADIC || got <= most) {
+			return true
+		}
+
+		d := pass.Report(diagnostic.TokenSpan(ast.FirstToken(call.Function)),
+			"%s expects %s, got %d", name, expectedArguments(least, most), got)
+		if declaration != nil {
+			d.Related = append(d.Related, diagnostic.Note{
+				Message: name + " is declared here",
+				Span:    diagnostic.TokenSpan(declaration.Token),
+			})
+		}
+		return true
+	})
+}
+
+// Describes the number of arguments a function expects, e.g. `2 arguments`, `1 to 2 arguments` or `at least 1 argument`
+func expectedArguments(least, most int) string {
+	switch {
+	case most == object.VARIADIC:
+		return "at least " + plural(least, "argument")
+	case least != most:
+		return fmt.Sprintf("%d to %s", least, plural(most, "argument"))
+	}
+	return plural(least, "argument")
+}
+
+// Returns the count followed by the noun, e.g. `1 argument` or `2 arguments`
+func plural(count int, noun string) string {
+	if count == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
@@ -0,0 +1,123 @@
+package lsp
+
+import (
+	"YARTBML/ast"
+	"YARTBML/checker"
+	"YARTBML/diagnostic"
+	"YARTBML/evaluator"
+	"YARTBML/lexer"
+	"YARTBML/lint"
+	"YARTBML/object"
+	"YARTBML/parser"
+	"YARTBML/symbols"
+	"YARTBML/token"
+)
+
+// Result of analysing a document: its AST, diagnostics and the bindings of its names
+type analysis struct {
+	program     *ast.Program
+	diagnostics []diagnostic.Diagnostic
+	symbols     *symbols.Table
+	extents     map[*symbols.Scope]extent
+}
+
+// Offsets of the first character of a scope and of the character right after its last one.
+// The scope of a function spans from the `fn` keyword up to the brace closing its body.
+type extent struct {
+	start, end int
+}
+
+// Parses the source and resolves the names of the program.
+// Programs without syntax errors are checked for undefined names and type errors, and linted as well.
+func analyze(source string) *analysis {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	a := &analysis{
+		program:     program,
+		diagnostics: p.Errors(),
+		symbols:     symbols.Resolve(program),
+		extents:     map[*symbols.Scope]extent{},
+	}
+	if len(a.diagnostics) == 0 {
+		a.diagnostics = append(evaluator.Resolve(program, object.NewEnvironment()), checker.Check(program)...)
+		a.diagnostics = append(a.diagnostics, lint.Program(source, program, lint.Config{})...)
+		diagnostic.Sort(a.diagnostics)
+	}
+
+	blockEnds := matchBraces(source)
+	for _, s := range a.symbols.Scopes {
+		e := extent{start: 0, end: len(source)}
+		if s.Function != nil {
+			e.start = s.Function.Token.Pos.Offset
+			if s.Function.Body != nil {
+				if end, ok := blockEnds[s.Function.Body.Token.Pos.Offset]; ok {
+					e.end = end
+				}
+			}
+		}
+		a.extents[s] = e
+	}
+
+	return a
+}
+
+// Maps the offset of every `{` to the offset right after its matching `}`.
+// Braces that are never closed extend up to the end of the source.
+func matchBraces(source string) map[int]int {
+	ends := map[int]int{}
+	open := []int{}
+
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE:
+			open = append(open, tok.Pos.Offset)
+		case token.RBRACE:
+			if len(open) > 0 {
+				ends[open[len(open)-1]] = tok.End.Offset
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	for _, offset := range open {
+		ends[offset] = len(source)
+	}
+
+	return ends
+}
+
+// Returns the identifier found at the offset, or nil.
+// An identifier is found when the offset lies within it or right after it.
+func (a *analysis) identifierAt(offset int) *ast.Identifier {
+	for _, ident := range a.symbols.Identifiers {
+		if ident.Token.Pos.Offset <= offset && offset <= ident.Token.End.Offset {
+			return ident
+		}
+	}
+	return nil
+}
+
+// Returns the bindings visible at the offset, innermost first, without the shadowed ones.
+func (a *analysis) bindingsAt(offset int) []*symbols.Binding {
+	var innermost *symbols.Scope
+	for _, s := range a.symbols.Scopes {
+		e := a.extents[s]
+		if e.start <= offset && offset <= e.end && (innermost == nil || e.start >= a.extents[innermost].start) {
+			innermost = s
+		}
+	}
+
+	visible := []*symbols.Binding{}
+	seen := map[string]bool{}
+	for s := innermost; s != nil; s = s.Outer {
+		for i := len(s.Bindings) - 1; i >= 0; i-- {
+			b := s.Bindings[i]
+			if seen[b.Name.Value] || (s == innermost && b.Name.Token.Pos.Offset > offset) {
+				continue
+			}
+			seen[b.Name.Value] = true
+			visible = append(visible, b)
+		}
+	}
+	return visible
+}
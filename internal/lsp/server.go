@@ -0,0 +1,448 @@
+// Package lsp implements a Language Server Protocol server for YARTBML, spoken over stdio by `yartbml lsp`.
+// It reuses the lexer, the parser and the linter to publish the diagnostics of open documents,
+// resolves let bindings and function parameters for go-to-definition and find-references,
+// completes builtins, keywords and bindings, and describes names on hover.
+package lsp
+
+import (
+	"YARTBML/ast"
+	"YARTBML/diagnostic"
+	"YARTBML/evaluator"
+	"YARTBML/symbols"
+	"YARTBML/token"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Name reported as the source of every diagnostic
+const SOURCE = "yartbml"
+
+// Server answers the requests of a single client, reading messages from in and writing them to out.
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// An open document along with the analysis of its latest version
+type document struct {
+	uri        string
+	text       string
+	lineStarts []int // Offset of the first character of every line
+	analysis   *analysis
+}
+
+// Handles the params of a request, returning its result.
+// Handlers of notifications return a nil result, which is never sent.
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":              (*Server).initialize,
+		"initialized":             ignore,
+		"shutdown":                (*Server).shutdownRequest,
+		"textDocument/didOpen":    (*Server).didOpen,
+		"textDocument/didChange":  (*Server).didChange,
+		"textDocument/didClose":   (*Server).didClose,
+		"textDocument/definition": (*Server).definition,
+		"textDocument/references": (*Server).references,
+		"textDocument/completion": (*Server).completion,
+		"textDocument/hover":      (*Server).hover,
+	}
+}
+
+// Creates a server communicating with a client through the given streams
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+}
+
+// Serves the client until it sends the exit notification or closes the input.
+// Returns an error when the client exits without asking the server to shut down first.
+func (s *Server) Run() error {
+	for {
+		content, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			s.replyError(nil, &responseError{Code: PARSE_ERROR, Message: err.Error()})
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit notification received before shutdown")
+			}
+			return nil
+		}
+
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+// Dispatches the request to its handler and replies with the result, unless it's a notification
+func (s *Server) handle(req request) error {
+	isNotification := req.ID == nil
+
+	h, ok := handlers[req.Method]
+	if !ok {
+		if isNotification {
+			return nil
+		}
+		return s.replyError(req.ID, &responseError{Code: METHOD_NOT_FOUND, Message: "method not found: " + req.Method})
+	}
+	if s.shutdown && !isNotification {
+		return s.replyError(req.ID, &responseError{Code: INVALID_REQUEST, Message: "server is shutting down"})
+	}
+
+	result, err := h(s, req.Params)
+	if isNotification {
+		return nil
+	}
+	if err != nil {
+		rerr, ok := err.(*responseError)
+		if !ok {
+			rerr = &responseError{Code: INVALID_PARAMS, Message: err.Error()}
+		}
+		return s.replyError(req.ID, rerr)
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, err *responseError) error {
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func ignore(s *Server, params json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+// Decodes the params of a request
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: INVALID_PARAMS, Message: err.Error()}
+	}
+	return nil
+}
+
+// initialize
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":   1, // Full
+			"definitionProvider": true,
+			"referencesProvider": true,
+			"hoverProvider":      true,
+			"completionProvider": map[string]interface{}{},
+		},
+		"serverInfo": map[string]string{"name": SOURCE},
+	}, nil
+}
+
+// shutdown
+func (s *Server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+// textDocument/didOpen
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+// textDocument/didChange
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+// textDocument/didClose
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+// Analyses the new text of the document and publishes its diagnostics
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+
+	diagnostics := []Diagnostic{}
+	for _, d := range doc.analysis.diagnostics {
+		diagnostics = append(diagnostics, doc.diagnostic(d))
+	}
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// Finds the document and the identifier at the position of the request.
+// The identifier is nil when there is none at the position.
+func (s *Server) identifierAt(p TextDocumentPositionParams) (*document, *ast.Identifier, error) {
+	doc, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, nil, &responseError{Code: INVALID_PARAMS, Message: "unknown document: " + p.TextDocument.URI}
+	}
+	return doc, doc.analysis.identifierAt(doc.offset(p.Position)), nil
+}
+
+// textDocument/definition
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ident, err := s.identifierAt(p)
+	if err != nil || ident == nil {
+		return nil, err
+	}
+
+	b := doc.analysis.symbols.BindingOf(ident)
+	if b == nil {
+		return nil, nil
+	}
+	return doc.location(b.Name.Token), nil
+}
+
+// textDocument/references
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ident, err := s.identifierAt(p.TextDocumentPositionParams)
+	if err != nil || ident == nil {
+		return nil, err
+	}
+
+	locations := []Location{}
+	b := doc.analysis.symbols.BindingOf(ident)
+	if b == nil {
+		return locations, nil
+	}
+	if p.Context.IncludeDeclaration {
+		locations = append(locations, doc.location(b.Name.Token))
+	}
+	for _, ref := range b.Refs {
+		locations = append(locations, doc.location(ref.Token))
+	}
+	return locations, nil
+}
+
+// textDocument/completion
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{Code: INVALID_PARAMS, Message: "unknown document: " + p.TextDocument.URI}
+	}
+
+	items := []CompletionItem{}
+	for _, b := range doc.analysis.bindingsAt(doc.offset(p.Position)) {
+		kind := COMPLETION_VARIABLE
+		if b.Kind == symbols.FUNCTION {
+			kind = COMPLETION_FUNCTION
+		}
+		items = append(items, CompletionItem{Label: b.Name.Value, Kind: kind, Detail: detail(b)})
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		items = append(items, CompletionItem{Label: name, Kind: COMPLETION_FUNCTION, Detail: "builtin"})
+	}
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: COMPLETION_KEYWORD})
+	}
+	return items, nil
+}
+
+// textDocument/hover
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ident, err := s.identifierAt(p)
+	if err != nil || ident == nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	if b := doc.analysis.symbols.BindingOf(ident); b != nil {
+		fmt.Fprintf(&sb, "```yartbml\n%s\n```\n%s", signature(b), detail(b))
+	} else if builtin, ok := evaluator.LookupBuiltin(ident.Value); ok {
+		fmt.Fprintf(&sb, "```yartbml\n%s\n```\nbuiltin function", builtin.Name)
+		if builtin.Capability != "" {
+			fmt.Fprintf(&sb, ", requires the `%s` capability", builtin.Capability)
+		}
+	} else {
+		return nil, nil
+	}
+
+	r := doc.tokenRange(ident.Token)
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: sb.String()}, Range: &r}, nil
+}
+
+// Returns the code describing the binding, e.g. `let x = 5;`
+func signature(b *symbols.Binding) string {
+	if b.Kind == symbols.PARAMETER || b.Kind == symbols.PATTERN || b.Kind == symbols.CAUGHT {
+		return b.Name.Value
+	}
+	value := ""
+	if b.Value != nil {
+		value = b.Value.String()
+	}
+	if b.Kind == symbols.FUNCTION {
+		return value
+	}
+	return "let " + b.Name.Value + " = " + value + ";"
+}
+
+// Returns a short description of the binding
+func detail(b *symbols.Binding) string {
+	if b.Kind == symbols.PARAMETER {
+		params := []string{}
+		for _, param := range b.Function.Parameters {
+			params = append(params, param.Value)
+		}
+		return "parameter of fn(" + strings.Join(params, ", ") + ")"
+	}
+	if b.Kind == symbols.PATTERN {
+		return "bound by a pattern"
+	}
+	if b.Kind == symbols.FUNCTION {
+		return "named function"
+	}
+	if b.Kind == symbols.CAUGHT {
+		return "caught error"
+	}
+	return "let binding"
+}
+
+func newDocument(uri, text string) *document {
+	doc := &document{uri: uri, text: text, lineStarts: []int{0}, analysis: analyze(text)}
+	for i, ch := range text {
+		if ch == '\n' {
+			doc.lineStarts = append(doc.lineStarts, i+1)
+		}
+	}
+	return doc
+}
+
+// Converts a position of the protocol to an offset within the text
+func (doc *document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(doc.lineStarts) {
+		return len(doc.text)
+	}
+
+	offset := doc.lineStarts[p.Line]
+	for units := 0; units < p.Character && offset < len(doc.text); {
+		ch, size := utf8.DecodeRuneInString(doc.text[offset:])
+		if ch == '\n' {
+			break
+		}
+		units += utf16Len(ch)
+		offset += size
+	}
+	return offset
+}
+
+// Converts a position of the lexer to a position of the protocol
+func (doc *document) position(pos token.Position) Position {
+	offset := min(max(pos.Offset, 0), len(doc.text))
+	line := sort.Search(len(doc.lineStarts), func(i int) bool { return doc.lineStarts[i] > offset }) - 1
+
+	character := 0
+	for _, ch := range doc.text[doc.lineStarts[line]:offset] {
+		character += utf16Len(ch)
+	}
+	return Position{Line: line, Character: character}
+}
+
+func (doc *document) spanRange(span diagnostic.Span) Range {
+	return Range{Start: doc.position(span.Start), End: doc.position(span.End)}
+}
+
+func (doc *document) tokenRange(tok token.Token) Range {
+	return doc.spanRange(diagnostic.TokenSpan(tok))
+}
+
+func (doc *document) location(tok token.Token) Location {
+	return Location{URI: doc.uri, Range: doc.tokenRange(tok)}
+}
+
+// Converts a diagnostic of the interpreter to a diagnostic of the protocol
+func (doc *document) diagnostic(d diagnostic.Diagnostic) Diagnostic {
+	converted := Diagnostic{
+		Range:    doc.spanRange(d.Span),
+		Severity: severities[d.Severity],
+		Code:     d.Code,
+		Source:   SOURCE,
+		Message:  d.Message,
+	}
+	for _, note := range d.Related {
+		converted.RelatedInformation = append(converted.RelatedInformation, DiagnosticRelatedInformation{
+			Location: Location{URI: doc.uri, Range: doc.spanRange(note.Span)},
+			Message:  note.Message,
+		})
+	}
+	return converted
+}
+
+var severities = map[diagnostic.Severity]int{
+	diagnostic.ERROR:   SEVERITY_ERROR,
+	diagnostic.WARNING: SEVERITY_WARNING,
+	diagnostic.INFO:    SEVERITY_INFORMATION,
+	diagnostic.HINT:    SEVERITY_HINT,
+}
+
+// Returns the number of UTF-16 code units encoding the rune
+func utf16Len(ch rune) int {
+	if ch >= 0x10000 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,406 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///test.ybml"
+
+// Scripted client driving a server over pipes, the way an editor would
+type testClient struct {
+	t      *testing.T
+	in     io.WriteCloser
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+}
+
+func newTestClient(t *testing.T) *testClient {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	c := &testClient{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+
+	c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, nil)
+	c.notify("initialized", map[string]interface{}{})
+	return c
+}
+
+func (c *testClient) send(message map[string]interface{}) {
+	message["jsonrpc"] = "2.0"
+	if err := writeMessage(c.in, message); err != nil {
+		c.t.Fatalf("could not send message: %s", err)
+	}
+}
+
+// Reads the next message sent by the server
+func (c *testClient) receive() map[string]json.RawMessage {
+	content, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatalf("could not receive message: %s", err)
+	}
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(content, &message); err != nil {
+		c.t.Fatalf("invalid message %s: %s", content, err)
+	}
+	return message
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+// Sends a request and decodes the result of its response into result
+func (c *testClient) request(method string, params interface{}, result interface{}) {
+	c.nextID++
+	c.send(map[string]interface{}{"id": c.nextID, "method": method, "params": params})
+
+	message := c.receive()
+	var id int
+	json.Unmarshal(message["id"], &id)
+	if id != c.nextID {
+		c.t.Fatalf("expected the response to request %d, got=%v", c.nextID, message)
+	}
+	if errMessage, ok := message["error"]; ok {
+		c.t.Fatalf("%s failed: %s", method, errMessage)
+	}
+	if result != nil {
+		if err := json.Unmarshal(message["result"], result); err != nil {
+			c.t.Fatalf("invalid result for %s: %s", method, err)
+		}
+	}
+}
+
+// Opens a document and returns the diagnostics published for it
+func (c *testClient) open(text string) []Diagnostic {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "ybml", Version: 1, Text: text},
+	})
+	return c.diagnostics()
+}
+
+func (c *testClient) diagnostics() []Diagnostic {
+	message := c.receive()
+	var method string
+	json.Unmarshal(message["method"], &method)
+	if method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics to be published, got=%v", message)
+	}
+
+	var params PublishDiagnosticsParams
+	json.Unmarshal(message["params"], &params)
+	if params.URI != testURI {
+		c.t.Fatalf("diagnostics published for the wrong document. got=%s", params.URI)
+	}
+	return params.Diagnostics
+}
+
+func (c *testClient) close() {
+	c.request("shutdown", nil, nil)
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Errorf("server did not exit cleanly: %s", err)
+	}
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func rangeOf(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+
+	diagnostics := c.open("let x = add(1, 2;\nlet y = @;")
+	if len(diagnostics) != 2 {
+		t.Fatalf("wrong number of diagnostics. got=%d (%+v)", len(diagnostics), diagnostics)
+	}
+
+	first := diagnostics[0]
+	if first.Range != rangeOf(0, 16, 17) || first.Severity != SEVERITY_ERROR ||
+		first.Code != "unexpected-token" || first.Source != SOURCE {
+		t.Errorf("wrong diagnostic. got=%+v", first)
+	}
+	if len(first.RelatedInformation) != 1 || first.RelatedInformation[0].Location.Range != rangeOf(0, 11, 12) {
+		t.Errorf("wrong related information. got=%+v", first.RelatedInformation)
+	}
+	if diagnostics[1].Range != rangeOf(1, 8, 9) || diagnostics[1].Code != "illegal-character" {
+		t.Errorf("wrong diagnostic. got=%+v", diagnostics[1])
+	}
+
+	// Fixing the document clears its diagnostics
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+		"contentChanges": []map[string]string{{"text": "let x = 1;\nputs(x);"}},
+	})
+	if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+		t.Errorf("diagnostics not cleared. got=%+v", diagnostics)
+	}
+}
+
+func TestLintDiagnostics(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+
+	diagnostics := c.open("let x = 1;\nlet y = fn(a) { a; };\ny(1, 2);\nputs(z);")
+	if len(diagnostics) != 3 {
+		t.Fatalf("wrong number of diagnostics. got=%d (%+v)", len(diagnostics), diagnostics)
+	}
+
+	if d := diagnostics[0]; d.Code != "unused-binding" || d.Severity != SEVERITY_WARNING || d.Range != rangeOf(0, 4, 5) {
+		t.Errorf("wrong diagnostic. got=%+v", d)
+	}
+	if d := diagnostics[1]; d.Code != "wrong-arity" || d.Severity != SEVERITY_ERROR || d.Range != rangeOf(2, 0, 1) ||
+		len(d.RelatedInformation) != 1 || d.RelatedInformation[0].Location.Range != rangeOf(1, 4, 5) {
+		t.Errorf("wrong diagnostic. got=%+v", d)
+	}
+	if d := diagnostics[2]; d.Code != "undefined-name" || d.Severity != SEVERITY_ERROR || d.Range != rangeOf(3, 5, 6) ||
+		d.Message != "identifier not found: z" {
+		t.Errorf("wrong diagnostic. got=%+v", d)
+	}
+}
+
+const program = `let x = 5;
+let add = fn(a, b) {
+  let x = a + b;
+  x;
+};
+let y = add(x, 2) + x;
+let x = x + 1;
+puts(x);`
+
+func TestDefinition(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+	c.open(program)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected *Range
+	}{
+		{at(5, 12), &Range{Start: Position{0, 4}, End: Position{0, 5}}},   // x in add(x, 2)
+		{at(5, 21), &Range{Start: Position{0, 4}, End: Position{0, 5}}},   // x at the end of the line, cursor right after it
+		{at(3, 2), &Range{Start: Position{2, 6}, End: Position{2, 7}}},    // x shadowed within the function
+		{at(2, 10), &Range{Start: Position{1, 13}, End: Position{1, 14}}}, // parameter a
+		{at(5, 9), &Range{Start: Position{1, 4}, End: Position{1, 7}}},    // add
+		{at(6, 8), &Range{Start: Position{0, 4}, End: Position{0, 5}}},    // x within its own redefinition
+		{at(7, 5), &Range{Start: Position{6, 4}, End: Position{6, 5}}},    // redefined x
+		{at(0, 4), &Range{Start: Position{0, 4}, End: Position{0, 5}}},    // the definition itself
+		{at(7, 1), nil}, // builtin
+		{at(0, 8), nil}, // integer literal
+	}
+
+	for _, tt := range tests {
+		var location *Location
+		c.request("textDocument/definition", tt.position, &location)
+
+		if tt.expected == nil {
+			if location != nil {
+				t.Errorf("expected no definition at %+v, got=%+v", tt.position.Position, location)
+			}
+			continue
+		}
+		if location == nil || location.URI != testURI || location.Range != *tt.expected {
+			t.Errorf("wrong definition at %+v. expected=%+v, got=%+v", tt.position.Position, tt.expected, location)
+		}
+	}
+}
+
+func TestDefinitionOfRecursiveFunctions(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+	c.open("let f = fn(n) { if (n < 1) { 0; } else { g(n - 1); }; };\nlet g = fn(n) { f(n); };")
+
+	var location *Location
+	c.request("textDocument/definition", at(0, 41), &location)
+	if location == nil || location.Range != rangeOf(1, 4, 5) {
+		t.Errorf("g defined after f not found. got=%+v", location)
+	}
+}
+
+func TestDefinitionOfNamedFunctions(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+	c.open("fn double(x) { x * 2; };\ndouble(1);")
+
+	var location *Location
+	c.request("textDocument/definition", at(1, 0), &location)
+	if location == nil || location.Range != rangeOf(0, 3, 9) {
+		t.Errorf("named function not found. got=%+v", location)
+	}
+
+	var items []CompletionItem
+	c.request("textDocument/completion", at(1, 0), &items)
+	found := false
+	for _, item := range items {
+		if item.Label == "double" {
+			found = item == CompletionItem{Label: "double", Kind: COMPLETION_FUNCTION, Detail: "named function"}
+		}
+	}
+	if !found {
+		t.Errorf("named function not completed. got=%+v", items)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+	c.open(program)
+
+	params := ReferenceParams{TextDocumentPositionParams: at(0, 4)}
+	params.Context.IncludeDeclaration = true
+
+	var locations []Location
+	c.request("textDocument/references", params, &locations)
+
+	expected := []Range{rangeOf(0, 4, 5), rangeOf(5, 12, 13), rangeOf(5, 20, 21), rangeOf(6, 8, 9)}
+	if len(locations) != len(expected) {
+		t.Fatalf("wrong number of references. expected=%d, got=%d (%+v)", len(expected), len(locations), locations)
+	}
+	for i, r := range expected {
+		if locations[i].Range != r {
+			t.Errorf("references[%d] wrong. expected=%+v, got=%+v", i, r, locations[i].Range)
+		}
+	}
+
+	params = ReferenceParams{TextDocumentPositionParams: at(2, 6)}
+	c.request("textDocument/references", params, &locations)
+	if len(locations) != 1 || locations[0].Range != rangeOf(3, 2, 3) {
+		t.Errorf("wrong references of the shadowing x. got=%+v", locations)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+	c.open(program)
+
+	var items []CompletionItem
+	c.request("textDocument/completion", at(3, 2), &items)
+
+	labels := map[string]CompletionItem{}
+	for _, item := range items {
+		if _, ok := labels[item.Label]; ok {
+			t.Errorf("%s completed twice", item.Label)
+		}
+		labels[item.Label] = item
+	}
+
+	for _, expected := range []CompletionItem{
+		{Label: "x", Kind: COMPLETION_VARIABLE, Detail: "let binding"},
+		{Label: "a", Kind: COMPLETION_VARIABLE, Detail: "parameter of fn(a, b)"},
+		{Label: "add", Kind: COMPLETION_VARIABLE, Detail: "let binding"},
+		{Label: "len", Kind: COMPLETION_FUNCTION, Detail: "builtin"},
+		{Label: "readFile", Kind: COMPLETION_FUNCTION, Detail: "builtin"},
+		{Label: "return", Kind: COMPLETION_KEYWORD},
+	} {
+		if labels[expected.Label] != expected {
+			t.Errorf("wrong completion for %s. expected=%+v, got=%+v", expected.Label, expected, labels[expected.Label])
+		}
+	}
+
+	// Bindings made later on and parameters of other functions are not offered
+	c.request("textDocument/completion", at(0, 0), &items)
+	for _, item := range items {
+		if item.Kind == COMPLETION_VARIABLE {
+			t.Errorf("unexpected completion %+v", item)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+	c.open(program + "\nreadFile(\"a\");")
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected string
+	}{
+		{at(5, 12), "```yartbml\nlet x = 5;\n```\nlet binding"},
+		{at(2, 10), "```yartbml\na\n```\nparameter of fn(a, b)"},
+		{at(7, 0), "```yartbml\nputs\n```\nbuiltin function, requires the `stdout` capability"},
+		{at(8, 3), "```yartbml\nreadFile\n```\nbuiltin function, requires the `filesystem` capability"},
+		{at(0, 8), ""},
+	}
+
+	for _, tt := range tests {
+		var hover *Hover
+		c.request("textDocument/hover", tt.position, &hover)
+
+		if tt.expected == "" {
+			if hover != nil {
+				t.Errorf("expected no hover at %+v, got=%+v", tt.position.Position, hover)
+			}
+			continue
+		}
+		if hover == nil || hover.Contents.Kind != "markdown" || hover.Contents.Value != tt.expected {
+			t.Errorf("wrong hover at %+v. expected=%q, got=%+v", tt.position.Position, tt.expected, hover)
+		}
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	c := newTestClient(t)
+	defer c.close()
+
+	// 🙂 takes 4 bytes in UTF-8 but 2 code units in UTF-16
+	diagnostics := c.open(`let s = "🙂"; let t = s; t; let u = @;`)
+	if len(diagnostics) != 1 || diagnostics[0].Range != rangeOf(0, 36, 37) {
+		t.Fatalf("wrong diagnostics. got=%+v", diagnostics)
+	}
+
+	var location *Location
+	c.request("textDocument/definition", at(0, 25), &location)
+	if location == nil || location.Range != rangeOf(0, 18, 19) {
+		t.Errorf("wrong definition. got=%+v", location)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	c := newTestClient(t)
+
+	c.send(map[string]interface{}{"id": 42, "method": "workspace/unknown"})
+	message := c.receive()
+	if !strings.Contains(string(message["error"]), "-32601") {
+		t.Errorf("expected a method not found error. got=%v", message)
+	}
+
+	// Unknown notifications are ignored
+	c.notify("$/cancelRequest", map[string]int{"id": 1})
+
+	c.request("shutdown", nil, nil)
+	c.send(map[string]interface{}{"id": 43, "method": "textDocument/hover", "params": at(0, 0)})
+	message = c.receive()
+	if !strings.Contains(string(message["error"]), "-32600") {
+		t.Errorf("expected requests to be refused after shutdown. got=%v", message)
+	}
+
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("server did not exit cleanly: %s", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newTestClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err == nil {
+		t.Errorf("expected an error when exiting without shutdown")
+	}
+}
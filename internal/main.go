@@ -7,7 +7,45 @@ import (
 	"os/user"
 )
 
+const usage = `usage: yartbml [command] [arguments]
+
+Without a command, yartbml starts the REPL.
+
+Commands:
+  run [--allow caps] <file>     run a program, optimized unless --no-optimize is given
+  check [--json] <file>         report the diagnostics of a program without running it
+  parse [--json] <file>         print the AST of a program
+  lint [--json] <file>          report likely mistakes found by the rules of the linter
+  fmt [--check|--write] <file>  format programs in the canonical style
+  lsp                           start a language server speaking LSP over stdio
+`
+
+// A command of the yartbml executable, receiving the arguments following its name
+// and returning the exit code of the process
+var commands = map[string]func(args []string) int{
+	"run":   runCommand,
+	"check": checkCommand,
+	"parse": parseCommand,
+	"lint":  lintCommand,
+	"fmt":   fmtCommand,
+	"lsp":   lspCommand,
+}
+
 func main() {
+	if len(os.Args) < 2 {
+		startRepl()
+		return
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	os.Exit(command(os.Args[2:]))
+}
+
+func startRepl() {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,80 @@
+// Capabilities describe the ambient authority a builtin function needs in order to run.
+// Builtins that only compute over their arguments (len, push, ...) need no capability,
+// whereas builtins that reach outside of the interpreter (printing, reading files, ...)
+// are grouped into capabilities that have to be explicitly granted to an interpreter instance.
+package object
+
+import (
+	"bufio"
+	"io"
+	"sort"
+)
+
+type Capability string
+
+// Constants for each capability that can be granted to an interpreter instance.
+// A builtin with an empty capability is always allowed to run.
+const (
+	STDIN_CAP      Capability = "stdin"
+	STDOUT_CAP     Capability = "stdout"
+	STDERR_CAP     Capability = "stderr"
+	FILESYSTEM_CAP Capability = "filesystem"
+	ENV_CAP        Capability = "env"
+	TIME_CAP       Capability = "time"
+	RANDOM_CAP     Capability = "random"
+)
+
+// Sandbox holds the allow-list of capabilities granted to an interpreter instance,
+// along with the streams that the IO builtins are allowed to use.
+type Sandbox struct {
+	allowed map[Capability]bool
+	Stdin   *bufio.Reader // Source of everything read by the program
+	Stdout  io.Writer     // Destination of everything printed by the program
+	Stderr  io.Writer     // Destination of diagnostics printed by the program
+}
+
+// Creates a new Sandbox bound to the given streams that only grants the given capabilities.
+// When stdin is already a *bufio.Reader it is used as is, so that the host and the program
+// can share buffered input (e.g. the REPL reading lines in between readLine calls).
+func NewSandbox(stdin io.Reader, stdout, stderr io.Writer, allowed ...Capability) *Sandbox {
+	reader, ok := stdin.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(stdin)
+	}
+
+	s := &Sandbox{
+		allowed: make(map[Capability]bool),
+		Stdin:   reader,
+		Stdout:  stdout,
+		Stderr:  stderr,
+	}
+	for _, c := range allowed {
+		s.allowed[c] = true
+	}
+	return s
+}
+
+// Reports whether the capability has been granted to the sandbox.
+// The empty capability (pure builtins) is always allowed.
+func (s *Sandbox) Allows(c Capability) bool {
+	if c == "" {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	return s.allowed[c]
+}
+
+// Returns the granted capabilities in sorted order.
+func (s *Sandbox) Capabilities() []Capability {
+	caps := []Capability{}
+	if s == nil {
+		return caps
+	}
+	for c := range s.allowed {
+		caps = append(caps, c)
+	}
+	sort.Slice(caps, func(i, j int) bool { return caps[i] < caps[j] })
+	return caps
+}
@@ -1,40 +1,123 @@
 // The environment adds support for keeping track of bindings
 // Bindings are assigned using let statements. A variable is bound to value.
 // The environment is passed along when evaluating expressions.
+//
+// Bindings are stored in slots rather than looked up by name: the evaluator resolves every
+// identifier to the slot of its binding before running a program (see evaluator.Resolve).
+// The global environment also keeps the slot of each of its names, so that programs evaluated
+// one after another, like the lines typed into the REPL, share their global bindings.
 package object
 
-func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+import (
+	"os"
+	"sort"
+)
+
+// Creates a new environment with the given number of slots, enclosed by the outer environment
+// The enclosed environment shares the sandbox of its outer environment
+func NewEnclosedEnvironment(outer *Environment, size int) *Environment {
+	return &Environment{slots: make([]Object, size), outer: outer, sandbox: outer.sandbox}
 }
 
 // Environment object to store variable bindings
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	slots   []Object       // Values of the bindings, nil until the binding is made
+	names   map[string]int // Slots of the names of the global environment, nil for enclosed environments
+	outer   *Environment
+	sandbox *Sandbox
 }
 
-// Creates a new environment
-// Store bindings in a map
+// Creates a new global environment
+// Only the stdout capability is granted, writing to the process' stdout
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return NewSandboxedEnvironment(NewSandbox(os.Stdin, os.Stdout, os.Stderr, STDOUT_CAP))
+}
+
+// Creates a new global environment for an interpreter instance
+// Builtins are restricted to the capabilities allowed by the sandbox
+func NewSandboxedEnvironment(sandbox *Sandbox) *Environment {
+	return &Environment{names: make(map[string]int), outer: nil, sandbox: sandbox}
+}
+
+// Returns the sandbox the environment is evaluated within
+func (e *Environment) Sandbox() *Sandbox {
+	return e.sandbox
+}
+
+// Returns the value in the slot of the environment depth levels out
+// Reports false when the binding hasn't been made yet
+func (e *Environment) Lookup(depth, slot int) (Object, bool) {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	if slot >= len(e.slots) || e.slots[slot] == nil {
+		return nil, false
+	}
+	return e.slots[slot], true
+}
+
+// Stores the value in the slot of the environment
+func (e *Environment) Bind(slot int, val Object) Object {
+	e.slots[slot] = val
+	return val
+}
+
+// Returns the slot of the name in the global environment
+// Reports false when the name was never defined
+func (e *Environment) Slot(name string) (int, bool) {
+	e = e.global()
+	slot, ok := e.names[name]
+	return slot, ok
+}
+
+// Returns the slot of the name in the global environment, adding a slot for new names
+func (e *Environment) Define(name string) int {
+	e = e.global()
+	if slot, ok := e.names[name]; ok {
+		return slot
+	}
+	e.names[name] = len(e.slots)
+	e.slots = append(e.slots, nil)
+	return e.names[name]
 }
 
-// Retrieves binding name and value from environment
-// Looks into each enclosing enviornment until value is found
-// Return error if value not found
+// Adds a slot without a name to the global environment, for bindings only in view within a block
+func (e *Environment) Reserve() int {
+	e = e.global()
+	e.slots = append(e.slots, nil)
+	return len(e.slots) - 1
+}
+
+// Retrieves the value bound to the name in the global environment
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	slot, ok := e.Slot(name)
+	if !ok {
+		return nil, false
 	}
-	return obj, ok
+	return e.global().Lookup(0, slot)
 }
 
-// Stores binding name and value in environment
+// Binds the name to the value in the global environment
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
-	return val
+	return e.global().Bind(e.Define(name), val)
+}
+
+// Returns the names of every binding made in the global environment in sorted order
+func (e *Environment) Names() []string {
+	e = e.global()
+	names := make([]string, 0, len(e.names))
+	for name, slot := range e.names {
+		if e.slots[slot] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Environment) global() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
 }
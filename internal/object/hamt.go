@@ -0,0 +1,143 @@
+package object
+
+import "math/bits"
+
+// Persistent hash array mapped trie holding the pairs of hashes.
+// Each level of the trie is indexed by 5 bits of the hash key value, lowest bits first,
+// so looking up and inserting a pair takes O(log32 n) steps.
+// Nodes only hold slots for the indexes in use, which their bitmap records.
+// Like vectors, insertions copy the path to the slot they change and share every other node.
+type hamt struct {
+	root *hamtNode
+	size int
+}
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+type hamtNode struct {
+	bitmap uint32
+	slots  []hamtSlot
+}
+
+// Slot of a node: either a child node, or the bucket of the pairs whose keys share the same value.
+// Keys of different types may share a value, like the integer 1 and true.
+type hamtSlot struct {
+	node   *hamtNode
+	bucket []hamtEntry
+}
+
+type hamtEntry struct {
+	key  HashKey
+	pair HashPair
+}
+
+// Returns the pair stored for the key
+func (h hamt) get(key HashKey) (HashPair, bool) {
+	n := h.root
+	for shift := uint(0); n != nil; shift += hamtBits {
+		bit := hamtBit(key, shift)
+		if n.bitmap&bit == 0 {
+			break
+		}
+		slot := n.slots[n.index(bit)]
+		if slot.node != nil {
+			n = slot.node
+			continue
+		}
+		for _, e := range slot.bucket {
+			if e.key == key {
+				return e.pair, true
+			}
+		}
+		break
+	}
+	return HashPair{}, false
+}
+
+// Returns a trie holding the pair for the key, replacing the previous pair stored for it
+func (h hamt) set(key HashKey, pair HashPair) hamt {
+	root, added := h.root.set(0, hamtEntry{key: key, pair: pair})
+	h.root = root
+	if added {
+		h.size++
+	}
+	return h
+}
+
+// Calls fn with every pair of the trie, in the order of the bits of their hash keys' values
+func (h hamt) each(fn func(HashPair)) {
+	h.root.each(fn)
+}
+
+func hamtBit(key HashKey, shift uint) uint32 {
+	return 1 << ((key.Value >> shift) & hamtMask)
+}
+
+// Returns the position of the slot of the bit among the slots in use
+func (n *hamtNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// Returns a copy of the node holding the entry, and whether its key is new.
+// The node is nil when the trie is empty.
+func (n *hamtNode) set(shift uint, entry hamtEntry) (*hamtNode, bool) {
+	c := &hamtNode{}
+	if n != nil {
+		c = &hamtNode{bitmap: n.bitmap, slots: append([]hamtSlot(nil), n.slots...)}
+	}
+
+	bit := hamtBit(entry.key, shift)
+	idx := c.index(bit)
+	if c.bitmap&bit == 0 {
+		c.bitmap |= bit
+		c.slots = append(c.slots, hamtSlot{})
+		copy(c.slots[idx+1:], c.slots[idx:])
+		c.slots[idx] = hamtSlot{bucket: []hamtEntry{entry}}
+		return c, true
+	}
+
+	slot := c.slots[idx]
+	if slot.node != nil {
+		child, added := slot.node.set(shift+hamtBits, entry)
+		c.slots[idx] = hamtSlot{node: child}
+		return c, added
+	}
+
+	if slot.bucket[0].key.Value == entry.key.Value {
+		bucket := append([]hamtEntry(nil), slot.bucket...)
+		c.slots[idx] = hamtSlot{bucket: bucket}
+		for i, e := range bucket {
+			if e.key == entry.key {
+				bucket[i] = entry
+				return c, false
+			}
+		}
+		c.slots[idx].bucket = append(bucket, entry)
+		return c, true
+	}
+
+	// The values differ within the next bits: push the bucket down a level, next to the entry
+	next := shift + hamtBits
+	child := &hamtNode{bitmap: hamtBit(slot.bucket[0].key, next), slots: []hamtSlot{slot}}
+	child, _ = child.set(next, entry)
+	c.slots[idx] = hamtSlot{node: child}
+	return c, true
+}
+
+func (n *hamtNode) each(fn func(HashPair)) {
+	if n == nil {
+		return
+	}
+	for _, slot := range n.slots {
+		if slot.node != nil {
+			slot.node.each(fn)
+			continue
+		}
+		for _, e := range slot.bucket {
+			fn(e.pair)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package object
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashSetAndGet(t *testing.T) {
+	n := 20000
+	hash := &Hash{}
+	hashes := []*Hash{}
+	for i := 0; i < n; i++ {
+		key := &Integer{Value: int64(i)}
+		hash = hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: int64(i * 2)}})
+		if i%1000 == 0 {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	if hash.Len() != n {
+		t.Fatalf("hash has wrong number of pairs. expected=%d, got=%d", n, hash.Len())
+	}
+	for i := 0; i < n; i++ {
+		pair, ok := hash.Get((&Integer{Value: int64(i)}).HashKey())
+		if !ok || pair.Value.(*Integer).Value != int64(i*2) {
+			t.Fatalf("wrong pair for %d. got=%+v (%t)", i, pair, ok)
+		}
+	}
+	if _, ok := hash.Get((&Integer{Value: int64(n)}).HashKey()); ok {
+		t.Errorf("found a pair for a missing key")
+	}
+
+	// Setting pairs never changes the hashes they were set in
+	for i, h := range hashes {
+		if h.Len() != i*1000+1 {
+			t.Errorf("hashes[%d] has wrong number of pairs. got=%d", i, h.Len())
+		}
+		if _, ok := h.Get((&Integer{Value: int64(i*1000 + 1)}).HashKey()); ok {
+			t.Errorf("hashes[%d] holds a pair set after it", i)
+		}
+	}
+}
+
+func TestHashReplacesPairs(t *testing.T) {
+	key := &String{Value: "a"}
+	first := (&Hash{}).Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: 1}})
+	second := first.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: 2}})
+
+	if second.Len() != 1 {
+		t.Errorf("second has wrong number of pairs. got=%d", second.Len())
+	}
+	if pair, _ := second.Get(key.HashKey()); pair.Value.Inspect() != "2" {
+		t.Errorf("second holds the wrong value. got=%s", pair.Value.Inspect())
+	}
+	if pair, _ := first.Get(key.HashKey()); pair.Value.Inspect() != "1" {
+		t.Errorf("first was changed. got=%s", pair.Value.Inspect())
+	}
+}
+
+// Keys of different types may share the same value, which the trie holds in the same bucket
+func TestHashKeysSharingValues(t *testing.T) {
+	keys := []Object{&Integer{Value: 1}, &Boolean{Value: true}, &Integer{Value: 0}, &Boolean{Value: false}}
+	hash := &Hash{}
+	for i, key := range keys {
+		hash = hash.Set(key.(Hashable).HashKey(), HashPair{Key: key, Value: &Integer{Value: int64(i)}})
+	}
+
+	if hash.Len() != len(keys) {
+		t.Fatalf("hash has wrong number of pairs. expected=%d, got=%d", len(keys), hash.Len())
+	}
+	for i, key := range keys {
+		pair, ok := hash.Get(key.(Hashable).HashKey())
+		if !ok || pair.Key != key || pair.Value.(*Integer).Value != int64(i) {
+			t.Errorf("wrong pair for %s. got=%+v (%t)", key.Inspect(), pair, ok)
+		}
+	}
+}
+
+func TestHashInspectIsDeterministic(t *testing.T) {
+	build := func(order []string) *Hash {
+		hash := &Hash{}
+		for _, k := range order {
+			key := &String{Value: k}
+			hash = hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: 1}})
+		}
+		return hash
+	}
+
+	expected := build([]string{"a", "b", "c", "d"}).Inspect()
+	if got := build([]string{"d", "c", "b", "a"}).Inspect(); got != expected {
+		t.Errorf("Inspect depends on the order pairs were set in. expected=%q, got=%q", expected, got)
+	}
+	if got := len(build([]string{"a", "b", "c", "d"}).Pairs()); got != 4 {
+		t.Errorf("Pairs() has wrong length. got=%d", got)
+	}
+}
+
+func integerHash(n int) *Hash {
+	hash := &Hash{}
+	for i := 0; i < n; i++ {
+		key := &Integer{Value: int64(i)}
+		hash = hash.Set(key.HashKey(), HashPair{Key: key, Value: key})
+	}
+	return hash
+}
+
+// Setting a pair takes O(log n) steps, so its cost barely grows with the size of the hash
+func BenchmarkHashSet(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		hash := integerHash(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			key := &String{Value: "key"}
+			for i := 0; i < b.N; i++ {
+				hash.Set(key.HashKey(), HashPair{Key: key, Value: key})
+			}
+		})
+	}
+}
+
+func BenchmarkHashGet(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		hash := integerHash(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hash.Get(HashKey{Type: INTEGER_OBJ, Value: uint64(i % n)})
+			}
+		})
+	}
+}
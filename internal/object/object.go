@@ -5,13 +5,15 @@ package object
 
 import (
 	"YARTBML/ast"
+	"YARTBML/diagnostic"
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"sort"
 	"strings"
 )
 
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(env *Environment, args ...Object) Object
 
 type ObjectType string
 
@@ -20,6 +22,7 @@ type ObjectType string
 const (
 	NULL_OBJ         = "NULL"
 	ERROR_OBJ        = "ERROR"
+	ERROR_VALUE_OBJ  = "ERROR_VALUE"
 
 	INTEGER_OBJ      = "INTEGER"
 	BOOLEAN_OBJ       = "BOOLEAN"
@@ -32,6 +35,7 @@ const (
 
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	SET_OBJ          = "SET"
 )
 
 // Any type that implements all the methods of the Object will automatically implement the interface itself
@@ -95,21 +99,109 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Kinds of the errors raised by the interpreter, and thrown without a kind of their own
+const (
+	RUNTIME_ERROR = "runtime"
+	THROWN_ERROR  = "error"
+)
+
 // Error type
+// Errors unwind the program up to the closest try expression catching them, or up to its end.
+// Kind classifies the error: RUNTIME_ERROR for the errors raised by the interpreter, or the kind it was thrown with.
+// Span locates the expression that raised the error within the program
+// Stack holds the calls the error went through, innermost first.
 type Error struct {
 	Message string
+	Kind    string
+	Span    diagnostic.Span
+	Stack   []Frame
+}
+
+// Call of a function an error was raised within
+type Frame struct {
+	Function string          // Name of the function, empty for anonymous functions
+	Span     diagnostic.Span // Span of the call
+}
+
+// Describes the frame, e.g. `fib, called at 3:1`
+func (f Frame) String() string {
+	return f.name() + ", called at " + f.Span.Start.String()
+}
+
+func (f Frame) name() string {
+	if f.Function == "" {
+		return "anonymous function"
+	}
+	return f.Function
 }
 
 // Receiver functions for Error struct
 // Gives Error struct object interface
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	var out strings.Builder
+	out.WriteString("ERROR: " + e.Message)
+	for _, frame := range e.frames() {
+		out.WriteString("\n\tin " + frame.String())
+		if frame.count > 1 {
+			fmt.Fprintf(&out, " (%d times)", frame.count)
+		}
+	}
+	return out.String()
+}
+
+// Diagnostic describing the runtime error, with a note for every call it went through
+func (e *Error) Diagnostic() diagnostic.Diagnostic {
+	d := diagnostic.Errorf(e.Span, "runtime-error", "%s", e.Message)
+	for _, frame := range e.frames() {
+		message := "in " + frame.name() + ", called here"
+		if frame.count > 1 {
+			message += fmt.Sprintf(" (%d times)", frame.count)
+		}
+		d.Related = append(d.Related, diagnostic.Note{Message: message, Span: frame.Span})
+	}
+	return d
+}
+
+// ErrorValue holds an error as a value, like the ones bound by catch blocks or created by the `error` builtin.
+// Unlike Error, it doesn't unwind the program, until it's thrown.
+// Indexing it with "message", "kind" or "stack" gives the fields of the error.
+type ErrorValue struct {
+	Error *Error
+}
+
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (ev *ErrorValue) Inspect() string  { return ev.Error.Kind + ": " + ev.Error.Message }
+
+// Frame of the stack repeated count times in a row, like the calls of a recursive function
+type repeatedFrame struct {
+	Frame
+	count int
+}
+
+// Returns the stack with the frames repeated in a row collapsed into one
+func (e *Error) frames() []repeatedFrame {
+	frames := []repeatedFrame{}
+	for _, frame := range e.Stack {
+		if n := len(frames); n > 0 && frames[n-1].Frame == frame {
+			frames[n-1].count++
+			continue
+		}
+		frames = append(frames, repeatedFrame{Frame: frame, count: 1})
+	}
+	return frames
+}
 
 // Function type
 type Function struct {
+	Name       string          // Name of the function, declared or inferred, empty for anonymous functions
+	Self       *ast.Identifier // Name of a named function, bound to the function itself when it's called
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // Default value of each parameter, nil for the ones without any
+	Variadic   bool             // Whether the last parameter collects the remaining arguments
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Slots      int // Size of the environment of a call
 }
 
 // Receiver functions for function struct
@@ -119,15 +211,23 @@ func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		param := p.String()
+		if f.Variadic && i == len(f.Parameters)-1 {
+			param = "..." + param
+		}
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			param += " = " + f.Defaults[i].String()
+		}
+		params = append(params, param)
 	}
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
-	out.WriteString("\n}")
+	out.WriteString(") { ... }")
 	return out.String()
 }
 
@@ -149,18 +249,62 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 // Builtin Type
+// Capability is the capability the sandbox must grant before the builtin can be invoked
+// Arity is the number of arguments the builtin expects, or VARIADIC when it accepts any number of them
+// Result is the type of the objects the builtin returns, or empty when it depends on the arguments
 type Builtin struct {
-	Fn BuiltinFunction
+	Name       string
+	Arity      int
+	Result     ObjectType
+	Capability Capability
+	Fn         BuiltinFunction
 }
 
+// Arity of builtins accepting any number of arguments
+const VARIADIC = -1
+
 // Type returns the type of object as BUILT_OBJ
 // Inspect provides a string representation indicating it's a builtin function
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
 // Array Type
+// Arrays are immutable: pushing or slicing gives a new array sharing its elements with the original,
+// which takes O(log n) steps rather than copying them all (see vector).
+// The zero value is an empty array.
 type Array struct {
-	Elements []Object
+	elements vector
+}
+
+// Returns an array holding the elements
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
+}
+
+// Returns the number of elements of the array
+func (ao *Array) Len() int { return ao.elements.len() }
+
+// Returns the element at the index, which must be within the array
+func (ao *Array) At(i int) Object { return ao.elements.get(i) }
+
+// Returns a new array holding the elements of the array followed by el
+func (ao *Array) Push(el Object) *Array {
+	return &Array{elements: ao.elements.push(el)}
+}
+
+// Returns a new array holding the elements from low up to, but not including, high,
+// which must be within the array
+func (ao *Array) Slice(low, high int) *Array {
+	return &Array{elements: ao.elements.slice(low, high)}
+}
+
+// Returns the elements of the array, in a slice of their own
+func (ao *Array) Elements() []Object {
+	elements := make([]Object, 0, ao.Len())
+	ao.elements.each(func(el Object) {
+		elements = append(elements, el)
+	})
+	return elements
 }
 
 // Type returns the type of the object as ARRAY_OBJ
@@ -170,9 +314,9 @@ func (ao *Array) Inspect() string {
 	var out bytes.Buffer
 
 	elements := []string{}
-	for _, e := range ao.Elements {
+	ao.elements.each(func(e Object) {
 		elements = append(elements, e.Inspect())
-	}
+	})
 
 	out.WriteString("[")
 	out.WriteString(strings.Join(elements, ", "))
@@ -195,8 +339,32 @@ type HashPair struct {
 }
 
 // Represents a hash map where keys are HashKeys and values are HashPairs
+// Hashes are immutable: setting a pair gives a new hash sharing its pairs with the original,
+// which takes O(log n) steps rather than copying them all (see hamt).
+// The zero value is an empty hash.
 type Hash struct {
-	Pairs map[HashKey]HashPair // Pairs map HashKey to HashPair
+	pairs hamt
+}
+
+// Returns the number of pairs of the hash
+func (h *Hash) Len() int { return h.pairs.size }
+
+// Returns the pair stored for the key
+func (h *Hash) Get(key HashKey) (HashPair, bool) { return h.pairs.get(key) }
+
+// Returns a new hash holding the pair for the key, in place of the previous pair stored for it
+func (h *Hash) Set(key HashKey, pair HashPair) *Hash {
+	return &Hash{pairs: h.pairs.set(key, pair)}
+}
+
+// Returns the pairs of the hash
+// Their order follows the values of their hash keys rather than the order they were set in
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.Len())
+	h.pairs.each(func(pair HashPair) {
+		pairs = append(pairs, pair)
+	})
+	return pairs
 }
 
 // Type returns the type of the object as HASH_OBJ
@@ -206,10 +374,10 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	h.pairs.each(func(pair HashPair) {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
-	}
+	})
 
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -218,6 +386,69 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Represents a set of distinct hashable values
+// Like hashes, sets are immutable and share their elements with the sets they were made from (see hamt).
+// The zero value is an empty set.
+type Set struct {
+	elements hamt
+}
+
+// Returns the number of elements of the set
+func (s *Set) Len() int { return s.elements.size }
+
+// Reports whether the set holds the element
+func (s *Set) Has(el Hashable) bool {
+	_, ok := s.elements.get(el.HashKey())
+	return ok
+}
+
+// Returns a new set holding the elements of the set and el
+func (s *Set) Add(el Hashable) *Set {
+	if s.Has(el) {
+		return s
+	}
+	return &Set{elements: s.elements.set(el.HashKey(), HashPair{Key: el.(Object)})}
+}
+
+// Returns the elements of the set, sorted the way Inspect lists them
+func (s *Set) Elements() []Object {
+	elements := make([]Object, 0, s.Len())
+	s.elements.each(func(pair HashPair) {
+		elements = append(elements, pair.Key)
+	})
+	sort.Slice(elements, func(i, j int) bool {
+		return lessElement(elements[i], elements[j])
+	})
+	return elements
+}
+
+// Orders the elements of sets by type, then by value
+func lessElement(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+	return false
+}
+
+// Type returns the type of the object as SET_OBJ
+// Inspect lists the elements of the set in order, the way the `set` builtin takes them: set(1, 2, 3)
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	elements := []string{}
+	for _, el := range s.Elements() {
+		elements = append(elements, el.Inspect())
+	}
+	return "set(" + strings.Join(elements, ", ") + ")"
+}
+
 // Ensures that objects can be used as keys in hash maps
 type Hashable interface {
 	HashKey() HashKey
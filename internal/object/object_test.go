@@ -18,3 +18,25 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestSet(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	empty := &Set{}
+	s := empty.Add(two).Add(one).Add(&Integer{Value: 1})
+
+	if s.Len() != 2 || !s.Has(one) || !s.Has(two) || s.Has(&Integer{Value: 3}) {
+		t.Errorf("set holds the wrong elements: %s", s.Inspect())
+	}
+	if empty.Len() != 0 {
+		t.Errorf("adding elements changed the original set: %s", empty.Inspect())
+	}
+
+	// Elements are listed by type, then by value, whatever the order they were added in
+	mixed := &Set{}
+	for _, el := range []Hashable{&String{Value: "b"}, &Integer{Value: 10}, &Boolean{Value: true}, &String{Value: "a"}, &Integer{Value: -1}, &Boolean{Value: false}} {
+		mixed = mixed.Add(el)
+	}
+	if got := mixed.Inspect(); got != "set(false, true, -1, 10, a, b)" {
+		t.Errorf("mixed.Inspect() wrong. got=%q", got)
+	}
+}
@@ -0,0 +1,129 @@
+package object
+
+// Persistent vector holding the elements of arrays.
+// Elements are stored in the leaves of a trie where every node has up to 32 children,
+// so reading, replacing and appending an element takes O(log32 n) steps.
+// Updates copy the path from the root to the leaf they change, and share every other node
+// with the vector they were made from: vectors are never modified once built.
+//
+// A vector is a window, from start to end, over the elements of its trie, so that slicing
+// shares the whole trie. The trie may hold elements past the end, which appending replaces.
+type vector struct {
+	root  *vectorNode
+	shift uint // Bits of the index consumed by the levels above the leaves, 0 when the root is a leaf
+	size  int  // Number of elements held by the trie
+	start int
+	end   int
+}
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// Node of the trie: inner nodes hold children, leaves hold elements
+type vectorNode struct {
+	children []*vectorNode
+	elements []Object
+}
+
+func newVector(elements []Object) vector {
+	v := vector{}
+	for _, el := range elements {
+		v = v.push(el)
+	}
+	return v
+}
+
+func (v vector) len() int { return v.end - v.start }
+
+// Returns the element at the index, which must be within the vector
+func (v vector) get(i int) Object {
+	i += v.start
+	n := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		n = n.children[(i>>level)&vectorMask]
+	}
+	return n.elements[i&vectorMask]
+}
+
+// Returns a vector holding the element after the ones of the vector
+func (v vector) push(el Object) vector {
+	if v.end < v.size {
+		// Replace the element following the window rather than growing the trie
+		v.root = v.root.set(v.shift, v.end, el)
+		v.end++
+		return v
+	}
+
+	if v.size == 1<<(v.shift+vectorBits) {
+		// The trie is full: it becomes the first child of a new root
+		v.root = &vectorNode{children: []*vectorNode{v.root}}
+		v.shift += vectorBits
+	}
+	v.root = v.root.push(v.shift, v.size, el)
+	v.size++
+	v.end++
+	return v
+}
+
+// Returns the elements from low up to, but not including, high, which must be within the vector
+func (v vector) slice(low, high int) vector {
+	v.start, v.end = v.start+low, v.start+high
+	return v
+}
+
+// Calls fn with every element of the vector, in order
+func (v vector) each(fn func(Object)) {
+	for i := v.start; i < v.end; {
+		n := v.root
+		for level := v.shift; level > 0; level -= vectorBits {
+			n = n.children[(i>>level)&vectorMask]
+		}
+		// Go through the rest of the leaf at once
+		for _, el := range n.elements[i&vectorMask : min(len(n.elements), i&vectorMask+v.end-i)] {
+			fn(el)
+			i++
+		}
+	}
+}
+
+// Returns a copy of the node holding the element at index i replaced
+func (n *vectorNode) set(level uint, i int, el Object) *vectorNode {
+	c := n.clone()
+	if level == 0 {
+		c.elements[i&vectorMask] = el
+		return c
+	}
+	idx := (i >> level) & vectorMask
+	c.children[idx] = c.children[idx].set(level-vectorBits, i, el)
+	return c
+}
+
+// Returns a copy of the node holding the element at index i, right after its last one.
+// The node is nil when the path to index i doesn't exist yet.
+func (n *vectorNode) push(level uint, i int, el Object) *vectorNode {
+	c := &vectorNode{}
+	if n != nil {
+		c = n.clone()
+	}
+	if level == 0 {
+		c.elements = append(c.elements, el)
+		return c
+	}
+	idx := (i >> level) & vectorMask
+	if idx < len(c.children) {
+		c.children[idx] = c.children[idx].push(level-vectorBits, i, el)
+	} else {
+		c.children = append(c.children, (*vectorNode)(nil).push(level-vectorBits, i, el))
+	}
+	return c
+}
+
+func (n *vectorNode) clone() *vectorNode {
+	return &vectorNode{
+		children: append([]*vectorNode(nil), n.children...),
+		elements: append([]Object(nil), n.elements...),
+	}
+}
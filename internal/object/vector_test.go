@@ -0,0 +1,134 @@
+package object
+
+import (
+	"fmt"
+	"testing"
+)
+
+func integers(n int) []Object {
+	elements := make([]Object, n)
+	for i := range elements {
+		elements[i] = &Integer{Value: int64(i)}
+	}
+	return elements
+}
+
+func testArrayElements(t *testing.T, array *Array, expected []int64) {
+	t.Helper()
+	if array.Len() != len(expected) {
+		t.Fatalf("array has wrong length. expected=%d, got=%d", len(expected), array.Len())
+	}
+	elements := array.Elements()
+	for i, value := range expected {
+		if got := array.At(i).(*Integer).Value; got != value {
+			t.Fatalf("array.At(%d) wrong. expected=%d, got=%d", i, value, got)
+		}
+		if got := elements[i].(*Integer).Value; got != value {
+			t.Fatalf("array.Elements()[%d] wrong. expected=%d, got=%d", i, value, got)
+		}
+	}
+}
+
+func sequence(low, high int64) []int64 {
+	values := []int64{}
+	for i := low; i < high; i++ {
+		values = append(values, i)
+	}
+	return values
+}
+
+func TestArrayPush(t *testing.T) {
+	// Enough elements for the trie to grow three levels deep
+	n := 32*32*32 + 5
+	array := &Array{}
+	arrays := []*Array{}
+	for i := 0; i < n; i++ {
+		array = array.Push(&Integer{Value: int64(i)})
+		if i%1000 == 0 {
+			arrays = append(arrays, array)
+		}
+	}
+	testArrayElements(t, array, sequence(0, int64(n)))
+
+	// Pushing never changes the arrays pushed onto
+	for i, a := range arrays {
+		testArrayElements(t, a, sequence(0, int64(i*1000+1)))
+	}
+}
+
+func TestNewArray(t *testing.T) {
+	for _, n := range []int{0, 1, 32, 33, 1024, 1025} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			testArrayElements(t, NewArray(integers(n)), sequence(0, int64(n)))
+		})
+	}
+}
+
+func TestArraySlice(t *testing.T) {
+	array := NewArray(integers(100))
+
+	rest := array.Slice(1, 100)
+	testArrayElements(t, rest, sequence(1, 100))
+	testArrayElements(t, rest.Slice(30, 60), sequence(31, 61))
+	testArrayElements(t, array.Slice(50, 50), []int64{})
+
+	// Pushing onto a slice replaces the elements following it within the shared trie, without changing the original
+	head := array.Slice(0, 40)
+	pushed := head.Push(&Integer{Value: -1})
+	testArrayElements(t, pushed, append(sequence(0, 40), -1))
+	testArrayElements(t, head, sequence(0, 40))
+	testArrayElements(t, array, sequence(0, 100))
+
+	again := head.Push(&Integer{Value: -2})
+	testArrayElements(t, again, append(sequence(0, 40), -2))
+	testArrayElements(t, pushed, append(sequence(0, 40), -1))
+}
+
+func TestArrayInspect(t *testing.T) {
+	array := NewArray([]Object{&Integer{Value: 1}, &String{Value: "a"}}).Push(&Boolean{Value: true})
+	if got := array.Inspect(); got != "[1, a, true]" {
+		t.Errorf("array.Inspect() wrong. got=%q", got)
+	}
+	if got := (&Array{}).Inspect(); got != "[]" {
+		t.Errorf("empty array.Inspect() wrong. got=%q", got)
+	}
+}
+
+// Pushing takes O(log n) steps, so its cost barely grows with the length of the array
+func BenchmarkArrayPush(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		array := NewArray(integers(n))
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			el := &Integer{Value: 1}
+			for i := 0; i < b.N; i++ {
+				array.Push(el)
+			}
+		})
+	}
+}
+
+func BenchmarkArrayAt(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		array := NewArray(integers(n))
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				array.At(i % n)
+			}
+		})
+	}
+}
+
+// Building an array by pushing every element onto the previous array takes O(n log n) steps
+func BenchmarkArrayBuild(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			el := &Integer{Value: 1}
+			for i := 0; i < b.N; i++ {
+				array := &Array{}
+				for j := 0; j < n; j++ {
+					array = array.Push(el)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package optimizer simplifies YARTBML programs before they are evaluated,
+// so that the evaluator doesn't compute the same constant values over and over again.
+//
+// The optimizer rewrites the AST in three ways, repeated until nothing changes anymore:
+//
+//   - Constant folding: operators applied to integer, string and boolean literals are
+//     replaced by their result, e.g. `2 * 60 * 60` becomes `7200` and `!true` becomes `false`.
+//     Template strings embedding only literals become string literals.
+//   - Dead branch elimination: an if expression whose condition is a literal is replaced by
+//     the block of the branch it takes, e.g. `if (true) { a; } else { b; }` becomes `{ a; }`.
+//   - Constant inlining: identifiers referring to a let binding of a literal are replaced by
+//     the literal, e.g. `let n = 5; n * 2;` becomes `let n = 5; 10;`.
+//
+// Optimized programs evaluate to the same values and report the same errors as the original ones.
+// Operations that fail at runtime, like a division by zero or the concatenation of a string
+// with an integer, are left for the evaluator to report.
+package optimizer
+
+import (
+	"YARTBML/ast"
+	"YARTBML/symbols"
+	"YARTBML/token"
+	"strconv"
+)
+
+// Returns the optimized program, leaving the given one untouched.
+//
+// Inlining assumes that the program is evaluated on its own: the bindings of a program
+// evaluated after another one in the same environment, like the lines of the REPL,
+// may be rebound later on.
+func Optimize(program *ast.Program) *ast.Program {
+	for {
+		table := symbols.Resolve(program)
+		optimized := ast.Rewrite(program, func(node ast.Node) ast.Node {
+			return optimize(node, table, program)
+		}).(*ast.Program)
+
+		if optimized == program {
+			return program
+		}
+		program = optimized
+	}
+}
+
+func optimize(node ast.Node, table *symbols.Table, program *ast.Program) ast.Node {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return inline(node, table, program)
+	case *ast.PrefixExpression:
+		return foldPrefix(node)
+	case *ast.InfixExpression:
+		return foldInfix(node)
+	case *ast.TemplateLiteral:
+		return foldTemplate(node)
+	case *ast.IfExpression:
+		return eliminateBranch(node)
+	case *ast.Program:
+		if statements, changed := dropDeadStatements(node.Statements); changed {
+			return &ast.Program{Statements: statements}
+		}
+	case *ast.BlockStatement:
+		if statements, changed := dropDeadStatements(node.Statements); changed {
+			return &ast.BlockStatement{Token: node.Token, Statements: statements}
+		}
+	}
+	return node
+}
+
+// Replaces an identifier referring to a constant by the value of the constant.
+// A let binding is a constant when its value is a literal and no other binding of the
+// scope has the same name, since the evaluator overwrites bindings sharing a name.
+// Only identifiers following the let statement in the source are replaced,
+// as functions defined before the binding may be called before it exists.
+// The let statement must be a statement of the program or of the body of a function,
+// rather than of a block that may not run, like the blocks of if expressions.
+func inline(ident *ast.Identifier, table *symbols.Table, program *ast.Program) ast.Node {
+	b := table.BindingOf(ident)
+	if b == nil || b.Kind != symbols.LET || b.Name == ident || !isLiteral(b.Value) {
+		return ident
+	}
+	if !boundUnconditionally(b, program) {
+		return ident
+	}
+	if ident.Token.Pos.Offset < b.Name.Token.Pos.Offset {
+		return ident
+	}
+	for _, other := range b.Scope.Bindings {
+		if other != b && other.Name.Value == b.Name.Value {
+			return ident
+		}
+	}
+	return literalAt(b.Value, ident.Token)
+}
+
+// Reports whether the binding is made by a let statement of the program or of the body of the
+// function of its scope, which runs whenever the statements following it do
+func boundUnconditionally(b *symbols.Binding, program *ast.Program) bool {
+	statements := program.Statements
+	if b.Scope.Function != nil {
+		statements = b.Scope.Function.Body.Statements
+	}
+	for _, stmt := range statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && let.Name == b.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func foldPrefix(node *ast.PrefixExpression) ast.Node {
+	if !isLiteral(node.Right) {
+		return node
+	}
+
+	switch node.Operator {
+	case "!":
+		// Every value but false is truthy
+		b, isBoolean := node.Right.(*ast.BooleanLiteral)
+		return booleanLiteral(isBoolean && !b.Value, node.Token)
+	case "-":
+		if i, ok := node.Right.(*ast.IntegerLiteral); ok {
+			return integerLiteral(-i.Value, node.Token)
+		}
+	}
+	return node
+}
+
+func foldInfix(node *ast.InfixExpression) ast.Node {
+	tok := ast.FirstToken(node)
+
+	// Literals are never null, so their default is never used
+	if node.Operator == "??" && isLiteral(node.Left) {
+		return node.Left
+	}
+
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := node.Right.(*ast.IntegerLiteral)
+		if !ok {
+			break
+		}
+		switch node.Operator {
+		case "+":
+			return integerLiteral(left.Value+right.Value, tok)
+		case "-":
+			return integerLiteral(left.Value-right.Value, tok)
+		case "*":
+			return integerLiteral(left.Value*right.Value, tok)
+		case "/":
+			if right.Value != 0 {
+				return integerLiteral(left.Value/right.Value, tok)
+			}
+		case "<":
+			return booleanLiteral(left.Value < right.Value, tok)
+		case ">":
+			return booleanLiteral(left.Value > right.Value, tok)
+		case "==":
+			return booleanLiteral(left.Value == right.Value, tok)
+		case "!=":
+			return booleanLiteral(left.Value != right.Value, tok)
+		}
+	case *ast.BooleanLiteral:
+		right, ok := node.Right.(*ast.BooleanLiteral)
+		if !ok {
+			break
+		}
+		switch node.Operator {
+		case "==":
+			return booleanLiteral(left.Value == right.Value, tok)
+		case "!=":
+			return booleanLiteral(left.Value != right.Value, tok)
+		}
+	case *ast.StringLiteral:
+		// Strings are compared by identity, so only their concatenation can be folded
+		right, ok := node.Right.(*ast.StringLiteral)
+		if ok && node.Operator == "+" {
+			return stringLiteral(left.Value+right.Value, tok)
+		}
+	}
+	return node
+}
+
+// Joins a template string whose values are all literals into a string literal.
+// Literals are converted to text like the evaluator does.
+func foldTemplate(node *ast.TemplateLiteral) ast.Node {
+	text := node.Parts[0]
+	for i, value := range node.Values {
+		switch value := value.(type) {
+		case *ast.IntegerLiteral:
+			text += strconv.FormatInt(value.Value, 10)
+		case *ast.BooleanLiteral:
+			text += strconv.FormatBool(value.Value)
+		case *ast.StringLiteral:
+			text += value.Value
+		default:
+			return node
+		}
+		text += node.Parts[i+1]
+	}
+	return stringLiteral(text, node.Token)
+}
+
+// Replaces an if expression with a literal condition by the block of the branch it takes.
+// Blocks evaluate to the value of their last statement, just like the if expression.
+// An if expression without else whose condition is false evaluates to null, so it's kept.
+func eliminateBranch(node *ast.IfExpression) ast.Node {
+	if !isLiteral(node.TestCondition) {
+		return node
+	}
+
+	b, isBoolean := node.TestCondition.(*ast.BooleanLiteral)
+	switch {
+	case !isBoolean || b.Value:
+		return node.ThenPath
+	case node.ElsePath != nil:
+		return node.ElsePath
+	}
+	return node
+}
+
+// Drops the statements whose value is never used and that have no effect:
+// literals and if expressions whose condition is false, unless they end the list.
+func dropDeadStatements(statements []ast.Statement) ([]ast.Statement, bool) {
+	kept := []ast.Statement{}
+	for i, stmt := range statements {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if ok && i < len(statements)-1 && isDead(es.Expression) {
+			continue
+		}
+		kept = append(kept, stmt)
+	}
+	return kept, len(kept) != len(statements)
+}
+
+func isDead(expr ast.Expression) bool {
+	if ie, ok := expr.(*ast.IfExpression); ok {
+		b, ok := ie.TestCondition.(*ast.BooleanLiteral)
+		return ok && !b.Value && ie.ElsePath == nil
+	}
+	return isLiteral(expr)
+}
+
+func isLiteral(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral:
+		return true
+	}
+	return false
+}
+
+// Returns a copy of the literal located at the token, so that errors are reported where it's used
+func literalAt(literal ast.Expression, tok token.Token) ast.Expression {
+	switch literal := literal.(type) {
+	case *ast.IntegerLiteral:
+		return integerLiteral(literal.Value, tok)
+	case *ast.StringLiteral:
+		return stringLiteral(literal.Value, tok)
+	case *ast.BooleanLiteral:
+		return booleanLiteral(literal.Value, tok)
+	}
+	return literal
+}
+
+func integerLiteral(value int64, at token.Token) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Pos: at.Pos, End: at.End}, Value: value}
+}
+
+func stringLiteral(value string, at token.Token) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: value, Pos: at.Pos, End: at.End}, Value: value}
+}
+
+func booleanLiteral(value bool, at token.Token) *ast.BooleanLiteral {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Pos: at.Pos, End: at.End}
+	if value {
+		tok.Type, tok.Literal = token.TRUE, "true"
+	}
+	return &ast.BooleanLiteral{Token: tok, Value: value}
+}
@@ -0,0 +1,155 @@
+package optimizer
+
+import (
+	"YARTBML/ast"
+	"YARTBML/evaluator"
+	"YARTBML/lexer"
+	"YARTBML/object"
+	"YARTBML/parser"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 60 * 60;", "7200"},
+		{"1 + 2 * 3 - 4 / 2;", "5"},
+		{"-(5 + 5);", "-10"},
+		{"!true;", "false"},
+		{"!!5;", "true"},
+		{"1 < 2 == true;", "true"},
+		{"true != false;", "true"},
+		{`"Hello" + " " + "World";`, "Hello World"},
+		{"(1 + 2) ?? x;", "3"},
+		{"x ?? 1 + 2;", "(x ?? 3)"},
+		{"`${60 * 60} seconds, ${!false}, ${\"a\" + \"b\"}`;", "3600 seconds, true, ab"},
+		{"let n = 5; `n is ${n}, x is ${x}`;", "let n = 5;|`n is ${5}, x is ${x}`"},
+		{"x * (2 + 3);", "(x * 5)"},
+		{"1 / 0;", "(1 / 0)"},
+		{`"a" == "a";`, "(a == a)"},
+		{`1 + "a";`, "(1 + a)"},
+		{"-true;", "(-true)"},
+		{"if (true) { 1; } else { 2; };", "1"},
+		{"if (false) { 1; } else { 2; };", "2"},
+		{"if (1 > 2) { 1; } else { 2 * 3; };", "6"},
+		{`if ("") { 1; };`, "1"},
+		{"if (false) { 1; };", "iffalse 1"},
+		{"if (x) { 1 + 1; };", "ifx 2"},
+		{"if (false) { puts(1); }; 5; x;", "x"},
+		{"let n = 5; n * 2;", "let n = 5;|10"},
+		{"let h = 60 * 60; let d = h * 24; d;", "let h = 3600;|let d = 86400;|86400"},
+		{"let s = \"a\"; let t = s + s; t;", "let s = a;|let t = aa;|aa"},
+		{"let n = 5; let f = fn(x) { x + n; }; f(n);", "let n = 5;|let f = fn(x) (x + 5);|f(5)"},
+		// Parameters and other bindings of the name hide the constant
+		{"let n = 5; let f = fn(n) { n; };", "let n = 5;|let f = fn(n) n;"},
+		{"let n = 5; let n = n + 1; n;", "let n = 5;|let n = (n + 1);|n"},
+		{"let n = 5; if (x) { let n = 6; }; n;", "let n = 5;|ifx let n = 6;|n"},
+		{"let f = fn() { n; }; let n = 5; f();", "let f = fn() n;|let n = 5;|f()"},
+		{"let a = [1]; a[0];", "let a = [1];|(a[0])"},
+		// Bindings made by blocks that may not run aren't constants
+		{"if (x) { let n = 5; }; n;", "ifx let n = 5;|n"},
+		{"let f = fn(c) { if (c) { let n = 5; }; n; };", "let f = fn(c) ifc let n = 5;n;"},
+		{"let f = fn() { let n = 5; n; };", "let f = fn() let n = 5;5;"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		before := program.String()
+
+		optimized := Optimize(program)
+		if program.String() != before {
+			t.Errorf("original program of %q changed. got=%q", tt.input, program.String())
+		}
+
+		statements := []string{}
+		for _, stmt := range optimized.Statements {
+			statements = append(statements, stmt.String())
+		}
+		if got := strings.Join(statements, "|"); got != tt.expected {
+			t.Errorf("wrong optimization of %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestOptimizeKeepsOptimalPrograms(t *testing.T) {
+	program := parse(t, "let f = fn(x) { x * 2; }; f(3);")
+	if Optimize(program) != program {
+		t.Errorf("program without anything to optimize was copied")
+	}
+}
+
+// Evaluates the program, returning its value or error along with its output
+func run(program *ast.Program) (string, string) {
+	var out bytes.Buffer
+	sandbox := object.NewSandbox(strings.NewReader(""), &out, &out, object.STDOUT_CAP)
+	result := evaluator.Eval(program, object.NewSandboxedEnvironment(sandbox))
+	if result == nil {
+		return "<nil>", out.String()
+	}
+	return result.Inspect(), out.String()
+}
+
+func TestOptimizedProgramsEvaluateTheSame(t *testing.T) {
+	inputs := []string{
+		"let seconds = 2 * 60 * 60; seconds / 60;",
+		"let greeting = \"Hello\" + \", \" + \"World\"; puts(greeting); len(greeting) * 2;",
+		"let n = 2; let s = `${n} + ${n} = ${n + n}`; puts(s); `${[n]}${s}`;",
+		"let max = fn(a, b) { if (a > b) { a; } else { b; }; }; max(3 * 4, 2 * 7);",
+		"let f = fn() { if (true) { return 1; }; return 2; }; f();",
+		"if (false) { puts(1); }; if (true) { puts(2); }; 3;",
+		"let x = if (false) { 1; }; x;",
+		"let n = 10; let fib = fn(x) { if (x < 2) { x; } else { fib(x - 1) + fib(x - 2); }; }; fib(n);",
+		"let n = 5; let add = fn(x) { x + n; }; let n = 6; add(1);",
+		"let one = 1; [one, one + 1, one * 3][one + 1];",
+		"let k = \"key\"; {k: 1 + 1}[k];",
+		"!(1 < 2) == false;",
+		"let t = true; if (!t) { 1; } else { -(-t); };",
+		"5 + true;",
+		"\"a\" - \"b\";",
+		"let x = 1; x + y;",
+		"let f = fn(c) { if (c) { let n = 5; }; n; }; puts(f(true)); puts(f(false));",
+		"let f = fn() { try { throw \"a\"; let n = 1; } catch (e) { 0; }; n; }; f();",
+		"let f = fn(c) { if (c) { 1; } else { let n = 3; }; n; }; puts(f(false)); f(true);",
+		"if (false) { let n = 5; }; n;",
+		"let f = fn() { let n = 5; let g = fn() { n * 2; }; g(); }; f();",
+	}
+
+	examples, err := filepath.Glob("../../examples/*.ybml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, example := range examples {
+		source, err := os.ReadFile(example)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(source))
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+		expected, expectedOutput := run(program)
+		got, gotOutput := run(Optimize(program))
+
+		if got != expected || gotOutput != expectedOutput {
+			t.Errorf("optimized program evaluates differently: %q\nexpected=%s (output %q)\ngot=%s (output %q)",
+				input, expected, expectedOutput, got, gotOutput)
+		}
+	}
+}
@@ -9,20 +9,29 @@ import (
 	"strconv"
 
 	"YARTBML/ast"
+	"YARTBML/diagnostic"
 	"YARTBML/lexer"
 	"YARTBML/token"
 )
 
 // Parses each token received from the lexer and
-// stores errors into a string array as they are spotted
+// stores errors as diagnostics as they are spotted
 // in the provided YARTBML program (UTF-8 string).
+//
+// Errors are recovered from in panic mode: once an error has been reported,
+// every following error is dropped until the parser synchronizes at the next
+// statement boundary, so that a single mistake doesn't cascade into meaningless
+// errors and the real errors later in the program are still reported.
 type Parser struct {
-	l      *lexer.Lexer // Lexer instance for tokenization
-	errors []string     // Parsing errors encountered
+	l      *lexer.Lexer            // Lexer instance for tokenization
+	errors []diagnostic.Diagnostic // Parsing errors encountered
 
 	curToken  token.Token // Current token being parsed
 	peekToken token.Token // Next token to be parsed
 
+	panicking bool // Set once an error is reported, until the parser synchronizes
+	nesting   int  // Number of braces opened up to the curToken that haven't been closed yet
+
 	// Used to determine if the `curToken`.Type has a parsing function associated with it
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -32,22 +41,26 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseTemplateLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -60,6 +73,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL_INDEX, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL_FIELD, p.parseOptionalField)
+	p.registerInfix(token.COALESCE, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
 
 	// read two tokens, so curToken and peekToken are both set
 	// acts exactly like lexer's position and readPosition (for lookaheads)
@@ -70,9 +87,19 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 // Advances the parser to the next token.
+// Keeps track of the braces that have been opened to synchronize after errors.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.nesting++
+	case token.RBRACE:
+		if p.nesting > 0 {
+			p.nesting--
+		}
+	}
 }
 
 // Parses the entire program and constructs the ast.
@@ -84,7 +111,9 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for p.curToken.Type != token.EOF {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			p.synchronize(0)
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -93,9 +122,34 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// Recovers from an error by skipping the tokens of the broken statement.
+// Stops on the last token of the statement, so that the next token starts a new statement:
+// a `;` ending the statement, or a token followed by `let`, `return`, `throw` or the `}` closing the
+// enclosing block. Only boundaries at the nesting level of the broken statement are considered,
+// and stray closing braces found at the top level are skipped.
+// Stops right away when the closing brace of the enclosing block was already consumed.
+func (p *Parser) synchronize(level int) {
+	for !p.curTokenIs(token.EOF) && p.nesting >= level {
+		if p.nesting == level {
+			if p.curTokenIs(token.SEMICOLON) {
+				break
+			}
+			if p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN) || p.peekTokenIs(token.THROW) {
+				break
+			}
+			if p.peekTokenIs(token.RBRACE) && level > 0 {
+				break
+			}
+		}
+		p.nextToken()
+	}
+
+	p.panicking = false
+}
+
 // Parses each statement and create a statement node and
 // child Expression nodes based on the type of statement node
-// encountered. There is really only two statement types: Let & Return.
+// encountered. There are three statement types: Let, Return & Throw.
 // The rest of the possibilities have to be expression statements.
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
@@ -103,6 +157,8 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -113,12 +169,29 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// Construct LetStatement Node
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		// Destructuring pattern: `let [a, b] = pair;` or `let {"name": n} = person;`
+		p.nextToken()
+		if stmt.Pattern = p.parsePattern(); stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		// Construct Identifier Node: IDENT token & Name of Identifier as Value
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
 
-	// Construct Identifier Node: IDENT token & Name of Identifier as Value
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	// Optional type annotation: `let x: int = 5;`
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		if stmt.Type = p.parseType(); stmt.Type == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -128,9 +201,15 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// Anonymous functions take the name they are bound to
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && fn.Name == nil && stmt.Name != nil {
+		fn.Inferred = stmt.Name.Value
+	}
+
 	if !p.expectPeek(token.SEMICOLON) {
 		return nil
 	}
+	stmt.Semicolon = p.curToken
 
 	return stmt
 }
@@ -146,6 +225,23 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	if !p.expectPeek(token.SEMICOLON) {
 		return nil
 	}
+	stmt.Semicolon = p.curToken
+
+	return stmt
+}
+
+// Parse Throw Statements down to the thrown Value-Expression Node
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+	stmt.Semicolon = p.curToken
 
 	return stmt
 }
@@ -159,8 +255,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, "invalid-integer", "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -185,7 +280,9 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 const (
 	_ int = iota
 	LOWEST
+	COALESCE    // ??
 	EQUALS      // ==
+	MEMBERSHIP  // x in s
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
@@ -198,6 +295,7 @@ const (
 var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
+	token.IN:       MEMBERSHIP,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
 	token.PLUS:     SUM,
@@ -206,6 +304,20 @@ var precedences = map[token.TokenType]int{
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+
+	token.OPTIONAL_INDEX: INDEX,
+	token.OPTIONAL_FIELD: INDEX,
+	token.COALESCE:       COALESCE,
+}
+
+// Returns the precedence of the given token when it's used as an infix operator
+// Defaults to LOWEST for tokens that aren't infix operators
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
 }
 
 // Returns the precedence associated with the peekToken of the Parser
@@ -250,8 +362,7 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 
 // Appends to Parser Instance's errors when a token has no assigned prefix parse function
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, "expected-expression", "no prefix parse function for %s found", t)
 }
 
 // Parse Expression Statements with LOWEST operator precedence as we haven't
@@ -271,6 +382,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	if !p.expectPeek(token.SEMICOLON) {
 		return nil
 	}
+	stmt.Semicolon = p.curToken
 
 	return stmt
 }
@@ -361,10 +473,11 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 // A Grouped Expression is when parentheses are used to influence an expression's precedence
 // therefore affecting the order in which they are evaluated in their context. Example: (5 + 5) * 2
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	opener := p.curToken
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClosing(token.RPAREN, opener) {
 		return nil
 	}
 
@@ -385,19 +498,40 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	level := p.nesting
+	// When the block is parsed after an error, the statement holding the block synchronizes
+	outerPanic := p.panicking
 
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
 
-		if stmt != nil {
+		if p.panicking && !outerPanic {
+			p.synchronize(level)
+			// The closing brace of the block was consumed by the broken statement
+			if p.nesting < level {
+				return block
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.RBRACE) {
+		block.Closing = p.curToken
+	}
+	if p.curTokenIs(token.EOF) {
+		if err := p.errorAt(p.curToken, "unexpected-token", "expected next token to be }, got EOF instead"); err != nil {
+			err.Related = append(err.Related, diagnostic.Note{
+				Message: "unclosed { opened here",
+				Span:    diagnostic.TokenSpan(block.Token),
+			})
+		}
+	}
+
 	return block
 }
 
@@ -409,11 +543,12 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
+	opener := p.curToken
 
 	p.nextToken()
 	expression.TestCondition = p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClosing(token.RPAREN, opener) {
 		return nil
 	}
 
@@ -437,6 +572,52 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// Parses Try Expressions: try { <body> } catch (<identifier>) { <catch> } finally { <finally> }
+// Either the catch or the finally block may be left out, but not both.
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		opener := p.curToken
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectClosing(token.RPAREN, opener) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errorAt(p.peekToken, "unexpected-token", "expected catch or finally after try block, got %s instead", p.peekToken.Type)
+		return nil
+	}
+
+	return expression
+}
+
 // Parse Function Literals
 // Functions are defined with the keyword `fn`, followed by a list of parameters,
 // followed by a block statement, which is the function's body, that gets executed when
@@ -463,11 +644,26 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	literal := &ast.FunctionLiteral{Token: p.curToken}
 
+	// Optional name: `fn fib(n) { ... }`
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		literal.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
-	literal.Parameters = p.parseFunctionParameters()
+	p.parseFunctionParameters(literal)
+
+	// Optional result type: `fn(x: int) -> int { ... }`
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		if literal.ReturnType = p.parseType(); literal.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -480,35 +676,167 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 // Parse Function Literal Parameters as they are a series of identifiers.
 // Example: add(x, y, z) -> x, y, z are all identifiers
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+//
+// Each identifier may be followed by a type annotation: add(x: int, y) -> x is annotated, y isn't,
+// and by a default value: add(x, y = 1). The last identifier may be preceded by `...`
+// to collect the remaining arguments: add(x, ...others).
+// The types and defaults are set alongside the identifiers, nil when no parameter has any.
+func (p *Parser) parseFunctionParameters(literal *ast.FunctionLiteral) {
 	identifiers := []*ast.Identifier{}
+	types := []ast.TypeNode{}
+	defaults := []ast.Expression{}
+	annotated, defaulted, variadic := false, false, false
+	opener := p.curToken
 
 	// No identifiers aka fn ()
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		literal.Parameters = identifiers
+		return
 	}
 
-	p.nextToken()
+	// Parses the identifier at the peekToken along with its annotation and default value
+	parseParameter := func() bool {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			// The rest of the arguments, which ends the parameters
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			variadic = true
+		} else {
+			p.nextToken() // Cur Token: Identifier | Peek Token: Colon, Assign, Comma or RParen (ideally)
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		identifiers = append(identifiers, ident)
+
+		var t ast.TypeNode
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if t = p.parseType(); t == nil {
+				return false
+			}
+			annotated = true
+		}
+		types = append(types, t)
+
+		var d ast.Expression
+		if !variadic && p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			if d = p.parseExpression(LOWEST); d == nil {
+				return false
+			}
+			defaulted = true
+		}
+		defaults = append(defaults, d)
+		return true
+	}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+	if !parseParameter() {
+		return
+	}
 
 	// While there is a comma indicating another identifier, keep parsing identifiers
-	for p.peekTokenIs(token.COMMA) {
+	for !variadic && p.peekTokenIs(token.COMMA) {
 		p.nextToken() // Cur Token: Comma | Peek Token: Identifier
-		p.nextToken() // Cur Token: Identifier | Peek Token: Comma or RParen (ideally)
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		if !parseParameter() {
+			return
+		}
 	}
 
 	// At this point, we should have finished all identifiers within function definition
 	// and at the peekToken should be closing `)`
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+	if !p.expectClosing(token.RPAREN, opener) {
+		return
+	}
+
+	literal.Parameters, literal.Variadic = identifiers, variadic
+	if annotated {
+		literal.ParameterTypes = types
+	}
+	if defaulted {
+		literal.Defaults = defaults
+	}
+}
+
+// Parses the type annotation starting at the current token:
+//
+//	int                  // Named type
+//	[int]                // Array type
+//	{string: int}        // Hash type
+//	fn(int, int) -> int  // Function type
+//
+// Returns nil when the annotation isn't a type.
+func (p *Parser) parseType() ast.TypeNode {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+
+	case token.LBRACKET:
+		t := &ast.ArrayType{Token: p.curToken}
+		p.nextToken()
+		if t.Element = p.parseType(); t.Element == nil {
+			return nil
+		}
+		if !p.expectClosing(token.RBRACKET, t.Token) {
+			return nil
+		}
+		t.Closing = p.curToken
+		return t
+
+	case token.LBRACE:
+		t := &ast.HashType{Token: p.curToken}
+		p.nextToken()
+		if t.Key = p.parseType(); t.Key == nil {
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		if t.Value = p.parseType(); t.Value == nil {
+			return nil
+		}
+		if !p.expectClosing(token.RBRACE, t.Token) {
+			return nil
+		}
+		t.Closing = p.curToken
+		return t
+
+	case token.FUNCTION:
+		t := &ast.FunctionType{Token: p.curToken, Parameters: []ast.TypeNode{}}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		opener := p.curToken
+		for !p.peekTokenIs(token.RPAREN) {
+			p.nextToken()
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			t.Parameters = append(t.Parameters, param)
+			if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		if !p.expectClosing(token.RPAREN, opener) {
+			return nil
+		}
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+		if t.Result = p.parseType(); t.Result == nil {
+			return nil
+		}
+		return t
 	}
 
-	return identifiers
+	p.errorAt(p.curToken, "expected-type", "expected a type, got %s instead", p.curToken.Type)
+	return nil
 }
 
 // Parses whenever an identifer is being invoked as a function
@@ -522,14 +850,17 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 // identifier and the right being the list of arguments.
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArguments()
+	exp.Closing = p.curToken
 	return exp
 }
 
 // Parses the argument list that is being invoked within an CallExpression
 // or rather the arguments being passed to a function when it is being invoked.
+// Arguments preceded by `...` spread the elements of an array: f(...args)
 func (p *Parser) parseCallArguments() []ast.Expression {
 	args := []ast.Expression{}
+	opener := p.curToken
 
 	// Indicates we are the end of arguments being passed into a function being invoked.
 	if p.peekTokenIs(token.RPAREN) {
@@ -538,22 +869,35 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseCallArgument())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken() // curToken: token.COMMA | peekToken: argument
 		p.nextToken() // curToken: argument | peekToken: comma or RPAREN (ideally)
 
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseCallArgument())
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClosing(token.RPAREN, opener) {
 		return nil
 	}
 
 	return args
 }
 
+// Parses the argument starting at the current token, possibly spread
+func (p *Parser) parseCallArgument() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	if spread.Value = p.parseExpression(LOWEST); spread.Value == nil {
+		return nil
+	}
+	return spread
+}
+
 // Parses Identifer Statements
 // An Identifier is the simplest expression type
 //
@@ -596,17 +940,53 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
-// Returns all parsing errors encountered
-func (p *Parser) Errors() []string {
-	return p.errors
+// Checks if the nextToken is the given TokenType closing the opener token, e.g. the `)`
+// closing a `(`. Works like expectPeek, but the error also points at the unclosed opener.
+func (p *Parser) expectClosing(t token.TokenType, opener token.Token) bool {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+		return true
+	}
+
+	if err := p.peekError(t); err != nil {
+		err.Related = append(err.Related, diagnostic.Note{
+			Message: fmt.Sprintf("unclosed %s opened here", opener.Literal),
+			Span:    diagnostic.TokenSpan(opener),
+		})
+	}
+	return false
+}
+
+// Returns all errors encountered while tokenizing and parsing, in the order they appear in the program
+func (p *Parser) Errors() []diagnostic.Diagnostic {
+	errors := append(append([]diagnostic.Diagnostic{}, p.l.Errors()...), p.errors...)
+	diagnostic.Sort(errors)
+	return errors
 }
 
 // Appends to errors property of the Parser Instance when the nextToken
 // is not what is expected.
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+func (p *Parser) peekError(t token.TokenType) *diagnostic.Diagnostic {
+	return p.errorAt(p.peekToken, "unexpected-token", "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+}
+
+// Appends an error positioned at the given token to the errors of the Parser Instance.
+// The error is dropped while panicking, as it most likely is a consequence of the first error,
+// and errors on illegal tokens are dropped as the lexer already reported them.
+// Returns the appended error so that notes can be attached to it, or nil when it was dropped.
+func (p *Parser) errorAt(tok token.Token, code string, format string, a ...interface{}) *diagnostic.Diagnostic {
+	if p.panicking {
+		return nil
+	}
+	p.panicking = true
+
+	if tok.Type == token.ILLEGAL {
+		return nil
+	}
+
+	p.errors = append(p.errors, diagnostic.Errorf(diagnostic.TokenSpan(tok), code, format, a...))
+	return &p.errors[len(p.errors)-1]
 }
 
 // Constructs an AST node for string literals.
@@ -616,6 +996,34 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// Constructs an AST node for template strings.
+// Is called when the current token starts a template string, and parses the value
+// following each part of the template until the part ending it is reached.
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{Token: p.curToken, Parts: []string{p.curToken.Literal}}
+
+	for !p.curTokenIs(token.TEMPLATE) && !p.curTokenIs(token.TEMPLATE_TAIL) {
+		p.nextToken()
+		template.Values = append(template.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(token.TEMPLATE_MIDDLE) && !p.peekTokenIs(token.TEMPLATE_TAIL) {
+			if err := p.errorAt(p.peekToken, "unexpected-token",
+				"expected } closing the embedded value, got %s instead", p.peekToken.Type); err != nil {
+				err.Related = append(err.Related, diagnostic.Note{
+					Message: "template string starts here",
+					Span:    diagnostic.TokenSpan(template.Token),
+				})
+			}
+			return nil
+		}
+		p.nextToken()
+		template.Parts = append(template.Parts, p.curToken.Literal)
+	}
+	template.Tail = p.curToken
+
+	return template
+}
+
 // Constructs an AST node for array literals
 // Begins when current token is a left bracket '[' and parses through
 // all expressions until a right bracket ']' is reached
@@ -625,6 +1033,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Closing = p.curToken
 
 	return array
 }
@@ -635,6 +1044,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 // elements in array literals, or arguments in index expressions
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	list := []ast.Expression{}
+	opener := p.curToken
 
 	if p.peekTokenIs(end) {
 		p.nextToken()
@@ -650,7 +1060,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectClosing(end, opener) {
 		return nil
 	}
 
@@ -665,12 +1075,49 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
 	p.nextToken()
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
 	exp.Index = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
 
-	if !p.expectPeek(token.RBRACKET) {
+	if !p.expectClosing(token.RBRACKET, exp.Token) {
 
 		return nil
 	}
+	exp.Closing = p.curToken
+
+	return exp
+}
+
+// Constructs a slice expression from the colon following its lower bound, if any: `xs[1:3]`, `xs[:-1]` or `xs[2:]`
+func (p *Parser) parseSliceExpression(opener token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: opener, Left: left, Low: low}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectClosing(token.RBRACKET, exp.Token) {
+		return nil
+	}
+	exp.Closing = p.curToken
+
+	return exp
+}
+
+// Constructs an index expression for null-safe field accesses: `person?.name` indexes person with "name"
+func (p *Parser) parseOptionalField(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Index = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 
 	return exp
 }
@@ -702,9 +1149,187 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		}
 	}
 
-	if !p.expectPeek(token.RBRACE) {
+	if !p.expectClosing(token.RBRACE, hash.Token) {
 		return nil
 	}
+	hash.Closing = p.curToken
 
 	return hash
 }
+
+// Constructs an AST node for match expressions
+// Begins when the current token is the `match` keyword, followed by the matched value
+// within parentheses and the arms within braces, separated by commas:
+//
+//	match (value) { [head, ...tail] => head, _ => 0 }
+func (p *Parser) parseMatchExpression() ast.Expression {
+	match := &ast.MatchExpression{Token: p.curToken, Arms: []*ast.MatchArm{}}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	opener := p.curToken
+	p.nextToken()
+	match.Value = p.parseExpression(LOWEST)
+	if !p.expectClosing(token.RPAREN, opener) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	opener = p.curToken
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		match.Arms = append(match.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectClosing(token.RBRACE, opener) {
+		return nil
+	}
+	match.Closing = p.curToken
+
+	return match
+}
+
+// Parses an arm of a match expression: <pattern> [if <guard>] => <value>
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.FAT_ARROW) {
+		return nil
+	}
+	arm.Token = p.curToken
+	p.nextToken()
+	arm.Value = p.parseExpression(LOWEST)
+
+	return arm
+}
+
+// Parses the pattern starting at the current token:
+//
+//	x                   // Identifier
+//	_                   // Wildcard
+//	5, "a", true, -1    // Literal
+//	[head, ...tail]     // Array pattern
+//	{"name": n}         // Hash pattern
+//
+// Returns nil when there is no pattern.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		if p.curToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}
+		}
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	case token.INT, token.STRING, token.TRUE, token.FALSE, token.MINUS:
+		if value := p.parsePatternLiteral(); value != nil {
+			return &ast.LiteralPattern{Token: ast.FirstToken(value), Value: value}
+		}
+		return nil
+
+	case token.LBRACKET:
+		pattern := &ast.ArrayPattern{Token: p.curToken, Elements: []ast.Pattern{}}
+		for !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			if p.curTokenIs(token.ELLIPSIS) {
+				// The rest of the elements, which ends the pattern
+				if !p.expectPeek(token.IDENT) {
+					return nil
+				}
+				pattern.Rest = p.parsePattern()
+				break
+			}
+
+			element := p.parsePattern()
+			if element == nil {
+				return nil
+			}
+			pattern.Elements = append(pattern.Elements, element)
+
+			if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		if !p.expectClosing(token.RBRACKET, pattern.Token) {
+			return nil
+		}
+		pattern.Closing = p.curToken
+		return pattern
+
+	case token.LBRACE:
+		pattern := &ast.HashPattern{Token: p.curToken, Keys: []ast.Expression{}, Values: []ast.Pattern{}}
+		for !p.peekTokenIs(token.RBRACE) {
+			p.nextToken()
+			key := p.parsePatternLiteral()
+			if key == nil {
+				return nil
+			}
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value := p.parsePattern()
+			if value == nil {
+				return nil
+			}
+			pattern.Keys = append(pattern.Keys, key)
+			pattern.Values = append(pattern.Values, value)
+
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		if !p.expectClosing(token.RBRACE, pattern.Token) {
+			return nil
+		}
+		pattern.Closing = p.curToken
+		return pattern
+	}
+
+	p.errorAt(p.curToken, "expected-pattern", "expected a pattern, got %s instead", p.curToken.Type)
+	return nil
+}
+
+// Parses the integer, string or boolean literal of a pattern, or a negative integer
+func (p *Parser) parsePatternLiteral() ast.Expression {
+	switch p.curToken.Type {
+	case token.INT:
+		return p.parseIntegerLiteral()
+	case token.STRING:
+		return p.parseStringLiteral()
+	case token.TRUE, token.FALSE:
+		return p.parseBooleanLiteral()
+	case token.MINUS:
+		minus := p.curToken
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		right := p.parseIntegerLiteral()
+		if right == nil {
+			return nil
+		}
+		return &ast.PrefixExpression{Token: minus, Operator: "-", Right: right}
+	}
+
+	p.errorAt(p.curToken, "expected-pattern", "expected a literal, got %s instead", p.curToken.Type)
+	return nil
+}
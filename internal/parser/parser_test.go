@@ -3,11 +3,15 @@ package parser
 // TODO: Mock / Stub out the Lexer
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"YARTBML/ast"
 	"YARTBML/lexer"
+	"YARTBML/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -505,6 +509,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1]);",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"x + 1 in s == y in t;",
+			"(((x + 1) in s) == (y in t))",
+		},
+		{
+			"a < b in s;",
+			"((a < b) in s)",
+		},
+		{
+			"a?.b?[c + 1] ?? d;",
+			"(((a?.b)?[(c + 1)]) ?? d)",
+		},
+		{
+			"a ?? b == c ?? d;",
+			"((a ?? (b == c)) ?? d)",
+		},
+		{
+			"-a?.b ?? f(x)?[0];",
+			"((-(a?.b)) ?? (f(x)?[0]))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -766,6 +790,225 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestTypeAnnotationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let xs: [int] = [];", "let xs: [int] = [];"},
+		{"let h: {string: [bool]} = {};", "let h: {string: [bool]} = {};"},
+		{"let f: fn(int, string) -> null = g;", "let f: fn(int, string) -> null = g;"},
+		{"let f: fn() -> fn(int) -> int = g;", "let f: fn() -> fn(int) -> int = g;"},
+		{"fn(a: int, b) -> int { a; };", "fn(a: int, b) -> int a"},
+		{"fn(a, b) -> any { a; };", "fn(a, b) -> any a"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("fn(a, b: [int]) { a; };"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if function.ParameterType(0) != nil {
+		t.Errorf("unannotated parameter has a type. got=%s", function.ParameterType(0))
+	}
+	if typ, ok := function.ParameterType(1).(*ast.ArrayType); !ok || typ.Element.String() != "int" {
+		t.Errorf("wrong type of the annotated parameter. got=%s", function.ParameterType(1))
+	}
+
+	p = New(lexer.New("fn(a) { a; };"))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	function = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if function.ParameterTypes != nil || function.ReturnType != nil {
+		t.Errorf("function without annotations has types")
+	}
+}
+
+func TestNamedFunctionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		name     string
+	}{
+		{"fn fib(n) { n; };", "fn fib(n) n", "fib"},
+		{"let f = fn fib(n) { n; };", "let f = fn fib(n) n;", "fib"},
+		{"let f = fn(n) { n; };", "let f = fn(n) n;", "f"},
+		{"fn(n) { n; };", "fn(n) n", ""},
+		{"let f = g(fn(n) { n; });", "let f = g(fn(n) n);", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+		var function *ast.FunctionLiteral
+		ast.Inspect(program, func(node ast.Node) bool {
+			if fn, ok := node.(*ast.FunctionLiteral); ok && function == nil {
+				function = fn
+			}
+			return true
+		})
+		if function.DisplayName() != tt.name {
+			t.Errorf("wrong name for %q. expected=%q, got=%q", tt.input, tt.name, function.DisplayName())
+		}
+	}
+}
+
+func TestParameterDefaultsAndSpreadParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		least    int
+		most     int
+	}{
+		{"fn(a, b = 10) { a; };", "fn(a, b = 10) a", 1, 2},
+		{"fn(a = 1, b = a + 1) { a; };", "fn(a = 1, b = (a + 1)) a", 0, 2},
+		{"fn(a: int = 1, b) { a; };", "fn(a: int = 1, b) a", 2, 2},
+		{"fn(first, ...others) { first; };", "fn(first, ...others) first", 1, -1},
+		{"fn(a, b = 2, ...rest: [int]) { a; };", "fn(a, b = 2, ...rest: [int]) a", 1, -1},
+		{"fn(...all) { all; };", "fn(...all) all", 0, -1},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if least, most := function.Arity(); least != tt.least || most != tt.most {
+			t.Errorf("wrong arity for %q. expected=%d..%d, got=%d..%d", tt.input, tt.least, tt.most, least, most)
+		}
+	}
+
+	p := New(lexer.New("f(1, ...xs, ...[2, 3]);"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if got := program.String(); got != "f(1, ...xs, ...[2, 3])" {
+		t.Errorf("wrong program. got=%q", got)
+	}
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if _, ok := call.Arguments[1].(*ast.SpreadExpression); !ok {
+		t.Errorf("argument is not a spread. got=%T", call.Arguments[1])
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { 1 => a, -2 => b, \"s\" => c, true => d };", "match (x) { 1 => a, (-2) => b, s => c, true => d }"},
+		{"match (x) { _ => 0, };", "match (x) { _ => 0 }"},
+		{"match (x) { n if n > 1 => n * 2, n => n };", "match (x) { n if (n > 1) => (n * 2), n => n }"},
+		{"match (xs) { [] => 0, [a] => a, [a, [b, _], ...rest] => rest };", "match (xs) { [] => 0, [a] => a, [a, [b, _], ...rest] => rest }"},
+		{"match (xs) { [...all] => all, [_, ..._] => 1 };", "match (xs) { [...all] => all, [_, ..._] => 1 }"},
+		{"match (p) { {\"name\": n, 1: [x, ...xs]} => n, {} => 0 };", "match (p) { {name:n, 1:[x, ...xs]} => n, {} => 0 }"},
+		{"match (x) {};", "match (x) {  }"},
+		{"match (f(x)) { 1 => {\"a\": 1} }[\"a\"];", "(match (f(x)) { 1 => {a:1} }[a])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("match (x) { [a, ...b] => 1 };"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	match := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	names := ast.PatternNames(match.Arms[0].Pattern)
+	if len(names) != 2 || names[0].Value != "a" || names[1].Value != "b" {
+		t.Errorf("wrong names bound by the pattern. got=%v", names)
+	}
+}
+
+func TestDestructuringLetParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		names    []string
+	}{
+		{"let [a, b] = pair;", "let [a, b] = pair;", []string{"a", "b"}},
+		{"let [x, ...xs] = arr;", "let [x, ...xs] = arr;", []string{"x", "xs"}},
+		{"let [_, [b, c]]: [any] = arr;", "let [_, [b, c]]: [any] = arr;", []string{"b", "c"}},
+		{`let {"name": n, "age": a} = person;`, "let {name:n, age:a} = person;", []string{"n", "a"}},
+		{"let {} = h;", "let {} = h;", []string{}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+
+		stmt := program.Statements[0].(*ast.LetStatement)
+		if stmt.Name != nil {
+			t.Errorf("destructuring let has a name: %s", stmt.Name)
+		}
+		names := []string{}
+		for _, name := range ast.PatternNames(stmt.Pattern) {
+			names = append(names, name.Value)
+		}
+		if strings.Join(names, " ") != strings.Join(tt.names, " ") {
+			t.Errorf("wrong names bound by %q. expected=%v, got=%v", tt.input, tt.names, names)
+		}
+	}
+}
+
+func TestTryAndThrowParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"throw \"bad\";", "throw bad;"},
+		{"throw error(\"bad\", \"input\");", "throw error(bad, input);"},
+		{"try { f(); } catch (e) { e; };", "try f() catch (e) e"},
+		{"try { f(); } finally { g(); };", "try f() finally g()"},
+		{"let x = try { f(); } catch (e) { throw e; } finally { g(); };", "let x = try f() catch (e) throw e; finally g();"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("try { f(); };"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0].String() != "1:13: expected catch or finally after try block, got ; instead" {
+		t.Errorf("wrong errors for try without catch or finally. got=%q", errors)
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -878,6 +1121,70 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestTemplateLiteralParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    []string
+	}{
+		{"`hello`;", "`hello`", []string{"hello"}},
+		{"`Hello ${name}, you are ${age + 1}`;", "`Hello ${name}, you are ${(age + 1)}`", []string{"Hello ", ", you are ", ""}},
+		{"`${f(`${x}`)}!`;", "`${f(`${x}`)}!`", []string{"", "!"}},
+		{"`${ {\"a\": 1}[\"a\"] }`;", "`${({a:1}[a])}`", []string{"", ""}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		template, ok := stmt.Expression.(*ast.TemplateLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+		}
+		if template.String() != tt.expected {
+			t.Errorf("wrong template for %q. expected=%q, got=%q", tt.input, tt.expected, template.String())
+		}
+		if !reflect.DeepEqual(template.Parts, tt.parts) {
+			t.Errorf("wrong parts for %q. expected=%q, got=%q", tt.input, tt.parts, template.Parts)
+		}
+		if len(template.Values) != len(template.Parts)-1 {
+			t.Errorf("wrong number of values for %q. got=%d", tt.input, len(template.Values))
+		}
+	}
+}
+
+// Malformed embedded values are reported once, without stopping the parser
+func TestMalformedTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedError      string
+		expectedStatements string
+	}{
+		{"let x = `a ${1 +} b`;", "1:17: no prefix parse function for TEMPLATE_TAIL found", ""},
+		{"let x = `a ${)} b`;", "1:14: no prefix parse function for ) found", ""},
+		{"let x = `a ${} b`;", "1:14: no prefix parse function for TEMPLATE_TAIL found", ""},
+		{"let x = `a ${@} b`;", "1:14: illegal character '@'", ""},
+		{"let x = `a ${1 2} b`; let y = 1;", "1:16: expected } closing the embedded value, got INT instead", "let y = 1;"},
+		{"`${`${+}`}`;", "1:7: no prefix parse function for + found", ""},
+		{"let x = `a ${1", "1:15: expected } closing the embedded value, got EOF instead", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0].String() != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+		if program.String() != tt.expectedStatements {
+			t.Errorf("wrong statements for %q. expected=%q, got=%q", tt.input, tt.expectedStatements, program.String())
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3];"
 
@@ -923,6 +1230,79 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingOptionalIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		token token.TokenType
+		index interface{}
+	}{
+		{"person?.name;", token.OPTIONAL_FIELD, "name"},
+		{"people?[1];", token.OPTIONAL_INDEX, 1},
+		{"people[1];", token.LBRACKET, 1},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+		}
+		if indexExp.Token.Type != tt.token {
+			t.Errorf("indexExp.Token.Type not %s. got=%s", tt.token, indexExp.Token.Type)
+		}
+		if indexExp.Optional() != (tt.token != token.LBRACKET) {
+			t.Errorf("indexExp.Optional() wrong for %q", tt.input)
+		}
+		if name, ok := tt.index.(string); ok {
+			str, ok := indexExp.Index.(*ast.StringLiteral)
+			if !ok || str.Value != name {
+				t.Errorf("indexExp.Index not the string %q. got=%s", name, indexExp.Index)
+			}
+		} else if !testLiteralExpression(t, indexExp.Index, tt.index) {
+			return
+		}
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs[1:3];", "(xs[1:3])"},
+		{"xs[:-1];", "(xs[:(-1)])"},
+		{"xs[i + 1:];", "(xs[(i + 1):])"},
+		{"xs[:];", "(xs[:])"},
+		{"xs?[1:][0];", "((xs?[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if got := stmt.Expression.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	p := New(lexer.New("xs[1:3];"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	slice, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, slice.Left, "xs")
+	testIntegerLiteral(t, slice.Low, 1)
+	testIntegerLiteral(t, slice.High, 3)
+}
+
 func TestParsingHashLiteralStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3};`
 
@@ -1024,3 +1404,214 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements string
+	}{
+		{
+			"let x = add(1, 2;\nlet y = 3;\nlet z = ;\nlet w = 4;",
+			[]string{
+				"1:17: expected next token to be ), got ; instead",
+				"3:9: no prefix parse function for ; found",
+			},
+			"let y = 3;let w = 4;",
+		},
+		{
+			"let f = fn(x) {\n  add(x, 1;\n  let = 2;\n  x;\n};\nlet ok = 1;\nlet 5;",
+			[]string{
+				"2:11: expected next token to be ), got ; instead",
+				"3:7: expected next token to be IDENT, got = instead",
+				"7:5: expected next token to be IDENT, got INT instead",
+			},
+			"let f = fn(x) x;let ok = 1;",
+		},
+		{
+			"let h = {\"a\" 1};\nlet g = fn() { let h = {\"a\" 1}; x; };\nx +;",
+			[]string{
+				"1:14: expected next token to be :, got INT instead",
+				"2:29: expected next token to be :, got INT instead",
+				"3:4: no prefix parse function for ; found",
+			},
+			"let g = fn() x;",
+		},
+		{
+			"let x = 5 }; let y = ; z;",
+			[]string{
+				"1:11: expected next token to be ;, got } instead",
+				"1:22: no prefix parse function for ; found",
+			},
+			"z",
+		},
+		{
+			"let f = fn(a, b { a + b; }; let y = 1; let q = );",
+			[]string{
+				"1:17: expected next token to be ), got { instead",
+				"1:48: no prefix parse function for ) found",
+			},
+			"let y = 1;",
+		},
+		{
+			"let x: 5 = 1;\nlet f = fn(a: [int) { a; };\nlet ok = 1;",
+			[]string{
+				"1:8: expected a type, got INT instead",
+				"2:19: expected next token to be ], got ) instead",
+			},
+			"let ok = 1;",
+		},
+		{
+			"match (x) { y + 1 => 1 };\nmatch (x) { [...] => 1 };\nmatch (x) { {a: 1} => 1, 2 };\nlet ok = 1;",
+			[]string{
+				"1:15: expected next token to be =>, got + instead",
+				"2:17: expected next token to be IDENT, got ] instead",
+				"3:14: expected a literal, got IDENT instead",
+			},
+			"let ok = 1;",
+		},
+		{
+			"let [a, b = pair;\nlet {\"a\" x} = h;\nlet ok = 1;",
+			[]string{
+				"1:11: expected next token to be ,, got = instead",
+				"2:10: expected next token to be :, got IDENT instead",
+			},
+			"let ok = 1;",
+		},
+		{
+			"let f = fn(...a, b) { a; };\nlet g = fn(a, b = ) { a; };\n[...xs];\nlet ok = 1;",
+			[]string{
+				"1:16: expected next token to be ), got , instead",
+				"2:19: no prefix parse function for ) found",
+				"3:2: no prefix parse function for ... found",
+			},
+			"let ok = 1;",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%d (%q)",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i].String() != msg {
+				t.Errorf("wrong error message. expected=%q, got=%q", msg, errors[i])
+			}
+		}
+
+		if program.String() != tt.expectedStatements {
+			t.Errorf("wrong statements recovered. expected=%q, got=%q",
+				tt.expectedStatements, program.String())
+		}
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	input := "let x = add(1, 2;\nlet y = @;\nlet s = `a${x y}`;\nlet f = fn() { x;"
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+	errors := p.Errors()
+
+	expected := []struct {
+		code    string
+		message string
+		related string
+	}{
+		{"unexpected-token", "1:17: expected next token to be ), got ; instead", "1:12: unclosed ( opened here"},
+		{"illegal-character", "2:9: illegal character '@'", ""},
+		{"unexpected-token", "3:15: expected } closing the embedded value, got IDENT instead", "3:9: template string starts here"},
+		{"unexpected-token", "4:18: expected next token to be }, got EOF instead", "4:14: unclosed { opened here"},
+	}
+
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d (%q)", len(expected), len(errors), errors)
+	}
+
+	for i, tt := range expected {
+		err := errors[i]
+		if err.Code != tt.code || err.String() != tt.message {
+			t.Errorf("errors[%d] wrong. expected=%s %q, got=%s %q", i, tt.code, tt.message, err.Code, err.String())
+		}
+
+		related := ""
+		if len(err.Related) > 0 {
+			related = err.Related[0].Span.Start.String() + ": " + err.Related[0].Message
+		}
+		if related != tt.related {
+			t.Errorf("errors[%d] has wrong related note. expected=%q, got=%q", i, tt.related, related)
+		}
+	}
+}
+
+func TestJSONSpans(t *testing.T) {
+	tests := []struct {
+		input string
+		path  []interface{}
+		end   int
+	}{
+		{"let f = fn(a) { a; };", []interface{}{"statements", 0}, 21},
+		{"let f = fn(a) { a; };", []interface{}{"statements", 0, "value"}, 20},
+		{"let f = fn(a) { a; };", []interface{}{"statements", 0, "value", "body"}, 20},
+		{"f(1, [2])[0];", []interface{}{"statements", 0, "expression"}, 12},
+		{"f(1, [2])[0];", []interface{}{"statements", 0, "expression", "left"}, 9},
+		{"f(1, [2])[0];", []interface{}{"statements", 0, "expression", "left", "arguments", 1}, 8},
+		{"xs[1:];", []interface{}{"statements", 0, "expression"}, 6},
+		{`{"a": 1};`, []interface{}{"statements", 0, "expression"}, 8},
+		{"match (x) { [a] => a };", []interface{}{"statements", 0, "expression"}, 22},
+		{`let [a, {"b": b}] = x;`, []interface{}{"statements", 0, "pattern"}, 17},
+		{`let [a, {"b": b}] = x;`, []interface{}{"statements", 0, "pattern", "elements", 1}, 16},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		encoded, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("EncodeJSON failed: %s", err)
+		}
+		var node interface{}
+		if err := json.Unmarshal(encoded, &node); err != nil {
+			t.Fatalf("invalid JSON: %s", err)
+		}
+		for _, step := range tt.path {
+			switch step := step.(type) {
+			case string:
+				node = node.(map[string]interface{})[step]
+			case int:
+				node = node.([]interface{})[step]
+			}
+		}
+
+		span := node.(map[string]interface{})["span"].(map[string]interface{})
+		end := span["end"].(map[string]interface{})["offset"].(float64)
+		if int(end) != tt.end {
+			t.Errorf("span of %v in %q ends at wrong offset. expected=%d, got=%v", tt.path, tt.input, tt.end, end)
+		}
+	}
+}
+
+func TestJSONLeavesOutResolverFields(t *testing.T) {
+	p := New(lexer.New("let f = fn(a) { a; }; f(1);"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	encoded, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON failed: %s", err)
+	}
+	for _, key := range []string{`"depth"`, `"slot"`, `"slots"`, `"inferred"`} {
+		if strings.Contains(string(encoded), key) {
+			t.Errorf("JSON holds resolver field %s", key)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package repl
+
+import (
+	"YARTBML/lexer"
+	"YARTBML/object"
+	"YARTBML/parser"
+	"YARTBML/token"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Meta-commands start with this prefix to tell them apart from YARTBML code
+const COMMAND_PREFIX = ":"
+
+// A REPL meta-command used to inspect the session, e.g. `:type 5 + 5`
+type command struct {
+	name  string // Name of the command, without the COMMAND_PREFIX
+	usage string // Arguments expected by the command
+	help  string // One line description displayed by `:help`
+	run   func(s *session, arg string)
+}
+
+// Meta-commands understood by the REPL, in the order they're listed by `:help`
+var commands []command
+
+func init() {
+	commands = []command{
+		{"help", "", "list the available commands", (*session).help},
+		{"env", "", "list the bindings of the environment with their types", (*session).listEnv},
+		{"type", "<expr>", "evaluate the expression and print the type of its value", (*session).printType},
+		{"ast", "<expr>", "print the syntax tree of the expression", (*session).printAST},
+		{"tokens", "<expr>", "print the tokens of the expression", (*session).printTokens},
+		{"load", "<file>", "evaluate a YARTBML file within the environment", (*session).load},
+		{"reset", "", "discard every binding of the environment", (*session).reset},
+		{"time", "<expr>", "evaluate the expression and print how long it took", (*session).timeEval},
+	}
+}
+
+// Reports whether the input is a meta-command rather than YARTBML code
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), COMMAND_PREFIX)
+}
+
+// Runs the meta-command written in the input, with the rest of the input as its argument
+func (s *session) runCommand(input string) {
+	input = strings.TrimPrefix(strings.TrimSpace(input), COMMAND_PREFIX)
+	name, arg, _ := strings.Cut(input, " ")
+	if i := strings.IndexAny(name, "\t\n"); i >= 0 {
+		name, arg = name[:i], name[i:]+" "+arg
+	}
+	arg = strings.TrimSpace(arg)
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if cmd.usage != "" && arg == "" {
+				fmt.Fprintf(s.out, "usage: %s%s %s\n", COMMAND_PREFIX, cmd.name, cmd.usage)
+				return
+			}
+			cmd.run(s, arg)
+			return
+		}
+	}
+
+	fmt.Fprintf(s.out, "unknown command: %s%s (type %shelp for a list of commands)\n",
+		COMMAND_PREFIX, name, COMMAND_PREFIX)
+}
+
+// Terminates the expression given to a meta-command with a semicolon when it's missing,
+// as every statement of the language has to end with one.
+func asStatement(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasSuffix(expr, ";") {
+		expr += ";"
+	}
+	return expr
+}
+
+// :help
+func (s *session) help(arg string) {
+	for _, cmd := range commands {
+		usage := COMMAND_PREFIX + cmd.name
+		if cmd.usage != "" {
+			usage += " " + cmd.usage
+		}
+		fmt.Fprintf(s.out, "  %-16s %s\n", usage, cmd.help)
+	}
+}
+
+// :env
+func (s *session) listEnv(arg string) {
+	for _, name := range s.env.Names() {
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s: %s\n", name, value.Type())
+	}
+}
+
+// :type <expr>
+func (s *session) printType(arg string) {
+	evaluated, ok := s.evalInput(asStatement(arg))
+	if !ok {
+		return
+	}
+	if evaluated == nil {
+		io.WriteString(s.out, "no value\n")
+		return
+	}
+	if evaluated.Type() == object.ERROR_OBJ {
+		io.WriteString(s.out, evaluated.Inspect()+"\n")
+		return
+	}
+	io.WriteString(s.out, string(evaluated.Type())+"\n")
+}
+
+// :ast <expr>
+func (s *session) printAST(arg string) {
+	input := asStatement(arg)
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, input, p.Errors())
+		return
+	}
+	printTree(s.out, program)
+}
+
+// :tokens <expr>
+func (s *session) printTokens(arg string) {
+	l := lexer.New(arg)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%-6s %-10s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+// :load <file>
+func (s *session) load(arg string) {
+	contents, err := os.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintf(s.out, "could not load file: %s\n", err)
+		return
+	}
+	s.eval(string(contents))
+}
+
+// :reset
+func (s *session) reset(arg string) {
+	s.env = object.NewSandboxedEnvironment(s.sandbox)
+}
+
+// :time <expr>
+func (s *session) timeEval(arg string) {
+	start := time.Now()
+	s.eval(asStatement(arg))
+	fmt.Fprintf(s.out, "time: %s\n", time.Since(start))
+}
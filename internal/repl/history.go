@@ -0,0 +1,100 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Name of the dotfile, within the user's home directory, that persists the REPL history
+const HISTORY_FILE = ".yartbml_history"
+
+// Maximum number of entries kept in memory and loaded back from the history file
+const historyLimit = 1000
+
+// Entries are stored one per line in the history file, with their newlines and backslashes escaped
+var (
+	escapeEntry   = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	unescapeEntry = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+)
+
+// History of the inputs entered into the REPL
+// When a path is set, every entry is appended to the file so it survives across sessions.
+type history struct {
+	entries []string
+	path    string
+}
+
+// Returns the path of the history dotfile within the user's home directory
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, HISTORY_FILE)
+}
+
+// Creates a history persisted at the given path, loading the entries already saved there
+// An empty path keeps the history in memory only.
+func newHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, unescapeEntry.Replace(line))
+		}
+	}
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[len(h.entries)-historyLimit:]
+	}
+
+	return h
+}
+
+// Adds an entry to the history and appends it to the history file
+// Entries are kept as entered, since line comments and template strings span up to the end of their lines.
+// Blank entries and entries repeating the previous one are skipped.
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	file.WriteString(escapeEntry.Replace(entry) + "\n")
+}
+
+// Returns the number of entries within the history
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+// Returns the entry at the given index, oldest entry first
+func (h *history) At(i int) string {
+	return h.entries[i]
+}
@@ -0,0 +1,108 @@
+package repl
+
+import (
+	"YARTBML/lexer"
+	"YARTBML/token"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const CONTINUATION_PROMPT = ".. "
+
+// Returned by a lineReader when the user abandons the line being typed (Ctrl-C)
+var errInterrupted = errors.New("interrupted")
+
+// Reads a single line of input after displaying the given prompt
+// The returned line doesn't contain its line terminator
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// Reads lines from a (non-interactive) buffered reader, echoing the prompt to out
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	line, err := r.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, nil
+}
+
+// Reads a complete piece of input, which might span several lines.
+// The first line is read with the PROMPT, then lines are read with the
+// CONTINUATION_PROMPT for as long as the input is incomplete.
+// When the input ends while it is still incomplete, the partial input is returned
+// so that the parser can report what is missing.
+func readInput(r lineReader) (string, error) {
+	line, err := r.ReadLine(PROMPT)
+	if err != nil {
+		return "", err
+	}
+
+	input := line
+	for isIncomplete(input) {
+		line, err := r.ReadLine(CONTINUATION_PROMPT)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		input += "\n" + line
+	}
+
+	return input, nil
+}
+
+// Reports whether the input cannot be a complete program yet, meaning
+// that it has unbalanced braces, brackets or parenthesis, an unterminated
+// template string, or that it ends with an operator that still expects an operand.
+func isIncomplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+	last := token.Token{Type: token.EOF}
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET, token.OPTIONAL_INDEX, token.TEMPLATE_HEAD:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET, token.TEMPLATE_TAIL:
+			depth--
+		}
+		last = tok
+	}
+
+	if depth > 0 {
+		return true
+	}
+
+	// Template strings may span several lines
+	if last.Type == token.TEMPLATE || last.Type == token.TEMPLATE_TAIL {
+		for _, err := range l.Errors() {
+			if err.Code == "unterminated-string" && err.Span.Start == last.Pos {
+				return true
+			}
+		}
+	}
+
+	switch last.Type {
+	case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK, token.SLASH,
+		token.LT, token.GT, token.EQ, token.NOT_EQ, token.COMMA, token.COLON, token.ELSE,
+		token.COALESCE, token.OPTIONAL_FIELD, token.IN:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,294 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Control characters understood by the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Line editor used when the REPL is attached to a terminal.
+// Supports moving the cursor around the line (arrows, Home/End, Ctrl-A/Ctrl-E),
+// deleting (Backspace, Delete, Ctrl-K, Ctrl-U), walking through the history
+// (Up/Down, Ctrl-P/Ctrl-N) and completing the word under the cursor (Tab).
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  *history
+	complete func(prefix string) []string // Candidates for the word being completed
+	raw      func() (func(), error)       // Puts the terminal in raw mode, returns a function restoring it
+
+	buf    []rune // Contents of the line being edited
+	cursor int    // Position of the cursor within buf
+}
+
+// Reads a line while letting the user edit it
+// Ctrl-C abandons the line (errInterrupted) and Ctrl-D on an empty line ends the input (io.EOF)
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err == nil {
+			defer restore()
+		}
+	}
+
+	e.buf = e.buf[:0]
+	e.cursor = 0
+	historyIdx := e.history.Len()
+	pending := "" // line being typed before walking through the history
+
+	e.refresh(prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.buf) > 0 {
+				io.WriteString(e.out, "\r\n")
+				return string(e.buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			return string(e.buf), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.buf)
+		case keyCtrlB:
+			e.moveLeft()
+		case keyCtrlF:
+			e.moveRight()
+		case keyCtrlK:
+			e.buf = e.buf[:e.cursor]
+		case keyCtrlU:
+			e.buf = append(e.buf[:0], e.buf[e.cursor:]...)
+			e.cursor = 0
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			historyIdx, pending = e.walkHistory(historyIdx, -1, pending)
+		case keyCtrlN:
+			historyIdx, pending = e.walkHistory(historyIdx, 1, pending)
+		case keyBackspace, keyDelete:
+			e.deleteBackward()
+		case keyTab:
+			e.completeWord(prompt)
+		case keyEscape:
+			switch e.readEscapeSequence() {
+			case "[A", "OA":
+				historyIdx, pending = e.walkHistory(historyIdx, -1, pending)
+			case "[B", "OB":
+				historyIdx, pending = e.walkHistory(historyIdx, 1, pending)
+			case "[C", "OC":
+				e.moveRight()
+			case "[D", "OD":
+				e.moveLeft()
+			case "[H", "OH", "[1~", "[7~":
+				e.cursor = 0
+			case "[F", "OF", "[4~", "[8~":
+				e.cursor = len(e.buf)
+			case "[3~":
+				e.deleteForward()
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.insert([]rune{r})
+			}
+		}
+
+		e.refresh(prompt)
+	}
+}
+
+// Reads the remainder of an escape sequence following the ESC key,
+// e.g. `[A` for the up arrow or `[3~` for the delete key
+func (e *lineEditor) readEscapeSequence() string {
+	var seq strings.Builder
+
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	seq.WriteRune(r)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq.WriteRune(r)
+		if !unicode.IsDigit(r) && r != ';' {
+			return seq.String()
+		}
+	}
+}
+
+// Redraws the prompt and line, then moves the terminal cursor back to the editing position
+func (e *lineEditor) refresh(prompt string) {
+	var sb strings.Builder
+
+	sb.WriteString("\r")
+	sb.WriteString(prompt)
+	sb.WriteString(string(e.buf))
+	sb.WriteString("\x1b[K")
+	if back := len(e.buf) - e.cursor; back > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dD", back)
+	}
+
+	io.WriteString(e.out, sb.String())
+}
+
+// Inserts runes at the cursor and moves the cursor after them
+func (e *lineEditor) insert(runes []rune) {
+	tail := append([]rune{}, e.buf[e.cursor:]...)
+	e.buf = append(append(e.buf[:e.cursor], runes...), tail...)
+	e.cursor += len(runes)
+}
+
+func (e *lineEditor) deleteBackward() {
+	if e.cursor == 0 {
+		return
+	}
+	e.buf = append(e.buf[:e.cursor-1], e.buf[e.cursor:]...)
+	e.cursor--
+}
+
+func (e *lineEditor) deleteForward() {
+	if e.cursor == len(e.buf) {
+		return
+	}
+	e.buf = append(e.buf[:e.cursor], e.buf[e.cursor+1:]...)
+}
+
+func (e *lineEditor) moveLeft() {
+	if e.cursor > 0 {
+		e.cursor--
+	}
+}
+
+func (e *lineEditor) moveRight() {
+	if e.cursor < len(e.buf) {
+		e.cursor++
+	}
+}
+
+// Replaces the line by the history entry in the given direction (-1 older, 1 newer)
+// Walking past the newest entry brings back the line that was pending before walking the history.
+func (e *lineEditor) walkHistory(idx, direction int, pending string) (int, string) {
+	next := idx + direction
+	if next < 0 || next > e.history.Len() {
+		return idx, pending
+	}
+
+	if idx == e.history.Len() {
+		pending = string(e.buf)
+	}
+
+	if next == e.history.Len() {
+		e.buf = []rune(pending)
+	} else {
+		e.buf = []rune(e.history.At(next))
+	}
+	e.cursor = len(e.buf)
+
+	return next, pending
+}
+
+// Completes the word in front of the cursor
+// A single candidate is inserted, otherwise the longest common prefix of the candidates
+// is inserted, and when there's no common prefix to add, the candidates are listed.
+func (e *lineEditor) completeWord(prompt string) {
+	start := e.cursor
+	for start > 0 && isWordRune(e.buf[start-1]) {
+		start--
+	}
+	prefix := string(e.buf[start:e.cursor])
+	if prefix == "" || e.complete == nil {
+		return
+	}
+
+	candidates := e.complete(prefix)
+	switch len(candidates) {
+	case 0:
+		io.WriteString(e.out, "\a")
+	case 1:
+		e.insert([]rune(strings.TrimPrefix(candidates[0], prefix)))
+	default:
+		common := commonPrefix(candidates)
+		if len(common) > len(prefix) {
+			e.insert([]rune(strings.TrimPrefix(common, prefix)))
+			return
+		}
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+// Returns the sorted names starting with prefix out of the given name lists, without duplicates
+func completions(prefix string, lists ...[]string) []string {
+	seen := make(map[string]bool)
+	candidates := []string{}
+
+	for _, names := range lists {
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
+
+// Returns the longest prefix shared by every given string
+func commonPrefix(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// Verifies if a given character can be part of an identifier
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
@@ -3,51 +3,131 @@
 package repl
 
 import (
+	"YARTBML/diagnostic"
 	"YARTBML/evaluator"
 	"YARTBML/lexer"
 	"YARTBML/object"
 	"YARTBML/parser"
+	"YARTBML/token"
 	"bufio"
-	"fmt"
 	"io"
+	"os"
 )
 
 const PROMPT = ">> "
 
+// Capabilities granted to programs typed into the REPL
+// The user typing in code is the one holding the authority, so every capability is granted
+var capabilities = []object.Capability{
+	object.STDIN_CAP,
+	object.STDOUT_CAP,
+	object.STDERR_CAP,
+	object.FILESYSTEM_CAP,
+	object.ENV_CAP,
+	object.TIME_CAP,
+	object.RANDOM_CAP,
+}
+
 // Takes an input, lexes, parses, evals, then prints the result
+// Builtin IO goes through the same reader and writer as the REPL itself,
+// so `readLine()` consumes the next line of input and `puts` writes to out.
+// Input spanning several lines is read until it is complete, and when in is
+// a terminal, lines are read through a line editor with a persistent history.
+// Input starting with a colon is run as a meta-command (see `:help`).
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	reader := bufio.NewReader(in)
+	sandbox := object.NewSandbox(reader, out, out, capabilities...)
+	s := &session{
+		out:     out,
+		sandbox: sandbox,
+		env:     object.NewSandboxedEnvironment(sandbox),
+	}
+
+	complete := func(prefix string) []string {
+		return completions(prefix, s.env.Names(), evaluator.BuiltinNames(), token.Keywords())
+	}
+	lines, hist := newLineReader(in, reader, out, complete)
+
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(lines)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
-		line := scanner.Text()
-		// Pass to lexer
-		l := lexer.New(line)
-		// Pass to parser
-		p := parser.New(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+		if hist != nil {
+			hist.Add(input)
 		}
-		// Pass to evaluator
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+
+		if isCommand(input) {
+			s.runCommand(input)
+			continue
 		}
+		s.eval(input)
 
 		// Loop back to input
 	}
 }
 
-// Prints errors from the parser
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// State of a REPL session, shared by the evaluated code and the meta-commands
+type session struct {
+	out     io.Writer
+	sandbox *object.Sandbox
+	env     *object.Environment
+}
+
+// Lexes, parses and evaluates the input within the session's environment, then prints the result
+func (s *session) eval(input string) {
+	evaluated, ok := s.evalInput(input)
+	if ok && evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+}
+
+// Lexes, parses and evaluates the input within the session's environment
+// Parser errors are printed and reported by returning false.
+func (s *session) evalInput(input string) (object.Object, bool) {
+	// Pass to lexer
+	l := lexer.New(input)
+	// Pass to parser
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, input, p.Errors())
+		return nil, false
 	}
+	// Pass to evaluator
+	return evaluator.Eval(program, s.env), true
+}
+
+// Creates the reader used to read lines of input
+// Terminals get a line editor backed by the history dotfile, which is returned as well,
+// any other input is read line by line without any editing.
+func newLineReader(
+	in io.Reader,
+	reader *bufio.Reader,
+	out io.Writer,
+	complete func(string) []string,
+) (lineReader, *history) {
+	file, ok := in.(*os.File)
+	if !ok || !isTerminal(file.Fd()) {
+		return &plainReader{in: reader, out: out}, nil
+	}
+
+	hist := newHistory(defaultHistoryPath())
+	editor := &lineEditor{
+		in:       reader,
+		out:      out,
+		history:  hist,
+		complete: complete,
+		raw:      func() (func(), error) { return makeRaw(file.Fd()) },
+	}
+	return editor, hist
+}
+
+// Prints errors from the parser, underlining where they are within the input
+func printParserErrors(out io.Writer, input string, errors []diagnostic.Diagnostic) {
+	diagnostic.Render(out, "", input, errors)
 }
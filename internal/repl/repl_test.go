@@ -0,0 +1,246 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartWritesToOut(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 5;\nx * 2;\n",
+			">> >> 10\n>> ",
+		},
+		{
+			"puts(\"hello\");\n",
+			">> hello\nnull\n>> ",
+		},
+		{
+			"print(1, 2); 3;\n",
+			">> 123\n>> ",
+		},
+		{
+			"eprint(\"oops\");\n",
+			">> oops\nnull\n>> ",
+		},
+		{
+			"let name = readLine();\nYARTBML\n\"Hi \" + name;\n",
+			">> >> Hi YARTBML\n>> ",
+		},
+		{
+			"readLine();\n",
+			">> null\n>> ",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong REPL output for %q. expected=%q, got=%q",
+				tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a +\n  b;\n};\nadd(1,\n2);\n"
+	expected := ">> .. .. .. >> .. 3\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"", false},
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) { a + b; };", false},
+		{"[1, 2,", true},
+		{"{\"a\": [1, 2]", true},
+		{"add(1, 2", true},
+		{"let x =", true},
+		{"5 +", true},
+		{"5 == ", true},
+		{"if (x) { 1; } else", true},
+		{"};", false},
+		{"x;", false},
+		{"puts(`a", true},
+		{"puts(`a ${x", true},
+		{"`a ${ {\"k\": 1}[\"k\"] } b`;", false},
+		{"`a`;", false},
+		{"h?[\"a\"", true},
+		{"x ??", true},
+		{"h?.a ?? 1;", false},
+		{"1 in", true},
+		{"1 in s;", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. expected=%t, got=%t",
+				tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	h := newHistory(path)
+	h.Add("let x = 5;")
+	h.Add("let x = 5;")
+	h.Add("   ")
+	h.Add("let add = fn(a, b) {\n  a + b; // sum\n};")
+	h.Add("let s = `a\n  b`;")
+	h.Add(`puts("a\\nb\\\\");`)
+
+	loaded := newHistory(path)
+	expected := []string{"let x = 5;", "let add = fn(a, b) {\n  a + b; // sum\n};", "let s = `a\n  b`;", `puts("a\\nb\\\\");`}
+	if loaded.Len() != len(expected) {
+		t.Fatalf("history has wrong number of entries. expected=%d, got=%d",
+			len(expected), loaded.Len())
+	}
+	for i, entry := range expected {
+		if loaded.At(i) != entry {
+			t.Errorf("history entry %d wrong. expected=%q, got=%q", i, entry, loaded.At(i))
+		}
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	got := completions("re", []string{"result", "x"}, []string{"rest", "readLine", "len"}, []string{"return"})
+	expected := []string{"readLine", "rest", "result", "return"}
+
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong completions. expected=%v, got=%v", expected, got)
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	hist := newHistory("")
+	hist.Add("let first = 1;")
+	hist.Add("let second = 2;")
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"let x = 5;\r", "let x = 5;"},
+		{"let x = 5\x1b[D\x1b[D\x1b[D\x1b[D\x7f\x7f\r", "let = 5"},
+		{"x;\x01let \r", "let x;"},
+		{"abc\x01\x1b[3~\r", "bc"},
+		{"let x = 5;\x01\x1b[C\x1b[C\x1b[C\x0b\r", "let"},
+		{"\x1b[A\r", "let second = 2;"},
+		{"\x1b[A\x1b[A\r", "let first = 1;"},
+		{"pend\x1b[A\x1b[B\r", "pend"},
+		{"put\t(1);\r", "puts(1);"},
+		{"pu\ts(1);\r", "pus(1);"},
+		{"ret\t 1;\r", "return 1;"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		editor := &lineEditor{
+			in:      bufio.NewReader(strings.NewReader(tt.keys)),
+			out:     &out,
+			history: hist,
+			complete: func(prefix string) []string {
+				return completions(prefix, []string{"puts", "push", "return"})
+			},
+		}
+
+		line, err := editor.ReadLine(PROMPT)
+		if err != nil {
+			t.Errorf("ReadLine(%q) returned an error: %s", tt.keys, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestLineEditorControlKeys(t *testing.T) {
+	var out bytes.Buffer
+	editor := &lineEditor{
+		in:      bufio.NewReader(strings.NewReader("let\x03\x04")),
+		out:     &out,
+		history: newHistory(""),
+	}
+
+	if _, err := editor.ReadLine(PROMPT); err != errInterrupted {
+		t.Errorf("Ctrl-C didn't interrupt the line. got=%v", err)
+	}
+	if _, err := editor.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line didn't end the input. got=%v", err)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.ybml")
+	if err := os.WriteFile(file, []byte("let double = fn(x) { x * 2; };"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{":help\n", []string{":env", ":type <expr>", ":ast <expr>", ":tokens <expr>", ":load <file>", ":reset", ":time <expr>"}},
+		{"let x = 5;\nlet s = \"hi\";\n:env\n", []string{"s: STRING\nx: INTEGER\n"}},
+		{"let x = 5;\n:type x + 1\n", []string{">> INTEGER\n"}},
+		{":type [1, 2];\n", []string{">> ARRAY\n"}},
+		{":type y\n", []string{"ERROR: identifier not found: y\n"}},
+		{":type let z = 1;\n", []string{"no value\n"}},
+		{":ast 1 + 2\n", []string{
+			"Program\n" +
+				"  Statements[0]: ExpressionStatement \"(1 + 2)\"\n" +
+				"    Expression: InfixExpression Operator=\"+\" \"(1 + 2)\"\n" +
+				"      Left: IntegerLiteral Value=1 \"1\"\n" +
+				"      Right: IntegerLiteral Value=2 \"2\"\n",
+		}},
+		{":tokens let y = 2;\n", []string{
+			"1:1    LET        \"let\"\n" +
+				"1:5    IDENT      \"y\"\n" +
+				"1:7    =          \"=\"\n" +
+				"1:9    INT        \"2\"\n" +
+				"1:10   ;          \";\"\n",
+		}},
+		{":load " + file + "\ndouble(4);\n", []string{">> 8\n"}},
+		{":load missing.ybml\n", []string{"could not load file"}},
+		{"let x = 5;\n:reset\nx;\n", []string{"ERROR: identifier not found: x\n"}},
+		{":time 1 + 1\n", []string{">> 2\ntime: "}},
+		{":bogus\n", []string{"unknown command: :bogus"}},
+		{":type\n", []string{"usage: :type <expr>\n"}},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		for _, expected := range tt.expected {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("REPL output for %q doesn't contain %q. got=%q",
+					tt.input, expected, out.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package repl
+
+import (
+	"YARTBML/ast"
+	"YARTBML/token"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Prints the syntax tree rooted at node, one node per line, indented by depth.
+// Each line shows the field holding the node, the node type, its non-node fields
+// and the String() representation of the node.
+//
+//	Program
+//	  Statements[0]: ExpressionStatement "(1 + 2)"
+//	    Expression: InfixExpression Operator="+" "(1 + 2)"
+func printTree(out io.Writer, node ast.Node) {
+	printNode(out, "", node, 0)
+}
+
+func printNode(out io.Writer, label string, node ast.Node, depth int) {
+	v := reflect.ValueOf(node)
+	if !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+		fmt.Fprintf(out, "%s%s<nil>\n", strings.Repeat("  ", depth), label)
+		return
+	}
+	elem := v.Elem()
+
+	var sb strings.Builder
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(label)
+	sb.WriteString(elem.Type().Name())
+
+	// Attributes: every field that isn't a node nor a token
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		value := elem.Field(i)
+		if !field.IsExported() || field.Type == tokenType || ast.HoldsNodes(field.Type) {
+			continue
+		}
+		fmt.Fprintf(&sb, " %s=%#v", field.Name, value.Interface())
+	}
+	if _, isProgram := node.(*ast.Program); !isProgram {
+		fmt.Fprintf(&sb, " %q", node.String())
+	}
+	fmt.Fprintln(out, sb.String())
+
+	// Children: every field holding nodes
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		value := elem.Field(i)
+		if !field.IsExported() || !ast.HoldsNodes(field.Type) {
+			continue
+		}
+
+		switch value.Kind() {
+		case reflect.Slice:
+			for j := 0; j < value.Len(); j++ {
+				printChild(out, fmt.Sprintf("%s[%d]: ", field.Name, j), value.Index(j), depth+1)
+			}
+		case reflect.Map:
+			keys := value.MapKeys()
+			sort.Slice(keys, func(a, b int) bool {
+				return keys[a].Interface().(ast.Node).String() < keys[b].Interface().(ast.Node).String()
+			})
+			for _, key := range keys {
+				printChild(out, field.Name+" key: ", key, depth+1)
+				printChild(out, field.Name+" value: ", value.MapIndex(key), depth+1)
+			}
+		default:
+			printChild(out, field.Name+": ", value, depth+1)
+		}
+	}
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+func printChild(out io.Writer, label string, value reflect.Value, depth int) {
+	node, _ := value.Interface().(ast.Node)
+	printNode(out, label, node, depth)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"YARTBML/ast"
+	"YARTBML/checker"
+	"YARTBML/diagnostic"
+	"YARTBML/evaluator"
+	"YARTBML/format"
+	"YARTBML/lexer"
+	"YARTBML/lint"
+	"YARTBML/lsp"
+	"YARTBML/object"
+	"YARTBML/optimizer"
+	"YARTBML/parser"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// yartbml run [--allow caps] [--no-optimize] <file>
+// Runs the optimized program with only the allowed capabilities granted.
+// Programs with undefined names or type errors aren't run.
+// Diagnostics and runtime errors are rendered to stderr.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	allow := flags.String("allow", "stdin,stdout,stderr", "comma-separated `capabilities` granted to the program")
+	noOptimize := flags.Bool("no-optimize", false, "evaluate the program as written, without optimizing it")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: yartbml run [--allow caps] [--no-optimize] <file>")
+		return 2
+	}
+
+	filename := flags.Arg(0)
+	source, program, diagnostics, err := parseFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(diagnostics) == 0 {
+		diagnostics = append(evaluator.Resolve(program, object.NewEnvironment()), checker.Check(program)...)
+		diagnostic.Sort(diagnostics)
+	}
+	// Warnings are reported, but only errors keep the program from running
+	if len(diagnostics) != 0 {
+		diagnostic.Render(os.Stderr, filename, source, diagnostics)
+	}
+	if diagnostic.HasErrors(diagnostics) {
+		return 1
+	}
+
+	capabilities := []object.Capability{}
+	for _, c := range strings.Split(*allow, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			capabilities = append(capabilities, object.Capability(c))
+		}
+	}
+	sandbox := object.NewSandbox(os.Stdin, os.Stdout, os.Stderr, capabilities...)
+
+	if !*noOptimize {
+		program = optimizer.Optimize(program)
+	}
+
+	evaluated := evaluator.Eval(program, object.NewSandboxedEnvironment(sandbox))
+	if err, ok := evaluated.(*object.Error); ok {
+		diagnostic.Render(os.Stderr, filename, source, []diagnostic.Diagnostic{err.Diagnostic()})
+		return 1
+	}
+
+	return 0
+}
+
+// yartbml check [--json] <file>
+// Reports the diagnostics of the program without running it: syntax errors, or undefined names and type errors.
+// With --json, the diagnostics are written to stdout as a JSON array for editors.
+func checkCommand(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "write the diagnostics as JSON")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: yartbml check [--json] <file>")
+		return 2
+	}
+
+	filename := flags.Arg(0)
+	source, program, diagnostics, err := parseFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(diagnostics) == 0 {
+		diagnostics = append(evaluator.Resolve(program, object.NewEnvironment()), checker.Check(program)...)
+		diagnostic.Sort(diagnostics)
+	}
+
+	if *asJSON {
+		diagnostic.WriteJSON(os.Stdout, diagnostics)
+	} else {
+		diagnostic.Render(os.Stderr, filename, source, diagnostics)
+	}
+
+	if diagnostic.HasErrors(diagnostics) {
+		return 1
+	}
+	return 0
+}
+
+// yartbml parse [--json] [--optimize] <file>
+// Prints the AST of the program: one fully parenthesized statement per line,
+// or with --json, the JSON encoding of the tree for external tools.
+// With --optimize, the AST is printed as optimized by `run`.
+func parseCommand(args []string) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "write the AST as JSON")
+	optimize := flags.Bool("optimize", false, "optimize the AST before printing it")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: yartbml parse [--json] [--optimize] <file>")
+		return 2
+	}
+
+	filename := flags.Arg(0)
+	source, program, diagnostics, err := parseFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(diagnostics) != 0 {
+		diagnostic.Render(os.Stderr, filename, source, diagnostics)
+		return 1
+	}
+	if *optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	if !*asJSON {
+		for _, stmt := range program.Statements {
+			fmt.Println(stmt.String())
+		}
+		return 0
+	}
+
+	encoded, err := ast.EncodeJSON(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(encoded))
+	return 0
+}
+
+// yartbml lint [--config file] [--rule name=severity]... [--json] <file>
+// Reports the problems found by the rules of the linter, in the same format as `check`.
+// The severity of the rules is read from the JSON configuration file, then overridden by --rule flags.
+// With --list, lists the rules along with their default severity instead.
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	configFile := flags.String("config", "", "JSON `file` configuring the severity of the rules")
+	asJSON := flags.Bool("json", false, "write the diagnostics as JSON")
+	list := flags.Bool("list", false, "list the rules of the linter")
+	overrides := lint.Config{}
+	flags.Var(overrides, "rule", "set the severity of a rule as `name=severity`, where off disables the rule")
+	if err := flags.Parse(args); err != nil || (!*list && flags.NArg() != 1) {
+		fmt.Fprintln(os.Stderr, "usage: yartbml lint [--config file] [--rule name=severity]... [--json] <file>")
+		return 2
+	}
+
+	if *list {
+		for _, rule := range lint.Rules() {
+			fmt.Printf("%-18s %-8s %s\n", rule.Name, rule.Severity, rule.Description)
+		}
+		return 0
+	}
+
+	config := lint.Config{}
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err == nil {
+			config, err = lint.ParseConfig(data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration %s: %s\n", *configFile, err)
+			return 2
+		}
+	}
+	for name, severity := range overrides {
+		config[name] = severity
+	}
+
+	filename := flags.Arg(0)
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	source := string(contents)
+	diagnostics := lint.Source(source, config)
+	if *asJSON {
+		diagnostic.WriteJSON(os.Stdout, diagnostics)
+	} else {
+		diagnostic.Render(os.Stderr, filename, source, diagnostics)
+	}
+
+	if diagnostic.HasErrors(diagnostics) {
+		return 1
+	}
+	return 0
+}
+
+// yartbml fmt [--check | --write] <file>...
+// Prints the formatted programs to stdout.
+// With --check, lists the files that aren't formatted and fails if there are any.
+// With --write, rewrites the files that aren't formatted in place.
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "list the files that aren't formatted")
+	write := flags.Bool("write", false, "rewrite the files that aren't formatted")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 || (*check && *write) {
+		fmt.Fprintln(os.Stderr, "usage: yartbml fmt [--check | --write] <file>...")
+		return 2
+	}
+
+	status := 0
+	for _, filename := range flags.Args() {
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		source := string(contents)
+		formatted, diagnostics := format.Source(source)
+		if len(diagnostics) != 0 {
+			diagnostic.Render(os.Stderr, filename, source, diagnostics)
+			status = 1
+			continue
+		}
+
+		switch {
+		case *check:
+			if formatted != source {
+				fmt.Println(filename)
+				status = 1
+			}
+		case *write:
+			if formatted != source {
+				if err := os.WriteFile(filename, []byte(formatted), 0644); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+				}
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+
+	return status
+}
+
+// yartbml lsp
+// Serves editors over stdio until they exit.
+func lspCommand(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: yartbml lsp")
+		return 2
+	}
+
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Reads and parses the program stored in the file
+// Returns the source of the program along with its AST and the parser diagnostics.
+func parseFile(filename string) (string, *ast.Program, []diagnostic.Diagnostic, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	source := string(contents)
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	return source, program, p.Errors(), nil
+}
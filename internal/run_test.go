@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs the command on a file holding the source, returning its status and what it wrote to stderr
+func runWithStderr(t *testing.T, command func([]string) int, source string) (int, string) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "program.ybml")
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	status := command([]string{filename})
+	os.Stderr = stderr
+	w.Close()
+
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, string(output)
+}
+
+func TestRunReportsUndefinedNames(t *testing.T) {
+	status, output := runWithStderr(t, runCommand, "let x = y;\nputs(z);\n")
+
+	if status != 1 {
+		t.Errorf("wrong status. expected=1, got=%d", status)
+	}
+	for _, expected := range []string{
+		"program.ybml:1:9: error[undefined-name]: identifier not found: y",
+		"program.ybml:2:6: error[undefined-name]: identifier not found: z",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output doesn't contain %q. got=%q", expected, output)
+		}
+	}
+	if strings.Contains(output, "runtime-error") {
+		t.Errorf("undefined names reported as runtime errors. got=%q", output)
+	}
+}
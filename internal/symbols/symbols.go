@@ -0,0 +1,273 @@
+// Package symbols resolves the names of YARTBML programs: it finds the let statement or
+// function parameter every identifier refers to, following the scoping rules of the evaluator.
+// Tools like the language server and the linter build on the resulting table.
+package symbols
+
+import (
+	"YARTBML/ast"
+	"sort"
+)
+
+// Kind of a name bound within a program
+type Kind int
+
+const (
+	LET Kind = iota
+	PARAMETER
+	PATTERN  // Name bound by a pattern, of a match arm or of a destructuring let
+	FUNCTION // Name of a named function, bound within its body, or within the enclosing scope when declared by a statement
+	CAUGHT   // Name the catch block of a try expression binds the caught error to
+)
+
+// A name bound by a let statement, a function parameter, a pattern, a named function or a catch block,
+// along with every identifier referring to it.
+type Binding struct {
+	Kind     Kind
+	Name     *ast.Identifier
+	Value    ast.Expression       // Value of the let statement, or the named function
+	Function *ast.FunctionLiteral // Function declaring the parameter, or the named function
+	Scope    *Scope
+	Refs     []*ast.Identifier
+	end      int // Order after which the binding is out of view, 0 when it stays in view until its scope ends
+}
+
+// Reports whether the binding is only in view within a block of its scope, like the caught error within
+// the catch block or the names of the pattern of a match arm within the arm.
+// Such bindings never replace the bindings of the same name made around them.
+func (b *Binding) Local() bool {
+	return b.end != 0
+}
+
+// Names bound by the program or by the body of a function.
+// Blocks of if expressions don't introduce scopes of their own, just like in the evaluator.
+type Scope struct {
+	Outer    *Scope
+	Function *ast.FunctionLiteral // Function whose body is the scope, nil for the program
+	Bindings []*Binding
+	order    []int // Order in which each binding became visible
+}
+
+// Table of the names of a program
+type Table struct {
+	Scopes []*Scope // Scope of the program first, followed by the scope of every function
+
+	// Every identifier of the program in source order, either defining or using a name
+	Identifiers []*ast.Identifier
+	bindings    map[*ast.Identifier]*Binding
+	scopes      map[*ast.Identifier]*Scope
+}
+
+// Returns the binding the identifier defines or refers to.
+// Returns nil for builtins and undefined names.
+func (t *Table) BindingOf(ident *ast.Identifier) *Binding {
+	return t.bindings[ident]
+}
+
+// Reports whether the identifier is the name of a binding rather than a use of one
+func (t *Table) Defines(ident *ast.Identifier) bool {
+	b := t.bindings[ident]
+	return b != nil && b.Name == ident
+}
+
+// Returns the scope the identifier appears in
+func (t *Table) Enclosing(ident *ast.Identifier) *Scope {
+	return t.scopes[ident]
+}
+
+// Returns the scope of the function, or the scope of the program for nil.
+func (t *Table) ScopeOf(fn *ast.FunctionLiteral) *Scope {
+	for _, s := range t.Scopes {
+		if s.Function == fn {
+			return s
+		}
+	}
+	return nil
+}
+
+// An identifier referring to a name, waiting to be resolved once every binding is known
+type use struct {
+	ident *ast.Identifier
+	scope *Scope
+	order int
+}
+
+// Walks the AST of a program to find out which binding every identifier refers to
+type resolver struct {
+	*Table
+	uses  []use
+	order int
+}
+
+// Resolves the names of the program.
+func Resolve(program *ast.Program) *Table {
+	r := &resolver{Table: &Table{
+		bindings: map[*ast.Identifier]*Binding{},
+		scopes:   map[*ast.Identifier]*Scope{},
+	}}
+
+	root := &Scope{}
+	r.Scopes = append(r.Scopes, root)
+	ast.Walk(scopeVisitor{resolver: r, scope: root}, program)
+	r.resolve()
+
+	sort.Slice(r.Identifiers, func(i, j int) bool {
+		return r.Identifiers[i].Token.Pos.Offset < r.Identifiers[j].Token.Pos.Offset
+	})
+	return r.Table
+}
+
+// Visits the nodes of a scope, resolving them within it
+type scopeVisitor struct {
+	*resolver
+	scope *Scope
+}
+
+func (v scopeVisitor) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			// Like the name of a let, the names of its pattern are bound once its value has been evaluated
+			ast.Walk(v, node.Value)
+			for _, name := range ast.PatternNames(node.Pattern) {
+				v.declare(&Binding{Kind: PATTERN, Name: name}, v.scope)
+			}
+			return nil
+		}
+		if node.Name == nil {
+			return nil
+		}
+		// The name is only bound once its value has been evaluated: `let x = x + 1;` refers to the previous x
+		ast.Walk(v, node.Value)
+		v.declare(&Binding{Kind: LET, Name: node.Name, Value: node.Value}, v.scope)
+		return nil
+	case *ast.ExpressionStatement:
+		if fn := node.Declaration(); fn != nil {
+			// The name is bound before the body can be called, so the body refers to it as well
+			v.declare(&Binding{Kind: FUNCTION, Name: fn.Name, Value: fn, Function: fn}, v.scope)
+			v.function(fn, v.scope)
+			return nil
+		}
+	case *ast.Identifier:
+		v.Identifiers = append(v.Identifiers, node)
+		v.scopes[node] = v.scope
+		v.uses = append(v.uses, use{ident: node, scope: v.scope, order: v.next()})
+	case *ast.FunctionLiteral:
+		v.function(node, v.scope)
+		return nil
+	case *ast.TryExpression:
+		// The caught error is bound before the catch block is evaluated, within the enclosing scope,
+		// and is only in view within the catch block
+		ast.Walk(v, node.Body)
+		if node.Parameter != nil {
+			caught := &Binding{Kind: CAUGHT, Name: node.Parameter}
+			v.declare(caught, v.scope)
+			ast.Walk(v, node.Catch)
+			caught.end = v.next()
+		} else {
+			ast.Walk(v, node.Catch)
+		}
+		ast.Walk(v, node.Finally)
+		return nil
+	case *ast.MatchArm:
+		// The names of the pattern are bound before the guard and the value of the arm are evaluated,
+		// within the enclosing scope, and are only in view within the arm
+		if node.Pattern == nil {
+			return nil
+		}
+		names := []*Binding{}
+		for _, name := range ast.PatternNames(node.Pattern) {
+			b := &Binding{Kind: PATTERN, Name: name}
+			v.declare(b, v.scope)
+			names = append(names, b)
+		}
+		ast.Walk(v, node.Guard)
+		ast.Walk(v, node.Value)
+		end := v.next()
+		for _, b := range names {
+			b.end = end
+		}
+		return nil
+	}
+	return v
+}
+
+// The body of a function is a new scope holding its parameters, and its name unless a statement declares it
+func (r *resolver) function(fn *ast.FunctionLiteral, outer *Scope) {
+	inner := &Scope{Outer: outer, Function: fn}
+	r.Scopes = append(r.Scopes, inner)
+
+	if fn.Name != nil && r.bindings[fn.Name] == nil {
+		r.declare(&Binding{Kind: FUNCTION, Name: fn.Name, Value: fn, Function: fn}, inner)
+	}
+
+	for i, param := range fn.Parameters {
+		// Defaults are evaluated when calling, after binding the parameters before them
+		ast.Walk(scopeVisitor{resolver: r, scope: inner}, fn.Default(i))
+		r.declare(&Binding{Kind: PARAMETER, Name: param, Function: fn}, inner)
+	}
+	ast.Walk(scopeVisitor{resolver: r, scope: inner}, fn.Body)
+}
+
+func (r *resolver) declare(b *Binding, s *Scope) {
+	b.Scope = s
+	r.Identifiers = append(r.Identifiers, b.Name)
+	r.bindings[b.Name] = b
+	r.scopes[b.Name] = s
+	s.Bindings = append(s.Bindings, b)
+	s.order = append(s.order, r.next())
+}
+
+func (r *resolver) next() int {
+	r.order++
+	return r.order
+}
+
+// Resolves every use to its binding.
+// Within its own scope, a name refers to the latest binding in view made before it is used.
+// Within the enclosing scopes, a name may also refer to a binding made after the function was
+// defined, since the function can only be called later on: `let f = fn() { g(); }; let g = ...;`
+func (r *resolver) resolve() {
+	for _, u := range r.uses {
+		for s := u.scope; s != nil; s = s.Outer {
+			b := s.lookup(u.ident.Value, u.order, s != u.scope)
+			if b != nil {
+				b.Refs = append(b.Refs, u.ident)
+				r.bindings[u.ident] = b
+				break
+			}
+		}
+	}
+}
+
+func (s *Scope) lookup(name string, order int, allowLater bool) *Binding {
+	var later *Binding
+	for i := len(s.Bindings) - 1; i >= 0; i-- {
+		b := s.Bindings[i]
+		if b.Name.Value != name || (b.Local() && order >= b.end) {
+			continue
+		}
+		if s.order[i] < order {
+			return b
+		}
+		if !b.Local() {
+			later = b
+		}
+	}
+	if allowLater {
+		return later
+	}
+	return nil
+}
+
+// Returns every binding of the name made in the scope or the scopes enclosing it, innermost first
+func (s *Scope) Lookup(name string) []*Binding {
+	found := []*Binding{}
+	for ; s != nil; s = s.Outer {
+		for i := len(s.Bindings) - 1; i >= 0; i-- {
+			if s.Bindings[i].Name.Value == name {
+				found = append(found, s.Bindings[i])
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,94 @@
+package symbols
+
+import (
+	"YARTBML/ast"
+	"YARTBML/lexer"
+	"YARTBML/parser"
+	"testing"
+)
+
+func resolve(t *testing.T, input string) *Table {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return Resolve(program)
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // Position of the binding of every identifier, in source order, "" for unresolved ones
+	}{
+		{"let x = 1; x;", []string{"1:5", "1:5"}},
+		{"x; let x = 1;", []string{"", "1:8"}},
+		{"let x = 1; let x = x + 1; x;", []string{"1:5", "1:16", "1:5", "1:16"}},
+		{"let f = fn(a) { a; }; f(a);", []string{"1:5", "1:12", "1:12", "1:5", ""}},
+		{"let f = fn() { g(); }; let g = fn() { 1; };", []string{"1:5", "1:28", "1:28"}},
+		{"let f = fn(n) { f(n - 1); };", []string{"1:5", "1:12", "1:5", "1:12"}},
+		{"let x = 1; `${x} ${`${x}`}`;", []string{"1:5", "1:5", "1:5"}},
+		{"try { e; } catch (e) { e; }; e;", []string{"", "1:19", "1:19", ""}},
+		{"let e = 5; try { 1; } catch (e) { e; }; e;", []string{"1:5", "1:30", "1:30", "1:5"}},
+		{"try { 1; } catch (e) { fn() { e; }; }; let f = fn() { e; };", []string{"1:19", "1:19", "1:44", ""}},
+		{"let f = 1; fn f(n) { f(n - 1); }; f;", []string{"1:5", "1:15", "1:17", "1:15", "1:17", "1:15"}},
+		{"let h = fn g() { g; }; g;", []string{"1:5", "1:12", "1:12", ""}},
+		{"let x = 1; let f = fn() { let x = 2; x; }; x;", []string{"1:5", "1:16", "1:31", "1:31", "1:5"}},
+		{"if (true) { let y = 1; }; y;", []string{"1:17", "1:17"}},
+		{`let k = "a"; {k: puts(k)};`, []string{"1:5", "1:5", "", "1:5"}},
+		{"let n = 1; match (n) { [n, ...t] if n > 0 => t, x => n };", []string{"1:5", "1:5", "1:25", "1:31", "1:25", "1:31", "1:49", "1:5"}},
+		{"let [a, ...b] = [a]; b;", []string{"1:6", "1:12", "", "1:12"}},
+		{"let f = fn(a, b = a, ...c) { c; }; f(1);", []string{"1:5", "1:12", "1:15", "1:12", "1:25", "1:25", "1:5"}},
+	}
+
+	for _, tt := range tests {
+		table := resolve(t, tt.input)
+		if len(table.Identifiers) != len(tt.expected) {
+			t.Errorf("wrong number of identifiers for %q. expected=%d, got=%d", tt.input, len(tt.expected), len(table.Identifiers))
+			continue
+		}
+
+		for i, ident := range table.Identifiers {
+			got := ""
+			if b := table.BindingOf(ident); b != nil {
+				got = b.Name.Token.Pos.String()
+			}
+			if got != tt.expected[i] {
+				t.Errorf("%q: identifier %s at %s bound at %q, expected %q",
+					tt.input, ident.Value, ident.Token.Pos, got, tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	table := resolve(t, "let x = 1; let f = fn(a, b) { let c = a; c; }; f(x, x);")
+
+	if len(table.Scopes) != 2 || table.ScopeOf(nil) != table.Scopes[0] {
+		t.Fatalf("wrong scopes. got=%d", len(table.Scopes))
+	}
+
+	fn := table.Scopes[0].Bindings[1].Value.(*ast.FunctionLiteral)
+	inner := table.ScopeOf(fn)
+	if inner == nil || inner.Outer != table.Scopes[0] || len(inner.Bindings) != 3 {
+		t.Fatalf("wrong scope of the function. got=%+v", inner)
+	}
+
+	kinds := []Kind{PARAMETER, PARAMETER, LET}
+	for i, b := range inner.Bindings {
+		if b.Kind != kinds[i] || b.Scope != inner {
+			t.Errorf("wrong binding %s. got kind=%d", b.Name.Value, b.Kind)
+		}
+	}
+	if a := inner.Bindings[0]; a.Function != fn || len(a.Refs) != 1 || !table.Defines(a.Name) || table.Defines(a.Refs[0]) {
+		t.Errorf("wrong parameter a. got=%+v", a)
+	}
+
+	if found := inner.Lookup("x"); len(found) != 1 || found[0].Scope != table.Scopes[0] {
+		t.Errorf("x not found from the function. got=%v", found)
+	}
+	if found := table.Scopes[0].Lookup("c"); len(found) != 0 {
+		t.Errorf("c shouldn't be visible from the program. got=%v", found)
+	}
+}
@@ -6,13 +6,35 @@
 // This package provides constants for all supported tokens and helper functions for working with them.
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 // TokenType represents the type of a token.
 type TokenType string
 
-// Token holds the type and literal value of a token in UTF-8.
+// Token holds the type and literal value of a token in UTF-8,
+// along with the position of its first character within the input
+// and the position right after its last character.
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+	End     Position
+}
+
+// Position of a character within the input.
+// Lines and columns start at 1, columns and offsets are counted in bytes.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Formats the position as `line:column`.
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 // Symbolic names substituted at complile time for the assigned value
@@ -22,10 +44,18 @@ const (
 	EOF     = "EOF"
 
 	// Identifiers + literals
+	COMMENT = "COMMENT" // Line comment: // ...
+
 	IDENT  = "IDENT"  // add, foobar, x, y, ...
 	INT    = "INT"    // 123456
 	STRING = "STRING" // "foobar"
 
+	// Template strings are split around the values embedded within them
+	TEMPLATE        = "TEMPLATE"        // `foo` without embedded values
+	TEMPLATE_HEAD   = "TEMPLATE_HEAD"   // `foo${
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE" // }foo${
+	TEMPLATE_TAIL   = "TEMPLATE_TAIL"   // }foo`
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -40,6 +70,14 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	ARROW     = "->"  // Result type of a function: fn(a: int) -> int
+	FAT_ARROW = "=>"  // Separates the pattern of a match arm from its value
+	ELLIPSIS  = "..." // Rest of an array pattern: [head, ...tail]
+
+	OPTIONAL_INDEX = "?[" // Index of a value that may be null: a?[0]
+	OPTIONAL_FIELD = "?." // Field of a hash that may be null: a?.name
+	COALESCE       = "??" // Default of a value that may be null: a ?? 0
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -60,17 +98,39 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MATCH    = "MATCH"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	IN       = "IN"
 )
 
 // Keywords maps identifiers to their corresponding token types.
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"match":   MATCH,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"in":      IN,
+}
+
+// Keywords returns every reserved keyword of the language in sorted order.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 // LookupIdent checks if the given identifier is a keyword. If it is, it returns the corresponding token type; otherwise, it returns IDENT.